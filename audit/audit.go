@@ -0,0 +1,306 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/requestid"
+	"github.com/uptrace/bun"
+)
+
+// chainLock is the advisory lock key that serialises appends, so every entry
+// links to the one before it.
+const chainLock = 7_231_045
+
+// Entry is one record in the append-only audit log. Each entry's Hash covers
+// its content and the hash of the entry before it, so changing or removing a
+// past entry breaks the chain from there on.
+type Entry struct {
+	bun.BaseModel `bun:"table:audit_log,alias:entry" swaggerignore:"true"`
+
+	ID int64 `bun:",pk,autoincrement" json:"id" example:"1042"`
+	// ActorID is nil for changes made by the system, such as scheduled jobs.
+	ActorID *int64 `bun:"actor_id" json:"actor_id" example:"1"`
+	// ImpersonatorID is the admin who took the action while impersonating
+	// the actor.
+	ImpersonatorID *int64 `bun:"impersonator_id" json:"impersonator_id,omitempty" example:"2"`
+	Action         string `bun:"action,notnull" json:"action" example:"product.delete"`
+	TargetType     string `bun:"target_type,notnull" json:"target_type" example:"product"`
+	TargetID       string `bun:"target_id,notnull" json:"target_id" example:"42"`
+	// Changes maps every changed field to its value before and after.
+	Changes   json.RawMessage `bun:"changes,type:json,nullzero" json:"changes,omitempty" swaggertype:"object"`
+	RequestID string          `bun:"request_id,notnull" json:"request_id,omitempty" example:"9f86d081884c7d65"`
+	IP        string          `bun:"ip,notnull" json:"ip,omitempty" example:"203.0.113.7"`
+	UserAgent string          `bun:"user_agent,notnull" json:"user_agent,omitempty" example:"Mozilla/5.0"`
+	CreatedAt time.Time       `bun:"created_at,notnull" json:"created_at"`
+	PrevHash  string          `bun:"prev_hash,notnull" json:"prev_hash" example:"3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b"`
+	Hash      string          `bun:"hash,notnull,unique" json:"hash" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+}
+
+// Change is the value of a field before and after an action.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// New starts an entry for an action taken in the request, by the
+// authenticated user if there is one.
+func New(ctx *gin.Context, action, targetType string, targetID any) Entry {
+	entry := Entry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		RequestID:  requestid.Get(ctx),
+		IP:         ctx.ClientIP(),
+		UserAgent:  ctx.Request.UserAgent(),
+	}
+	if claims := auth.CurrentClaims(ctx); claims != nil {
+		entry.ActorID = &claims.UserID
+		if claims.Impersonated() {
+			entry.ImpersonatorID = &claims.ImpersonatorID
+		}
+	}
+	return entry
+}
+
+// LogImpersonation records every request an admin makes while impersonating
+// a user, whether or not it changes anything.
+func LogImpersonation(db bun.IDB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+
+		claims := auth.CurrentClaims(ctx)
+		if claims == nil || !claims.Impersonated() {
+			return
+		}
+		entry := New(ctx, "impersonation.request", "user", claims.UserID).Diff(nil, map[string]any{
+			"method": ctx.Request.Method,
+			"path":   ctx.Request.URL.Path,
+			"status": ctx.Writer.Status(),
+		})
+		Log(ctx.Request.Context(), db, entry)
+	}
+}
+
+// System starts an entry for an action nobody asked for, such as a
+// scheduled job.
+func System(action, targetType string, targetID any) Entry {
+	return Entry{Action: action, TargetType: targetType, TargetID: fmt.Sprint(targetID)}
+}
+
+// By sets the actor, for actions whose actor is only known once they are
+// done, such as signing up.
+func (e Entry) By(userID int64) Entry {
+	e.ActorID = &userID
+	return e
+}
+
+// Diff records the fields that differ between before and after, which are
+// structs or maps that encode to JSON objects. Either may be nil when the
+// target is created or deleted. Only pass public views of a model, never the
+// model itself, and Redact personal data. Fields named in secretFields are
+// dropped in case a secret slips through anyway.
+func (e Entry) Diff(before, after any) Entry {
+	old, err := fields(before)
+	if err == nil {
+		var updated map[string]any
+		updated, err = fields(after)
+		if err == nil {
+			e.Changes = changes(old, updated)
+			return e
+		}
+	}
+	fmt.Printf("Recording changes of %s %s failed: %v\n", e.TargetType, e.TargetID, err)
+	return e
+}
+
+// Redact hides the values of the named fields in the recorded changes,
+// keeping only whether they were set before and after. Personal data has to
+// be redacted, since the log can't be changed when a user is erased.
+func (e Entry) Redact(names ...string) Entry {
+	if e.Changes == nil {
+		return e
+	}
+	var diff map[string]Change
+	if err := json.Unmarshal(e.Changes, &diff); err != nil {
+		return e
+	}
+	for _, name := range names {
+		if change, ok := diff[name]; ok {
+			diff[name] = Change{Before: redacted(change.Before), After: redacted(change.After)}
+		}
+	}
+	e.Changes, _ = json.Marshal(diff)
+	return e
+}
+
+// secretFields are never recorded, not even redacted.
+var secretFields = []string{
+	"password", "current_password", "new_password",
+	"secret", "client_secret", "totp_secret",
+	"token", "access_token", "refresh_token", "id_token", "mfa_token",
+	"key", "key_hash", "secret_hash", "code_hash", "token_hash",
+}
+
+func redacted(value any) any {
+	if value == nil {
+		return nil
+	}
+	return "[redacted]"
+}
+
+// changes encodes the fields that differ between old and updated, or returns
+// nil if none do.
+func changes(old, updated map[string]any) json.RawMessage {
+	diff := map[string]Change{}
+	for name, value := range old {
+		if newValue, ok := updated[name]; !ok || !reflect.DeepEqual(value, newValue) {
+			diff[name] = Change{Before: value, After: updated[name]}
+		}
+	}
+	for name, value := range updated {
+		if _, ok := old[name]; !ok {
+			diff[name] = Change{After: value}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	encoded, _ := json.Marshal(diff)
+	return encoded
+}
+
+// fields decodes the JSON object value encodes to.
+func fields(value any) (map[string]any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("audit: %T is not a JSON object: %w", value, err)
+	}
+	for _, name := range secretFields {
+		delete(decoded, name)
+	}
+	return decoded, nil
+}
+
+// hash returns the hash of the entry's content chained to PrevHash.
+func (e *Entry) hash() string {
+	// ImpersonatorID is omitted when unset, so the hash of an action taken
+	// without impersonation covers the same content as it did before the
+	// field was added.
+	content, _ := json.Marshal(struct {
+		PrevHash       string          `json:"prev_hash"`
+		ActorID        *int64          `json:"actor_id"`
+		ImpersonatorID *int64          `json:"impersonator_id,omitempty"`
+		Action         string          `json:"action"`
+		TargetType     string          `json:"target_type"`
+		TargetID       string          `json:"target_id"`
+		Changes        json.RawMessage `json:"changes"`
+		RequestID      string          `json:"request_id"`
+		IP             string          `json:"ip"`
+		UserAgent      string          `json:"user_agent"`
+		CreatedAt      string          `json:"created_at"`
+	}{
+		e.PrevHash, e.ActorID, e.ImpersonatorID, e.Action, e.TargetType, e.TargetID, e.Changes,
+		e.RequestID, e.IP, e.UserAgent, e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends the entry to the log. Pass the transaction making the
+// change, so the change and its entry are committed together.
+func Record(ctx context.Context, db bun.IDB, entry Entry) error {
+	return db.RunInTx(ctx, nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(c, "SELECT pg_advisory_xact_lock(?)", chainLock); err != nil {
+			return err
+		}
+
+		err := tx.NewSelect().
+			Model((*Entry)(nil)).
+			Column("hash").
+			Order("id DESC").
+			Limit(1).
+			Scan(c, &entry.PrevHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// The database keeps microseconds, and the hash has to match what
+		// is read back.
+		entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		entry.Hash = entry.hash()
+		_, err = tx.NewInsert().Model(&entry).Exec(c)
+		return err
+	})
+}
+
+// Log records an entry for an action that changes nothing, such as reading
+// data. A failure is only logged, and the entry is recorded even if ctx has
+// been cancelled since. Changes must use Record in their own transaction, so
+// none is committed without its entry.
+func Log(ctx context.Context, db bun.IDB, entry Entry) {
+	if err := Record(context.WithoutCancel(ctx), db, entry); err != nil {
+		fmt.Printf("Recording %s of %s %s failed: %v\n", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
+
+// Verify walks the log from the start and checks that every entry links to
+// the one before it and still matches its hash. It returns how many entries
+// it checked and the ID of the first one that doesn't match, or 0.
+func Verify(ctx context.Context, db bun.IDB) (int, int64, error) {
+	checked := 0
+	prevHash := ""
+	var lastID int64
+	for {
+		var entries []Entry
+		err := db.NewSelect().
+			Model(&entries).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(1000).
+			Scan(ctx)
+		if err != nil {
+			return checked, 0, err
+		}
+		if len(entries) == 0 {
+			return checked, 0, nil
+		}
+
+		valid, brokenID := verifyChain(entries, prevHash)
+		checked += valid
+		if brokenID != 0 {
+			return checked, brokenID, nil
+		}
+		prevHash = entries[len(entries)-1].Hash
+		lastID = entries[len(entries)-1].ID
+	}
+}
+
+// verifyChain checks entries in order, the first linking to prevHash. It
+// returns how many entries match and the ID of the first that doesn't, or 0.
+func verifyChain(entries []Entry, prevHash string) (int, int64) {
+	for i := range entries {
+		entry := &entries[i]
+		if entry.PrevHash != prevHash || entry.hash() != entry.Hash {
+			return i, entry.ID
+		}
+		prevHash = entry.Hash
+	}
+	return len(entries), 0
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/in43sh/homebuzz-backend/migrations"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// chain links entries the way Record does, starting from prevHash.
+func chain(prevHash string, entries ...Entry) []Entry {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for i := range entries {
+		entries[i].ID = int64(i + 1)
+		entries[i].PrevHash = prevHash
+		entries[i].CreatedAt = start.Add(time.Duration(i) * time.Second)
+		entries[i].Hash = entries[i].hash()
+		prevHash = entries[i].Hash
+	}
+	return entries
+}
+
+func sampleChain() []Entry {
+	return chain("",
+		System("product.delete", "product", 42),
+		System("user.login", "user", 7).By(7),
+		System("order.cancel", "order", 3).Diff(map[string]any{"status": "paid"}, map[string]any{"status": "cancelled"}),
+	)
+}
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func([]Entry) []Entry
+		checked int
+		broken  int64
+	}{
+		{"untouched", func(entries []Entry) []Entry { return entries }, 3, 0},
+		{"changed action", func(entries []Entry) []Entry {
+			entries[1].Action = "user.delete"
+			return entries
+		}, 1, 2},
+		{"changed actor", func(entries []Entry) []Entry {
+			other := int64(8)
+			entries[1].ActorID = &other
+			return entries
+		}, 1, 2},
+		{"changed changes", func(entries []Entry) []Entry {
+			entries[2].Changes = json.RawMessage(`{"status":{"before":"paid","after":"refunded"}}`)
+			return entries
+		}, 2, 3},
+		{"rehashed after a change", func(entries []Entry) []Entry {
+			entries[0].TargetID = "43"
+			entries[0].Hash = entries[0].hash()
+			return entries
+		}, 1, 2},
+		{"removed entry", func(entries []Entry) []Entry {
+			return append(entries[:1], entries[2])
+		}, 1, 3},
+		{"reordered entries", func(entries []Entry) []Entry {
+			return []Entry{entries[1], entries[0], entries[2]}
+		}, 0, 2},
+		{"removed first entry", func(entries []Entry) []Entry { return entries[1:] }, 0, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checked, broken := verifyChain(test.tamper(sampleChain()), "")
+			if checked != test.checked || broken != test.broken {
+				t.Errorf("verifyChain = %d, %d, want %d, %d", checked, broken, test.checked, test.broken)
+			}
+		})
+	}
+}
+
+func TestHashOmitsUnsetImpersonator(t *testing.T) {
+	entry := chain("", System("user.login", "user", 7).By(7))[0]
+
+	// The content hashed for an action taken without impersonation has no
+	// impersonator_id at all.
+	content := `{"prev_hash":"","actor_id":7,"action":"user.login","target_type":"user","target_id":"7",` +
+		`"changes":null,"request_id":"","ip":"","user_agent":"","created_at":"2026-10-19T12:00:00Z"}`
+	sum := sha256.Sum256([]byte(content))
+	if want := hex.EncodeToString(sum[:]); entry.Hash != want {
+		t.Errorf("hash = %s, want %s", entry.Hash, want)
+	}
+
+	admin := int64(1)
+	entry.ImpersonatorID = &admin
+	if entry.hash() == entry.Hash {
+		t.Error("the impersonator doesn't change the hash")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := map[string]any{"username": "ada", "role": "customer", "password": "$2a$10$old", "key_hash": "abc"}
+	after := map[string]any{"username": "ada", "role": "staff", "password": "$2a$10$new", "secret": "JBSWY3DP", "token": "t"}
+
+	var diff map[string]Change
+	if err := json.Unmarshal(System("user.update", "user", 7).Diff(before, after).Changes, &diff); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Change{"role": {Before: "customer", After: "staff"}}
+	if len(diff) != len(want) || diff["role"] != want["role"] {
+		t.Errorf("changes = %+v, want %+v", diff, want)
+	}
+
+	if changes := System("user.update", "user", 7).Diff(before, before).Changes; changes != nil {
+		t.Errorf("changes without any = %s, want none", changes)
+	}
+	if changes := System("user.update", "user", 7).Diff(nil, "not an object").Changes; changes != nil {
+		t.Errorf("changes of a non-object = %s, want none", changes)
+	}
+}
+
+func TestDiffCreateAndDelete(t *testing.T) {
+	value := map[string]any{"name": "Summer sale", "client_secret": "s3cr3t"}
+
+	for name, entry := range map[string]Entry{
+		"create": System("promotion.create", "promotion", 1).Diff(nil, value),
+		"delete": System("promotion.delete", "promotion", 1).Diff(value, nil),
+	} {
+		var diff map[string]Change
+		if err := json.Unmarshal(entry.Changes, &diff); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := diff["client_secret"]; ok || len(diff) != 1 {
+			t.Errorf("%s changes = %+v, want only name", name, diff)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	before := map[string]any{"email": nil, "phone": "+49 30 1234567", "role": "customer"}
+	after := map[string]any{"email": "ada@example.com", "phone": "+49 30 7654321", "role": "staff"}
+
+	entry := System("user.update", "user", 7).Diff(before, after).Redact("email", "phone", "missing")
+	var diff map[string]Change
+	if err := json.Unmarshal(entry.Changes, &diff); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Change{
+		"email": {Before: nil, After: "[redacted]"},
+		"phone": {Before: "[redacted]", After: "[redacted]"},
+		"role":  {Before: "customer", After: "staff"},
+	}
+	if len(diff) != len(want) {
+		t.Fatalf("changes = %+v, want %+v", diff, want)
+	}
+	for name, change := range want {
+		if diff[name] != change {
+			t.Errorf("%s = %+v, want %+v", name, diff[name], change)
+		}
+	}
+
+	if entry := System("user.update", "user", 7).Redact("email"); entry.Changes != nil {
+		t.Errorf("redacting no changes = %s, want none", entry.Changes)
+	}
+}
+
+// testDB connects to the disposable database in TEST_DATABASE_URL and
+// migrates it, or skips the test without one.
+func testDB(t *testing.T) *bun.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+	migrations.Migrate(db)
+	return db
+}
+
+func TestRecordAndVerify(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		entry := System("test.record", "test", i).Diff(nil, map[string]any{"step": i})
+		if err := Record(ctx, db, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checked, broken, err := Verify(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked < 3 || broken != 0 {
+		t.Fatalf("Verify = %d, %d, want at least 3, 0", checked, broken)
+	}
+
+	last := new(Entry)
+	if err := db.NewSelect().Model(last).Order("id DESC").Limit(1).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if last.PrevHash == "" || last.Hash != last.hash() {
+		t.Errorf("the last entry doesn't chain: %+v", last)
+	}
+
+	// Changing an entry breaks the chain there. It is put back afterwards,
+	// since the log is shared with other tests.
+	setTarget := func(targetID string) {
+		t.Helper()
+		_, err := db.NewUpdate().Model((*Entry)(nil)).Set("target_id = ?", targetID).Where("id = ?", last.ID).Exec(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	setTarget("tampered")
+	t.Cleanup(func() { setTarget(last.TargetID) })
+
+	checked, broken, err = Verify(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broken != last.ID {
+		t.Errorf("Verify after tampering = %d, %d, want entry %d", checked, broken, last.ID)
+	}
+}
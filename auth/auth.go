@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/in43sh/homebuzz-backend/problem"
+)
+
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
+// claimsKey is the gin context key the authenticated claims are stored under.
+const claimsKey = "claims"
+
+var jwtKey = []byte("your_secret_key")
+
+// SessionVersion looks up a user's current session version. Tokens issued
+// for an older version, e.g. before a password reset, are rejected. It is set
+// up in main; when nil, tokens are only checked for signature and expiry.
+var SessionVersion func(ctx context.Context, userID int64) (int, error)
+
+// EmailVerified reports whether a user has confirmed their email address. It
+// is set up in main.
+var EmailVerified func(ctx context.Context, userID int64) (bool, error)
+
+// TokenRevoked reports whether a token issued to a third-party app, looked
+// up by its ID, has been revoked or has expired. It is set up in main.
+var TokenRevoked func(ctx context.Context, tokenID string) (bool, error)
+
+// APIKeyPrefix starts every API key, telling them apart from JWTs.
+const APIKeyPrefix = "hbk_"
+
+// APIKey authenticates an API key and returns the claims of its owner, with
+// APIKeyID and the key's scopes set. It is set up in main; when nil, API keys
+// are rejected.
+var APIKey func(ctx context.Context, key string) (*Claims, error)
+
+type Claims struct {
+	UserID         int64  `json:"user_id"`
+	Username       string `json:"username"`
+	Role           string `json:"role"`
+	SessionVersion int    `json:"session_version"`
+	// Purpose marks tokens that are not access tokens, such as the MFA
+	// challenge handed out between the password and the second factor.
+	Purpose string `json:"purpose,omitempty"`
+	// ClientID and Scope are set on tokens issued to third-party apps.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// APIKeyID is set when the request was authenticated with an API key.
+	APIKeyID int64 `json:"-"`
+	// ImpersonatorID is set on tokens an admin uses to act as the user, for
+	// customer support. The impersonator's session version is checked too,
+	// so signing the admin out ends the impersonation.
+	ImpersonatorID             int64  `json:"impersonator_id,omitempty"`
+	ImpersonatorUsername       string `json:"impersonator_username,omitempty"`
+	ImpersonatorSessionVersion int    `json:"impersonator_session_version,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Limited reports whether the claims only allow their scopes, as for third
+// party apps and API keys.
+func (c *Claims) Limited() bool {
+	return c.ClientID != "" || c.APIKeyID != 0
+}
+
+// Impersonated reports whether an admin is acting as the user.
+func (c *Claims) Impersonated() bool {
+	return c.ImpersonatorID != 0
+}
+
+// purposeMFA is the Purpose of MFA challenge tokens.
+const purposeMFA = "mfa"
+
+// GenerateToken signs a new access token for the given user.
+func GenerateToken(userID int64, username, role string, sessionVersion int, expirationTime time.Time) (string, error) {
+	claims := &Claims{
+		UserID:         userID,
+		Username:       username,
+		Role:           role,
+		SessionVersion: sessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// GenerateClientToken signs an access token issued to a third-party app. The
+// claims must carry the client, the granted scope and a token ID.
+func GenerateClientToken(claims Claims, expirationTime time.Time) (string, error) {
+	claims.Purpose = ""
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	return token.SignedString(jwtKey)
+}
+
+// GenerateImpersonationToken signs an access token that lets an admin act as
+// the user. The claims must carry both the user and the impersonator.
+func GenerateImpersonationToken(claims Claims, expirationTime time.Time) (string, error) {
+	claims.Purpose = ""
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(expirationTime)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	return token.SignedString(jwtKey)
+}
+
+// GenerateMFAToken signs a short-lived challenge token proving the user got
+// past the password step of a login.
+func GenerateMFAToken(userID int64, username string, expirationTime time.Time) (string, error) {
+	claims := &Claims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  purposeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtKey)
+}
+
+// ParseMFAToken validates an MFA challenge token and returns its claims.
+func ParseMFAToken(tokenString string) (*Claims, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purposeMFA {
+		return nil, errors.New("not an MFA token")
+	}
+	return claims, nil
+}
+
+// ParseToken validates a signed token and returns its claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// RequireAuth rejects requests without a valid bearer token or API key. API
+// keys are sent as the bearer token or in the X-API-Key header. Tokens issued
+// to third-party apps and API keys are only accepted when they were granted
+// all of scopes, so routes without scopes are reserved for the first-party
+// app.
+func RequireAuth(scopes ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if key := ctx.GetHeader("X-API-Key"); key != "" {
+			tokenString, found = key, true
+		}
+		if !found || tokenString == "" {
+			problem.Abort(ctx, http.StatusUnauthorized, "Missing authorization token")
+			return
+		}
+
+		var claims *Claims
+		if strings.HasPrefix(tokenString, APIKeyPrefix) {
+			var err error
+			if APIKey != nil {
+				claims, err = APIKey(ctx.Request.Context(), tokenString)
+			}
+			if APIKey == nil || err != nil {
+				problem.AbortWithCode(ctx, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid, expired or revoked API key")
+				return
+			}
+		} else {
+			var err error
+			claims, err = ParseToken(tokenString)
+			if err != nil || claims.Purpose != "" {
+				problem.AbortWithCode(ctx, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired token")
+				return
+			}
+			if SessionVersion != nil {
+				version, err := SessionVersion(ctx.Request.Context(), claims.UserID)
+				if err != nil || version != claims.SessionVersion {
+					problem.AbortWithCode(ctx, http.StatusUnauthorized, problem.CodeInvalidToken, "Session has been revoked")
+					return
+				}
+				if claims.Impersonated() {
+					version, err := SessionVersion(ctx.Request.Context(), claims.ImpersonatorID)
+					if err != nil || version != claims.ImpersonatorSessionVersion {
+						problem.AbortWithCode(ctx, http.StatusUnauthorized, problem.CodeInvalidToken, "Session has been revoked")
+						return
+					}
+				}
+			}
+		}
+
+		if claims.Limited() {
+			if len(scopes) == 0 || !HasScopes(claims.Scope, scopes...) {
+				ctx.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+				problem.AbortWithCode(ctx, http.StatusForbidden, problem.CodeInsufficientScope, "Token lacks the required scope")
+				return
+			}
+		}
+		if claims.ClientID != "" && TokenRevoked != nil {
+			revoked, err := TokenRevoked(ctx.Request.Context(), claims.ID)
+			if err != nil || revoked {
+				problem.AbortWithCode(ctx, http.StatusUnauthorized, problem.CodeInvalidToken, "Invalid or expired token")
+				return
+			}
+		}
+
+		ctx.Set(claimsKey, claims)
+		ctx.Next()
+	}
+}
+
+// RequireRole rejects authenticated requests whose role is not in roles.
+// It must be used after RequireAuth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims := CurrentClaims(ctx)
+		if claims == nil {
+			problem.Abort(ctx, http.StatusUnauthorized, "Missing authorization token")
+			return
+		}
+
+		for _, role := range roles {
+			if claims.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		problem.Abort(ctx, http.StatusForbidden, "Insufficient permissions")
+	}
+}
+
+// ForbidImpersonation rejects requests made while an admin is impersonating
+// the user, for actions support must not take on a customer's behalf, such as
+// changing the password or paying. It must be used after RequireAuth.
+func ForbidImpersonation() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if claims := CurrentClaims(ctx); claims != nil && claims.Impersonated() {
+			problem.AbortWithCode(ctx, http.StatusForbidden, problem.CodeImpersonating, "Not allowed while impersonating a user")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// verifiedActions lists the actions that need a verified email address,
+// configured as a comma-separated REQUIRE_VERIFIED_EMAIL, e.g.
+// "checkout,reviews".
+func verifiedActions() []string {
+	var actions []string
+	for _, action := range strings.Split(os.Getenv("REQUIRE_VERIFIED_EMAIL"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// RequireVerifiedEmail rejects users who have not verified their email
+// address when action is listed in REQUIRE_VERIFIED_EMAIL. It must be used
+// after RequireAuth.
+func RequireVerifiedEmail(action string) gin.HandlerFunc {
+	required := false
+	for _, configured := range verifiedActions() {
+		if configured == action {
+			required = true
+		}
+	}
+
+	return func(ctx *gin.Context) {
+		if !required || EmailVerified == nil {
+			ctx.Next()
+			return
+		}
+
+		claims := CurrentClaims(ctx)
+		if claims == nil {
+			problem.Abort(ctx, http.StatusUnauthorized, "Missing authorization token")
+			return
+		}
+
+		verified, err := EmailVerified(ctx.Request.Context(), claims.UserID)
+		if err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Couldn't check email verification")
+			return
+		}
+		if !verified {
+			problem.AbortWithCode(ctx, http.StatusForbidden, problem.CodeEmailNotVerified, "Please verify your email address first")
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// CurrentClaims returns the claims stored by RequireAuth, or nil.
+func CurrentClaims(ctx *gin.Context) *Claims {
+	value, exists := ctx.Get(claimsKey)
+	if !exists {
+		return nil
+	}
+	claims, _ := value.(*Claims)
+	return claims
+}
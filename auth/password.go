@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed breached_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy describes what a new password must look like.
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	CheckBreached  bool
+	BreachedSource string
+	// BreachedRange, when set, is also asked about passwords missing from
+	// the local list.
+	BreachedRange *BreachedRange
+	// BreachedFailClosed rejects passwords while BreachedRange can't be
+	// reached. Otherwise they are accepted.
+	BreachedFailClosed bool
+}
+
+// PolicyFromEnv reads the password policy from PASSWORD_MIN_LENGTH (default
+// 8), PASSWORD_REQUIRE_UPPER, PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_DIGIT,
+// PASSWORD_REQUIRE_SYMBOL (default false) and PASSWORD_CHECK_BREACHED
+// (default true). BREACHED_PASSWORDS_FILE adds a local breached-password list
+// and BREACHED_PASSWORDS_URL a k-anonymity range service, such as
+// https://api.pwnedpasswords.com/range, which rejects passwords while it is
+// down if PASSWORD_BREACHED_FAIL_CLOSED is true.
+func PolicyFromEnv() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:          8,
+		RequireUpper:       os.Getenv("PASSWORD_REQUIRE_UPPER") == "true",
+		RequireLower:       os.Getenv("PASSWORD_REQUIRE_LOWER") == "true",
+		RequireDigit:       os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol:      os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+		CheckBreached:      os.Getenv("PASSWORD_CHECK_BREACHED") != "false",
+		BreachedSource:     os.Getenv("BREACHED_PASSWORDS_FILE"),
+		BreachedFailClosed: os.Getenv("PASSWORD_BREACHED_FAIL_CLOSED") == "true",
+	}
+	if url := os.Getenv("BREACHED_PASSWORDS_URL"); url != "" {
+		policy.BreachedRange = &BreachedRange{URL: url}
+	}
+	if length, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && length > 0 {
+		policy.MinLength = length
+	}
+	return policy
+}
+
+// Validate returns a description of every rule the password breaks, or nil
+// when it is acceptable.
+func (p PasswordPolicy) Validate(password, username string) []string {
+	var problems []string
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	// bcrypt ignores everything after 72 bytes.
+	if len(password) > 72 {
+		problems = append(problems, "must be at most 72 bytes long")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		problems = append(problems, "must not contain the username")
+	}
+
+	if p.CheckBreached && len(problems) == 0 {
+		breached, err := loadBreached(p.BreachedSource)
+		if err != nil {
+			fmt.Printf("Loading breached passwords failed: %v\n", err)
+		}
+		found := breached.Contains(password)
+		if !found && p.BreachedRange != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), breachedRangeTimeout)
+			found, err = p.BreachedRange.Contains(ctx, password)
+			cancel()
+			if err != nil {
+				fmt.Printf("Checking breached passwords at %s failed: %v\n", p.BreachedRange.URL, err)
+				if p.BreachedFailClosed {
+					problems = append(problems, "could not be checked against breached passwords, try again later")
+				}
+			}
+		}
+		if found {
+			problems = append(problems, "appears in a list of breached passwords, choose another one")
+		}
+	}
+
+	return problems
+}
+
+// BreachedPasswords is a set of SHA-1 password hashes bucketed by the first
+// five hex characters, the layout used by k-anonymity range lookups. Only
+// the bucket of the hash prefix is searched.
+type BreachedPasswords struct {
+	buckets map[string]map[string]struct{}
+}
+
+// Add reads one password or SHA-1 hash per line. Hashes may be followed by
+// ":count" as in published breach corpora; "#" starts a comment.
+func (b *BreachedPasswords) Add(r io.Reader) error {
+	if b.buckets == nil {
+		b.buckets = make(map[string]map[string]struct{})
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash := strings.ToUpper(line)
+		if prefix, _, found := strings.Cut(hash, ":"); found {
+			hash = prefix
+		}
+		if !isSHA1(hash) {
+			hash = sha1Hex(line)
+		}
+
+		bucket := b.buckets[hash[:5]]
+		if bucket == nil {
+			bucket = make(map[string]struct{})
+			b.buckets[hash[:5]] = bucket
+		}
+		bucket[hash[5:]] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// Contains reports whether password is in the set.
+func (b *BreachedPasswords) Contains(password string) bool {
+	hash := sha1Hex(password)
+	_, found := b.buckets[hash[:5]][hash[5:]]
+	return found
+}
+
+// breachedRangeTimeout bounds a lookup in a BreachedRange.
+const breachedRangeTimeout = 5 * time.Second
+
+// BreachedRange looks passwords up in a k-anonymity range service. Only the
+// first five hex characters of a password's SHA-1 hash are sent, to
+// URL/PREFIX, which answers with the remaining characters of every breached
+// hash with that prefix, one "SUFFIX:COUNT" per line.
+type BreachedRange struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Contains reports whether the service knows password as breached.
+func (r *BreachedRange) Contains(ctx context.Context, password string) (bool, error) {
+	hash := sha1Hex(password)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(r.URL, "/")+"/"+hash[:5], nil)
+	if err != nil {
+		return false, err
+	}
+	// Padded responses hide the size of the bucket from eavesdroppers.
+	request.Header.Set("Add-Padding", "true")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breached password service answered %s", response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		suffix, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of 0.
+		if strings.EqualFold(suffix, hash[5:]) && strings.TrimSpace(count) != "0" {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1(value string) bool {
+	if len(value) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+var (
+	breachedOnce sync.Once
+	breached     *BreachedPasswords
+	breachedErr  error
+)
+
+// loadBreached builds the breached-password set once, from the embedded list
+// of common passwords plus the file at source, if any.
+func loadBreached(source string) (*BreachedPasswords, error) {
+	breachedOnce.Do(func() {
+		breached = &BreachedPasswords{}
+		breachedErr = breached.Add(strings.NewReader(commonPasswords))
+		if breachedErr != nil || source == "" {
+			return
+		}
+
+		file, err := os.Open(source)
+		if err != nil {
+			breachedErr = err
+			return
+		}
+		defer file.Close()
+		breachedErr = breached.Add(file)
+	})
+	return breached, breachedErr
+}
+
+// passwordCost is the bcrypt cost of new hashes, configured with
+// BCRYPT_COST.
+func passwordCost() int {
+	cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = 12
+	}
+	return cost
+}
+
+// HashPassword hashes a password with the configured bcrypt cost.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost())
+	return string(hash), err
+}
+
+// NeedsRehash reports whether a stored hash was made with a lower cost than
+// the one configured now.
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < passwordCost()
+}
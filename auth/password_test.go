@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		username string
+		want     []string
+	}{
+		{"long enough", PasswordPolicy{MinLength: 8}, "abcdefgh", "", nil},
+		{"too short", PasswordPolicy{MinLength: 8}, "abcdefg", "", []string{"must be at least 8 characters long"}},
+		{"length counts characters, not bytes", PasswordPolicy{MinLength: 8}, "äöüßäöüß", "", nil},
+		{"over 72 bytes", PasswordPolicy{MinLength: 8}, strings.Repeat("ä", 37), "", []string{"must be at most 72 bytes long"}},
+		{"every class", strict, "Correct-H0rse", "", nil},
+		{"no uppercase", strict, "correct-h0rse", "", []string{"must contain an uppercase letter"}},
+		{"no lowercase", strict, "CORRECT-H0RSE", "", []string{"must contain a lowercase letter"}},
+		{"no digit", strict, "Correct-Horse", "", []string{"must contain a digit"}},
+		{"no symbol", strict, "CorrectH0rse", "", []string{"must contain a symbol"}},
+		{"space counts as a symbol", strict, "Correct H0rse", "", nil},
+		{"non-ASCII letters count", strict, "Äpfel-und-B1rnen", "", nil},
+		{"every rule broken", strict, "abc", "", []string{
+			"must be at least 10 characters long",
+			"must contain an uppercase letter",
+			"must contain a digit",
+			"must contain a symbol",
+		}},
+		{"contains the username", PasswordPolicy{MinLength: 8}, "xxAdaLovelacexx", "adalovelace", []string{"must not contain the username"}},
+		{"no username", PasswordPolicy{MinLength: 8}, "adalovelace", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.policy.Validate(test.password, test.username)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("Validate(%q) = %q, want %q", test.password, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyRejectsCommonPasswords(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, CheckBreached: true}
+
+	if got := policy.Validate("password123", ""); len(got) != 1 || !strings.Contains(got[0], "breached") {
+		t.Errorf("Validate(password123) = %q, want it breached", got)
+	}
+	if got := policy.Validate("uncommon correct horse", ""); got != nil {
+		t.Errorf("Validate of an uncommon password = %q, want none", got)
+	}
+	// Passwords breaking other rules aren't looked up at all.
+	if got := policy.Validate("qwerty", ""); len(got) != 1 || strings.Contains(got[0], "breached") {
+		t.Errorf("Validate(qwerty) = %q, want only the length", got)
+	}
+}
+
+func TestBreachedPasswordsAdd(t *testing.T) {
+	list := strings.Join([]string{
+		"# a comment",
+		"",
+		"hunter2",
+		sha1Hex("correct horse"),
+		strings.ToLower(sha1Hex("battery staple")) + ":42",
+		"  tr0ub4dor  ",
+	}, "\n")
+
+	var breached BreachedPasswords
+	if err := breached.Add(strings.NewReader(list)); err != nil {
+		t.Fatal(err)
+	}
+	for _, password := range []string{"hunter2", "correct horse", "battery staple", "tr0ub4dor"} {
+		if !breached.Contains(password) {
+			t.Errorf("%q is missing", password)
+		}
+	}
+	for _, password := range []string{"# a comment", "hunter3", sha1Hex("correct horse"), ""} {
+		if breached.Contains(password) {
+			t.Errorf("%q is in the set", password)
+		}
+	}
+}
+
+// rangeServer serves the hash suffixes of passwords in the layout of a
+// k-anonymity range service, with padding, and records the prefixes asked for.
+func rangeServer(t *testing.T, passwords ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var prefixes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		prefixes = append(prefixes, prefix)
+		for _, password := range passwords {
+			if hash := sha1Hex(password); hash[:5] == prefix {
+				fmt.Fprintf(w, "%s:%d\r\n", hash[5:], 3)
+			}
+		}
+		fmt.Fprintf(w, "%s:0\r\n", strings.Repeat("0", 35))
+	}))
+	t.Cleanup(server.Close)
+	return server, &prefixes
+}
+
+func TestBreachedRangeContains(t *testing.T) {
+	server, prefixes := rangeServer(t, "hunter2", "correct horse")
+	service := &BreachedRange{URL: server.URL + "/range/", Client: server.Client()}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"hunter2", true},
+		{"correct horse", true},
+		{"hunter3", false},
+	}
+	for _, test := range tests {
+		*prefixes = nil
+		found, err := service.Contains(context.Background(), test.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != test.want {
+			t.Errorf("Contains(%q) = %v, want %v", test.password, found, test.want)
+		}
+		// Only the hash prefix leaves the server.
+		if hash := sha1Hex(test.password); len(*prefixes) != 1 || (*prefixes)[0] != hash[:5] {
+			t.Errorf("asked for %q, want only %q", *prefixes, hash[:5])
+		}
+	}
+}
+
+func TestBreachedRangeIgnoresPadding(t *testing.T) {
+	hash := sha1Hex("hunter2")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("padding wasn't asked for")
+		}
+		fmt.Fprintf(w, "%s:0\n", strings.ToLower(hash[5:]))
+	}))
+	defer server.Close()
+
+	found, err := (&BreachedRange{URL: server.URL}).Contains(context.Background(), "hunter2")
+	if err != nil || found {
+		t.Errorf("Contains of a padding entry = %v, %v, want false", found, err)
+	}
+}
+
+func TestPasswordPolicyBreachedRange(t *testing.T) {
+	server, _ := rangeServer(t, "uncommon correct horse")
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	const password = "uncommon correct horse"
+	tests := []struct {
+		name       string
+		url        string
+		failClosed bool
+		want       string
+	}{
+		{"breached", server.URL + "/range", false, "appears in a list of breached passwords, choose another one"},
+		{"service down, fail open", down.URL, false, ""},
+		{"service down, fail closed", down.URL, true, "could not be checked against breached passwords, try again later"},
+		{"service unreachable, fail closed", "http://127.0.0.1:1", true, "could not be checked against breached passwords, try again later"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := PasswordPolicy{MinLength: 8, CheckBreached: true, BreachedRange: &BreachedRange{URL: test.url}, BreachedFailClosed: test.failClosed}
+			got := policy.Validate(password, "")
+			if strings.Join(got, "") != test.want {
+				t.Errorf("Validate = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	// Passwords on the local list aren't sent anywhere.
+	policy := PasswordPolicy{MinLength: 8, CheckBreached: true, BreachedRange: &BreachedRange{URL: down.URL}, BreachedFailClosed: true}
+	if got := policy.Validate("password123", ""); len(got) != 1 || !strings.Contains(got[0], "appears in a list") {
+		t.Errorf("Validate(password123) = %q, want it breached", got)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Setenv("BCRYPT_COST", "5")
+
+	old, err := bcrypt.GenerateFromPassword([]byte("correct horse"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NeedsRehash(string(old)) {
+		t.Error("a hash below the configured cost doesn't need a rehash")
+	}
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(hash)); cost != 5 {
+		t.Errorf("HashPassword cost = %d, want 5", cost)
+	}
+	if NeedsRehash(hash) {
+		t.Error("a hash of the configured cost needs a rehash")
+	}
+
+	t.Setenv("BCRYPT_COST", "4")
+	if NeedsRehash(hash) {
+		t.Error("a hash above the configured cost needs a rehash")
+	}
+	if NeedsRehash("not a bcrypt hash") {
+		t.Error("an invalid hash needs a rehash")
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a token issued to a third-party app may do on behalf of
+// a user. Tokens from /login carry no scope and are not limited.
+const (
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+	ScopeOrdersRead    = "orders:read"
+	ScopeOrdersWrite   = "orders:write"
+)
+
+// ScopeDescriptions explains every scope on the consent screen.
+var ScopeDescriptions = map[string]string{
+	ScopeProductsRead:  "View product prices and their history",
+	ScopeProductsWrite: "Change product prices and stock",
+	ScopeOrdersRead:    "View your orders",
+	ScopeOrdersWrite:   "Place and pay for orders",
+}
+
+// ParseScope splits a space-separated scope string, dropping duplicates.
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, name := range strings.Fields(scope) {
+		if !slices.Contains(scopes, name) {
+			scopes = append(scopes, name)
+		}
+	}
+	return scopes
+}
+
+// ValidScopes reports whether every scope is known and within allowed.
+func ValidScopes(scopes, allowed []string) bool {
+	for _, scope := range scopes {
+		if _, known := ScopeDescriptions[scope]; !known || !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasScopes reports whether the space-separated granted scope includes all
+// of required.
+func HasScopes(granted string, required ...string) bool {
+	scopes := ParseScope(granted)
+	for _, scope := range required {
+		if !slices.Contains(scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// The RFC's eight digit codes, cut to the six digits used here.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, vector := range vectors {
+		step, ok := ValidateTOTP(rfcSecret, vector.code, time.Unix(vector.unix, 0), 0)
+		if !ok || step != vector.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v, want %d, true", vector.code, vector.unix, step, ok, vector.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	const step = 1234567890 / totpPeriod
+	code, err := totpCode(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(step*totpPeriod, 0)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"start of its period", start, true},
+		{"end of its period", start.Add(totpPeriod*time.Second - time.Second), true},
+		{"one period early", start.Add(-time.Second), true},
+		{"earliest accepted", start.Add(-totpSkew * totpPeriod * time.Second), true},
+		{"too early", start.Add(-totpSkew*totpPeriod*time.Second - time.Second), false},
+		{"one period late", start.Add(totpPeriod * time.Second), true},
+		{"latest accepted", start.Add((totpSkew+1)*totpPeriod*time.Second - time.Second), true},
+		{"too late", start.Add((totpSkew + 1) * totpPeriod * time.Second), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			matched, ok := ValidateTOTP(rfcSecret, code, test.at, 0)
+			if ok != test.want {
+				t.Fatalf("ValidateTOTP at %s = %v, want %v", test.at.Sub(start), ok, test.want)
+			}
+			if ok && matched != step {
+				t.Errorf("matched step %d, want %d", matched, step)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsReplays(t *testing.T) {
+	const step = 1234567890 / totpPeriod
+	now := time.Unix(1234567890, 0)
+
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now, step); ok {
+		t.Error("a code of the last used step was accepted again")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now, step+1); ok {
+		t.Error("a code older than the last used step was accepted")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now, step-1); !ok {
+		t.Error("a code newer than the last used step was rejected")
+	}
+
+	// A code of the next period still works after one of this period.
+	next, err := totpCode(rfcSecret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matched, ok := ValidateTOTP(rfcSecret, next, now, step); !ok || matched != step+1 {
+		t.Errorf("ValidateTOTP of the next period = %d, %v, want %d, true", matched, ok, step+1)
+	}
+}
+
+func TestValidateTOTPInput(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   bool
+	}{
+		{"spaces", rfcSecret, " 005 924 ", true},
+		{"lowercase secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", "005924", true},
+		{"leading zeros dropped", rfcSecret, "5924", false},
+		{"eight digits", rfcSecret, "89005924", false},
+		{"wrong code", rfcSecret, "005925", false},
+		{"empty", rfcSecret, "", false},
+		{"invalid secret", "not base32!", "005924", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, ok := ValidateTOTP(test.secret, test.code, now, 0); ok != test.want {
+				t.Errorf("ValidateTOTP(%q, %q) = %v, want %v", test.secret, test.code, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == other {
+		t.Error("two secrets are the same")
+	}
+
+	now := time.Now()
+	code, err := totpCode(secret, now.Unix()/totpPeriod)
+	if err != nil {
+		t.Fatalf("the secret can't be decoded: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, now, 0); !ok {
+		t.Error("the current code of a new secret was rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("HomeBuzz", "ada@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/HomeBuzz:ada@example.com" {
+		t.Errorf("URI = %s", uri)
+	}
+	want := map[string]string{"secret": rfcSecret, "issuer": "HomeBuzz", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for name, value := range want {
+		if got := uri.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -67,3 +68,10 @@ func ConnectDatabase() {
 
 	fmt.Println("Successfully connected to the database with Bun!")
 }
+
+// IsUniqueViolation reports whether err is Postgres rejecting a duplicate
+// value of a unique column.
+func IsUniqueViolation(err error) bool {
+	var pgErr pgdriver.Error
+	return errors.As(err, &pgErr) && pgErr.Field('C') == "23505"
+}
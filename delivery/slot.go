@@ -0,0 +1,248 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ReservationHeld      = "held"
+	ReservationConfirmed = "confirmed"
+	ReservationReleased  = "released"
+)
+
+var (
+	ErrSlotFull        = errors.New("delivery slot is full or no longer bookable")
+	ErrReservationGone = errors.New("slot reservation not found or expired")
+)
+
+// Slot is a delivery window in a zone that can take Capacity orders.
+type Slot struct {
+	bun.BaseModel `bun:"table:delivery_slots,alias:slot" swaggerignore:"true"`
+
+	ID         int64     `bun:",pk,autoincrement" json:"id"`
+	ZoneID     int64     `bun:"zone_id,notnull" json:"zone_id" binding:"required" example:"1"`
+	StartsAt   time.Time `bun:"starts_at,notnull" json:"starts_at" binding:"required" example:"2026-10-20T08:00:00Z"`
+	EndsAt     time.Time `bun:"ends_at,notnull" json:"ends_at" binding:"required" example:"2026-10-20T10:00:00Z"`
+	Capacity   int       `bun:"capacity,notnull" json:"capacity" binding:"required,gte=1" example:"20"`
+	Reserved   int       `bun:"reserved,notnull,default:0" json:"reserved"`
+	TemplateID *int64    `bun:"template_id" json:"template_id,omitempty"`
+}
+
+// SlotTemplate generates a slot every week on Weekday (0 = Sunday) between
+// StartTime and EndTime, local to the server, formatted as "15:04".
+type SlotTemplate struct {
+	bun.BaseModel `bun:"table:delivery_slot_templates,alias:template" swaggerignore:"true"`
+
+	ID        int64  `bun:",pk,autoincrement" json:"id"`
+	ZoneID    int64  `bun:"zone_id,notnull" json:"zone_id" binding:"required" example:"1"`
+	Weekday   int    `bun:"weekday,notnull" json:"weekday" binding:"gte=0,lte=6" example:"1"`
+	StartTime string `bun:"start_time,notnull" json:"start_time" binding:"required" example:"08:00"`
+	EndTime   string `bun:"end_time,notnull" json:"end_time" binding:"required" example:"10:00"`
+	Capacity  int    `bun:"capacity,notnull" json:"capacity" binding:"required,gte=1" example:"20"`
+	Active    bool   `bun:"active,notnull,default:true" json:"active"`
+}
+
+// SlotReservation holds one unit of a slot's capacity for a user until
+// ExpiresAt, or permanently once the order is paid.
+type SlotReservation struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	SlotID    int64     `bun:"slot_id,notnull" json:"slot_id"`
+	UserID    int64     `bun:"user_id,notnull" json:"user_id"`
+	OrderID   *int64    `bun:"order_id" json:"order_id,omitempty"`
+	Status    string    `bun:"status,notnull" json:"status" example:"held"`
+	ExpiresAt time.Time `bun:"expires_at,notnull" json:"expires_at"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Window parses the template's times into a slot window on day.
+func (t *SlotTemplate) Window(day time.Time) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("15:04", t.StartTime, day.Location())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start_time: %w", err)
+	}
+	end, err := time.ParseInLocation("15:04", t.EndTime, day.Location())
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end_time: %w", err)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("end_time must be after start_time")
+	}
+
+	date := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	startsAt := date.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+	endsAt := date.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+	return startsAt, endsAt, nil
+}
+
+// Reserve takes one unit of the slot's capacity for userID until expiresAt.
+// The capacity check and increment happen in a single UPDATE, so concurrent
+// reservations can never overbook a slot.
+func Reserve(ctx context.Context, tx bun.Tx, slotID, userID int64, expiresAt time.Time) (*SlotReservation, error) {
+	result, err := tx.NewUpdate().
+		Model((*Slot)(nil)).
+		Set("reserved = reserved + 1").
+		Where("id = ?", slotID).
+		Where("reserved < capacity").
+		Where("starts_at > ?", time.Now()).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, ErrSlotFull
+	}
+
+	reservation := &SlotReservation{
+		SlotID:    slotID,
+		UserID:    userID,
+		Status:    ReservationHeld,
+		ExpiresAt: expiresAt,
+	}
+	if _, err := tx.NewInsert().Model(reservation).Returning("*").Exec(ctx); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// Release gives a held reservation's capacity back to its slot.
+func Release(ctx context.Context, tx bun.Tx, reservation *SlotReservation) error {
+	result, err := tx.NewUpdate().
+		Model((*SlotReservation)(nil)).
+		Set("status = ?", ReservationReleased).
+		Where("id = ?", reservation.ID).
+		Where("status = ?", ReservationHeld).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*Slot)(nil)).
+		Set("reserved = reserved - 1").
+		Where("id = ?", reservation.SlotID).
+		Exec(ctx)
+	return err
+}
+
+// ActiveHold returns one of the user's unexpired held reservations that no
+// order has claimed yet.
+func ActiveHold(ctx context.Context, tx bun.Tx, reservationID, userID int64) (*SlotReservation, error) {
+	reservation := new(SlotReservation)
+	err := tx.NewSelect().
+		Model(reservation).
+		Where("id = ?", reservationID).
+		Where("user_id = ?", userID).
+		Where("status = ?", ReservationHeld).
+		Where("order_id IS NULL").
+		Where("expires_at > ?", time.Now()).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReservationGone
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// Claim attaches an unclaimed hold to an order and keeps it until the given
+// time. The check and the update happen in a single UPDATE, so one hold can
+// never back two orders.
+func Claim(ctx context.Context, tx bun.Tx, reservationID, orderID int64, until *time.Time) error {
+	result, err := tx.NewUpdate().
+		Model((*SlotReservation)(nil)).
+		Set("order_id = ?", orderID).
+		Set("expires_at = ?", until).
+		Where("id = ?", reservationID).
+		Where("status = ?", ReservationHeld).
+		Where("order_id IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrReservationGone
+	}
+	return nil
+}
+
+// ReleaseExpiredHolds frees the capacity of every hold past its expiry. It is
+// run periodically by the scheduler.
+func ReleaseExpiredHolds(db *bun.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			var expired []SlotReservation
+			err := tx.NewSelect().
+				Model(&expired).
+				Where("status = ?", ReservationHeld).
+				Where("expires_at <= ?", time.Now()).
+				For("UPDATE SKIP LOCKED").
+				Scan(ctx)
+			if err != nil {
+				return err
+			}
+
+			for i := range expired {
+				if err := Release(ctx, tx, &expired[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// GenerateSlots creates the slots of every active template for the next days,
+// skipping slots that already exist. It is run periodically by the scheduler.
+func GenerateSlots(db *bun.DB, days int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var templates []SlotTemplate
+		err := db.NewSelect().
+			Model(&templates).
+			Where("active = TRUE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		today := time.Now()
+		for day := 0; day < days; day++ {
+			date := today.AddDate(0, 0, day)
+			for i := range templates {
+				template := &templates[i]
+				if int(date.Weekday()) != template.Weekday {
+					continue
+				}
+				startsAt, endsAt, err := template.Window(date)
+				if err != nil || !startsAt.After(today) {
+					continue
+				}
+
+				_, err = db.NewInsert().
+					Model(&Slot{
+						ZoneID:     template.ZoneID,
+						StartsAt:   startsAt,
+						EndsAt:     endsAt,
+						Capacity:   template.Capacity,
+						TemplateID: &template.ID,
+					}).
+					On("CONFLICT (zone_id, starts_at) DO NOTHING").
+					Exec(ctx)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
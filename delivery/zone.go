@@ -0,0 +1,192 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+var ErrNotDeliverable = errors.New("address is outside every delivery zone")
+
+// Geometry is a GeoJSON Polygon or MultiPolygon in [longitude, latitude] order.
+type Geometry struct {
+	Type        string          `json:"type" example:"Polygon"`
+	Coordinates json.RawMessage `json:"coordinates" swaggertype:"array,number"`
+}
+
+// Zone is an area Homebuzz delivers to. An address is inside the zone when
+// its postal code is listed in PostalCodes (a trailing "*" matches a prefix)
+// or its coordinates fall inside Polygon.
+type Zone struct {
+	bun.BaseModel `bun:"table:delivery_zones,alias:zone" swaggerignore:"true"`
+
+	ID          int64     `bun:",pk,autoincrement" json:"id"`
+	StoreID     int64     `bun:"store_id,notnull" json:"-"`
+	Name        string    `bun:"name,notnull" json:"name" binding:"required" example:"Berlin Mitte"`
+	Country     string    `bun:"country,notnull" json:"country" binding:"required,len=2" example:"DE"`
+	PostalCodes []string  `bun:"postal_codes,array" json:"postal_codes" example:"10115,10117,101*"`
+	Polygon     *Geometry `bun:"polygon,type:jsonb" json:"polygon,omitempty"`
+	Fee         float64   `bun:"fee,notnull,default:0" json:"fee" binding:"gte=0" example:"3.99"`
+	MinOrder    float64   `bun:"min_order,notnull,default:0" json:"min_order" binding:"gte=0" example:"25"`
+	Active      bool      `bun:"active,notnull,default:true" json:"active"`
+}
+
+// Location is the part of an address used to find its zone.
+type Location struct {
+	Country    string
+	PostalCode string
+	Latitude   *float64
+	Longitude  *float64
+}
+
+// NormalizePostalCode uppercases a postal code and strips spaces and dashes.
+func NormalizePostalCode(code string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// Contains reports whether location lies inside the zone.
+func (z *Zone) Contains(location Location) bool {
+	if !z.Active || !strings.EqualFold(z.Country, location.Country) {
+		return false
+	}
+
+	postalCode := NormalizePostalCode(location.PostalCode)
+	for _, code := range z.PostalCodes {
+		code = NormalizePostalCode(code)
+		if prefix, wildcard := strings.CutSuffix(code, "*"); wildcard {
+			if strings.HasPrefix(postalCode, prefix) {
+				return true
+			}
+		} else if code == postalCode {
+			return true
+		}
+	}
+
+	if z.Polygon != nil && location.Latitude != nil && location.Longitude != nil {
+		return z.Polygon.Contains(*location.Longitude, *location.Latitude)
+	}
+	return false
+}
+
+// Validate checks that the geometry is a well-formed Polygon or MultiPolygon.
+func (g *Geometry) Validate() error {
+	_, err := g.polygons()
+	return err
+}
+
+// Contains reports whether the point lies inside the geometry, honouring holes.
+// Points on an edge, of the outline or of a hole, are inside.
+func (g *Geometry) Contains(lng, lat float64) bool {
+	polygons, err := g.polygons()
+	if err != nil {
+		return false
+	}
+
+	for _, polygon := range polygons {
+		if len(polygon) == 0 || !(ringContains(polygon[0], lng, lat) || onRing(polygon[0], lng, lat)) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, lng, lat) && !onRing(hole, lng, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Geometry) polygons() ([][][][]float64, error) {
+	var polygons [][][][]float64
+	switch g.Type {
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &polygon); err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, polygon)
+	case "MultiPolygon":
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("geometry must be a Polygon or MultiPolygon")
+	}
+
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			return nil, errors.New("polygon has no rings")
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 {
+				return nil, errors.New("polygon rings need at least four positions")
+			}
+			for _, position := range ring {
+				if len(position) < 2 {
+					return nil, errors.New("positions need a longitude and a latitude")
+				}
+			}
+		}
+	}
+	return polygons, nil
+}
+
+// ringContains is the even-odd ray casting test.
+func ringContains(ring [][]float64, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// onRing reports whether the point lies on one of the ring's edges, where the
+// ray casting test is left to chance.
+func onRing(ring [][]float64, x, y float64) bool {
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		cross := (xj-xi)*(y-yi) - (yj-yi)*(x-xi)
+		if math.Abs(cross) <= 1e-12 &&
+			x >= math.Min(xi, xj) && x <= math.Max(xi, xj) &&
+			y >= math.Min(yi, yj) && y <= math.Max(yi, yj) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindZone returns the store's first active zone, by ID, that contains
+// location.
+func FindZone(ctx context.Context, db bun.IDB, storeID int64, location Location) (*Zone, error) {
+	var zones []Zone
+	err := db.NewSelect().
+		Model(&zones).
+		Where("store_id = ?", storeID).
+		Where("active = TRUE").
+		Where("country = ?", strings.ToUpper(location.Country)).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range zones {
+		if zones[i].Contains(location) {
+			return &zones[i], nil
+		}
+	}
+	return nil, ErrNotDeliverable
+}
@@ -0,0 +1,131 @@
+package delivery
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func geometry(t *testing.T, kind string, coordinates any) *Geometry {
+	t.Helper()
+
+	raw, err := json.Marshal(coordinates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Geometry{Type: kind, Coordinates: raw}
+}
+
+func point(f float64) *float64 {
+	return &f
+}
+
+// square spans 0 to 10 in both directions with a hole from 4 to 6.
+var square = [][][]float64{
+	{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+	{{4, 4}, {6, 4}, {6, 6}, {4, 6}, {4, 4}},
+}
+
+func TestGeometryContains(t *testing.T) {
+	// diamond has its left and right corners on the latitude of the tested
+	// points, where a ray cast through a corner can count it twice.
+	diamond := [][][]float64{{{5, 0}, {10, 5}, {5, 10}, {0, 5}, {5, 0}}}
+	// u opens to the north between 3 and 7.
+	u := [][][]float64{{{0, 0}, {10, 0}, {10, 10}, {7, 10}, {7, 3}, {3, 3}, {3, 10}, {0, 10}, {0, 0}}}
+
+	tests := []struct {
+		name     string
+		geometry *Geometry
+		lng, lat float64
+		want     bool
+	}{
+		{"inside", geometry(t, "Polygon", square), 2, 2, true},
+		{"outside", geometry(t, "Polygon", square), 12, 2, false},
+		{"west edge", geometry(t, "Polygon", square), 0, 5, true},
+		{"east edge", geometry(t, "Polygon", square), 10, 5, true},
+		{"south edge", geometry(t, "Polygon", square), 5, 0, true},
+		{"north edge", geometry(t, "Polygon", square), 2, 10, true},
+		{"corner", geometry(t, "Polygon", square), 10, 10, true},
+		{"in the hole", geometry(t, "Polygon", square), 5, 5, false},
+		{"on the hole's edge", geometry(t, "Polygon", square), 4, 5, true},
+		{"on the line of an edge, past it", geometry(t, "Polygon", square), 5, 10.000001, false},
+		{"level with a corner, inside", geometry(t, "Polygon", diamond), 5, 5, true},
+		{"level with a corner, outside", geometry(t, "Polygon", diamond), -1, 5, false},
+		{"level with a corner, beyond it", geometry(t, "Polygon", diamond), 11, 5, false},
+		{"in the notch of a concave ring", geometry(t, "Polygon", u), 5, 8, false},
+		{"beside the notch", geometry(t, "Polygon", u), 8, 8, true},
+		{"below the notch", geometry(t, "Polygon", u), 5, 2, true},
+		{"second polygon of a multipolygon", geometry(t, "MultiPolygon", [][][][]float64{square, {{{20, 20}, {30, 20}, {30, 30}, {20, 20}}}}), 29, 25, true},
+		{"between multipolygon parts", geometry(t, "MultiPolygon", [][][][]float64{square, {{{20, 20}, {30, 20}, {30, 30}, {20, 20}}}}), 15, 15, false},
+		{"unknown geometry type", geometry(t, "Point", []float64{5, 5}), 5, 5, false},
+		{"ring too short", geometry(t, "Polygon", [][][]float64{{{0, 0}, {10, 0}, {0, 0}}}), 1, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.geometry.Contains(test.lng, test.lat); got != test.want {
+				t.Errorf("Contains(%v, %v) = %v, want %v", test.lng, test.lat, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGeometryValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		geometry *Geometry
+		valid    bool
+	}{
+		{"polygon", geometry(t, "Polygon", square), true},
+		{"multipolygon", geometry(t, "MultiPolygon", [][][][]float64{square}), true},
+		{"point", geometry(t, "Point", []float64{1, 2}), false},
+		{"no rings", geometry(t, "Polygon", [][][]float64{}), false},
+		{"short ring", geometry(t, "Polygon", [][][]float64{{{0, 0}, {1, 0}, {0, 0}}}), false},
+		{"position without latitude", geometry(t, "Polygon", [][][]float64{{{0, 0}, {1}, {1, 1}, {0, 0}}}), false},
+		{"not coordinates", &Geometry{Type: "Polygon", Coordinates: json.RawMessage(`"berlin"`)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.geometry.Validate(); (err == nil) != test.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestZoneContains(t *testing.T) {
+	zone := &Zone{
+		Country:     "DE",
+		PostalCodes: []string{"10115", "101*", "ab1 2cd"},
+		Polygon:     geometry(t, "Polygon", square),
+		Active:      true,
+	}
+
+	tests := []struct {
+		name     string
+		location Location
+		want     bool
+	}{
+		{"listed postal code", Location{Country: "DE", PostalCode: "10115"}, true},
+		{"postal code prefix", Location{Country: "DE", PostalCode: "10178"}, true},
+		{"postal code spelled differently", Location{Country: "de", PostalCode: " AB1-2CD "}, true},
+		{"other postal code", Location{Country: "DE", PostalCode: "20095"}, false},
+		{"other country", Location{Country: "AT", PostalCode: "10115"}, false},
+		{"inside the polygon", Location{Country: "DE", PostalCode: "20095", Longitude: point(2), Latitude: point(3)}, true},
+		{"latitude and longitude swapped", Location{Country: "DE", PostalCode: "20095", Longitude: point(12), Latitude: point(3)}, false},
+		{"only a latitude", Location{Country: "DE", PostalCode: "20095", Latitude: point(3)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := zone.Contains(test.location); got != test.want {
+				t.Errorf("Contains(%+v) = %v, want %v", test.location, got, test.want)
+			}
+		})
+	}
+
+	zone.Active = false
+	if zone.Contains(Location{Country: "DE", PostalCode: "10115"}) {
+		t.Error("an inactive zone contains a listed postal code")
+	}
+}
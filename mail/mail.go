@@ -0,0 +1,142 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. SMTPMailer sends them for real; FileMailer and
+// LogMailer keep them local for development.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// Render builds a message from the named template in templates/. Every
+// template defines a "subject" and a "body" block.
+func Render(to, name string, data any) (Message, error) {
+	tmpl, err := template.ParseFS(templates, "templates/"+name+".tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: strings.TrimSpace(subject.String()), Body: strings.TrimSpace(body.String()) + "\n"}, nil
+}
+
+// format renders the message as an RFC 5322 email.
+func format(from string, message Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", message.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// SMTPMailer sends email through an SMTP server. Username may be left empty
+// for servers without authentication, such as a local SMTP stand-in.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m SMTPMailer) Send(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	// The envelope takes the bare address, without the display name.
+	sender, err := netmail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, auth, sender.Address, []string{message.To}, format(m.From, message))
+}
+
+// FileMailer writes every email to a .eml file in Dir.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m FileMailer) Send(ctx context.Context, message Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.NewReplacer("@", "_at_", "/", "_").Replace(message.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, message), 0o600)
+}
+
+// LogMailer prints every email to standard output.
+type LogMailer struct {
+	From string
+}
+
+func (m LogMailer) Send(ctx context.Context, message Message) error {
+	fmt.Printf("Email:\n%s\n", format(m.From, message))
+	return nil
+}
+
+// FromEnv picks a mailer with MAIL_DRIVER: "smtp" (SMTP_ADDR, SMTP_USERNAME,
+// SMTP_PASSWORD), "file" (MAIL_DIR) or "log", the default. MAIL_FROM sets the
+// sender.
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "HomeBuzz <no-reply@homebuzz.local>"
+	}
+
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		addr := os.Getenv("SMTP_ADDR")
+		if addr == "" {
+			addr = "localhost:1025"
+		}
+		return SMTPMailer{
+			Addr:     addr,
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail-outbox"
+		}
+		return FileMailer{Dir: dir, From: from}
+	default:
+		return LogMailer{From: from}
+	}
+}
@@ -0,0 +1,183 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	netmail "net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// envelope is an email as received by smtpServer.
+type envelope struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// smtpServer accepts one SMTP session on a local port, just far enough for
+// net/smtp to deliver a message without authentication or TLS.
+func smtpServer(t *testing.T) (string, <-chan envelope) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan envelope, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		var mail envelope
+		reply := func(format string, args ...any) bool {
+			return text.PrintfLine(format, args...) == nil
+		}
+		if !reply("220 localhost ESMTP") {
+			return
+		}
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				mail.From = address(arg, "FROM:")
+				reply("250 OK")
+			case "RCPT":
+				mail.To = append(mail.To, address(arg, "TO:"))
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				mail.Data, err = text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- mail
+				reply("250 OK")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+// address takes the address out of a MAIL FROM or RCPT TO argument.
+func address(arg, prefix string) string {
+	arg = strings.TrimPrefix(arg, prefix)
+	return strings.TrimSuffix(strings.TrimPrefix(arg, "<"), ">")
+}
+
+func TestSMTPMailerSendsTemplates(t *testing.T) {
+	tests := []struct {
+		template string
+		data     map[string]any
+		subject  string
+		body     []string
+	}{
+		{
+			template: "email_verification",
+			data:     map[string]any{"Username": "ada", "Email": "ada@example.com", "ExpiresIn": "24 hours", "Link": "https://homebuzz.local/verify?token=abc"},
+			subject:  "Confirm your HomeBuzz email address",
+			body:     []string{"Hi ada,", "Please confirm that ada@example.com is your email address", "It expires in 24 hours.", "https://homebuzz.local/verify?token=abc"},
+		},
+		{
+			template: "password_reset",
+			data:     map[string]any{"Username": "ada", "ExpiresIn": "1 hour", "Link": "https://homebuzz.local/reset?token=abc"},
+			subject:  "Reset your HomeBuzz password",
+			body:     []string{"Hi ada,", "It expires in 1 hour", "https://homebuzz.local/reset?token=abc", "Your password won't\nchange."},
+		},
+		{
+			template: "password_changed",
+			data:     map[string]any{"Username": "ada"},
+			subject:  "Your HomeBuzz password was changed",
+			body:     []string{"Hi ada,", "The password of your HomeBuzz account was just changed"},
+		},
+		{
+			template: "email_changed",
+			data:     map[string]any{"Username": "ada", "Email": "lovelace@example.com"},
+			subject:  "Your HomeBuzz email address was changed",
+			body:     []string{"Hi ada,", "was just changed to lovelace@example.com."},
+		},
+		{
+			template: "account_deletion",
+			data:     map[string]any{"Username": "ada", "DeleteAt": "1 December 2026"},
+			subject:  "Your HomeBuzz account will be deleted",
+			body:     []string{"Hi ada,", "will be deleted on 1 December 2026", "sign in again before then"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			addr, received := smtpServer(t)
+			mailer := SMTPMailer{Addr: addr, From: "HomeBuzz <no-reply@homebuzz.local>"}
+
+			message, err := Render("ada@example.com", test.template, test.data)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if err := mailer.Send(context.Background(), message); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			mail := <-received
+			if mail.From != "no-reply@homebuzz.local" {
+				t.Errorf("MAIL FROM = %q, want no-reply@homebuzz.local", mail.From)
+			}
+			if len(mail.To) != 1 || mail.To[0] != "ada@example.com" {
+				t.Errorf("RCPT TO = %q, want [ada@example.com]", mail.To)
+			}
+
+			parsed, err := netmail.ReadMessage(bufio.NewReader(bytes.NewReader(mail.Data)))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			headers := map[string]string{
+				"From":         "HomeBuzz <no-reply@homebuzz.local>",
+				"To":           "ada@example.com",
+				"Subject":      test.subject,
+				"Mime-Version": "1.0",
+				"Content-Type": "text/plain; charset=UTF-8",
+			}
+			for name, want := range headers {
+				if got := parsed.Header.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if _, err := parsed.Header.Date(); err != nil {
+				t.Errorf("Date: %v", err)
+			}
+
+			body, err := io.ReadAll(parsed.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.body {
+				if !strings.Contains(string(body), want) {
+					t.Errorf("body is missing %q:\n%s", want, body)
+				}
+			}
+			if strings.Contains(string(body), "<no value>") {
+				t.Errorf("body has unset fields:\n%s", body)
+			}
+		})
+	}
+}
@@ -1,17 +1,46 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
 	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/delivery"
 	_ "github.com/in43sh/homebuzz-backend/docs"
+	"github.com/in43sh/homebuzz-backend/mail"
+	"github.com/in43sh/homebuzz-backend/migrations"
+	"github.com/in43sh/homebuzz-backend/oidc"
+	"github.com/in43sh/homebuzz-backend/payment"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/requestid"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	auditRoutes "github.com/in43sh/homebuzz-backend/routes/audit"
+	cartRoutes "github.com/in43sh/homebuzz-backend/routes/cart"
+	deliveryRoutes "github.com/in43sh/homebuzz-backend/routes/delivery"
+	notificationRoutes "github.com/in43sh/homebuzz-backend/routes/notification"
+	orderRoutes "github.com/in43sh/homebuzz-backend/routes/order"
 	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	promotionRoutes "github.com/in43sh/homebuzz-backend/routes/promotion"
+	storeRoutes "github.com/in43sh/homebuzz-backend/routes/store"
+	subscriptionRoutes "github.com/in43sh/homebuzz-backend/routes/subscription"
+	taxRoutes "github.com/in43sh/homebuzz-backend/routes/tax"
 	userRoutes "github.com/in43sh/homebuzz-backend/routes/user"
+	wishlistRoutes "github.com/in43sh/homebuzz-backend/routes/wishlist"
+	"github.com/in43sh/homebuzz-backend/scheduler"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/tax"
+	"github.com/in43sh/homebuzz-backend/timeout"
 	swaggerFiles "github.com/swaggo/files" // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -19,28 +48,88 @@ import (
 // @title Your API
 // @version 1.0
 // @description This is a sample server for managing authentication.
+// @description Errors are returned as application/problem+json (RFC 7807) with a stable machine-readable code, the invalid fields of the request, if any, and the request ID.
+// @description Every route has a deadline. Requests that run past it get a 504 with the timeout code, and requests cancelled before they finish, as when the server shuts down, a 503 with the service_unavailable code.
 // @host localhost:8080
 // @BasePath /
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Type "Bearer" followed by a space and the JWT returned by /login.
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description An API key from /api-keys, for routes that accept its scopes.
+
 func main() {
-	route := gin.Default()
+	// Background jobs stop, and the server drains, on SIGINT or SIGTERM.
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+
+	deadlines := timeout.ConfigFromEnv()
+	route := gin.New()
+	route.Use(requestid.Middleware())
+	route.Use(gin.Logger(), gin.CustomRecovery(func(ctx *gin.Context, _ any) {
+		problem.Abort(ctx, http.StatusInternalServerError, "Internal server error")
+	}))
+	route.Use(timeout.Middleware(deadlines))
+
+	if err := route.SetTrustedProxies(userRoutes.TrustedProxies()); err != nil {
+		panic(err)
+	}
+
+	database.ConnectDatabase()
+	migrations.Migrate(database.BunDB)
 
-	allowOrigins := []string{"http://localhost:3000"}
-	if os.Getenv("GIN_MODE") == "release" {
-		allowOrigins = []string{"https://homebuzz-backend.onrender.com", "https://homebuzz.netlify.app"}
+	// Each store lists its allowed origins. The local frontend is allowed
+	// everywhere outside of release mode. Requests for unknown stores are
+	// only rejected after CORS, so browsers can read why.
+	devOrigin := ""
+	if os.Getenv("GIN_MODE") != "release" {
+		devOrigin = "http://localhost:3000"
 	}
-	fmt.Printf("allowOrigins: %s\n", allowOrigins)
 
+	route.Use(store.Resolve(database.BunDB))
 	route.Use(cors.New(cors.Config{
-		AllowOrigins:     allowOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowOriginWithContextFunc: func(ctx *gin.Context, origin string) bool {
+			return (devOrigin != "" && origin == devOrigin) || store.AllowOrigin(ctx, origin)
+		},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", store.Header, requestid.Header},
+		ExposeHeaders:    []string{"Content-Length", requestid.Header},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
+	route.Use(store.Require())
+	route.Use(audit.LogImpersonation(database.BunDB))
 
-	database.ConnectDatabase()
+	orderRoutes.TaxCalculator = tax.NewDBCalculator(database.BunDB, tax.ConfigFromEnv())
+	orderRoutes.PaymentGateway = payment.ManualGateway{}
+	userRoutes.Mailer = mail.FromEnv()
+	userRoutes.PasswordPolicy = auth.PolicyFromEnv()
+	userRoutes.Providers = oidc.ProvidersFromEnv()
+	auth.SessionVersion = userRoutes.SessionVersion
+	auth.EmailVerified = userRoutes.EmailVerified
+	auth.TokenRevoked = userRoutes.OAuthTokenRevoked
+	auth.APIKey = userRoutes.AuthenticateAPIKey
+
+	// Background jobs
+	scheduler.Every(stop, "scheduled prices", time.Minute, productRoutes.ApplyScheduledPrices)
+	scheduler.Every(stop, "delivery slot generation", time.Hour, delivery.GenerateSlots(database.BunDB, deliveryRoutes.SlotDays))
+	scheduler.Every(stop, "expired slot holds", time.Minute, delivery.ReleaseExpiredHolds(database.BunDB))
+	scheduler.Every(stop, "unpaid orders", time.Minute, orderRoutes.ExpireUnpaidOrders)
+	scheduler.Every(stop, "subscriptions", time.Minute, subscriptionRoutes.ProcessSubscriptions)
+	scheduler.Every(stop, "login throttles", time.Hour, userRoutes.PurgeLoginThrottles)
+	scheduler.Every(stop, "oidc logins", time.Hour, userRoutes.PurgeOIDCLogins)
+	scheduler.Every(stop, "oauth grants", time.Hour, userRoutes.PurgeOAuthGrants)
+	scheduler.Every(stop, "deleted accounts", time.Hour, userRoutes.PurgeDeletedAccounts)
+	scheduler.Every(stop, "deleted products", time.Hour, productRoutes.PurgeDeletedProducts)
+
+	route.NoRoute(func(ctx *gin.Context) {
+		problem.Abort(ctx, http.StatusNotFound, "Route not found")
+	})
 
 	route.GET("/ping", func(context *gin.Context) {
 		context.JSON(http.StatusOK, gin.H{
@@ -54,24 +143,217 @@ func main() {
 	// User routes
 	route.POST("/register", userRoutes.Register)
 	route.POST("/login", userRoutes.Login)
-	route.GET("/users", userRoutes.GetUsers)
-	route.GET("/users/:id", userRoutes.GetUser)
-	route.DELETE("/users/:id", userRoutes.DeleteUser)
+	route.POST("/login/mfa", userRoutes.LoginMFA)
+	route.POST("/password/forgot", userRoutes.ForgotPassword)
+	route.POST("/password/reset", userRoutes.ResetPassword)
+	route.POST("/email/verify", userRoutes.VerifyEmail)
+	route.GET("/auth/providers", userRoutes.GetProviders)
+	route.GET("/auth/:provider/login", userRoutes.LoginWithProvider)
+	route.GET("/auth/:provider/callback", userRoutes.ProviderCallback)
+	route.POST("/auth/:provider/callback", userRoutes.ProviderCallback)
 
 	// Product routes
-	route.POST("/products", productRoutes.AddProduct)
 	route.GET("/products", productRoutes.GetProducts)
-	route.DELETE("/products/:id", productRoutes.DeleteProduct)
+
+	authorized := route.Group("/", auth.RequireAuth())
+	admin := route.Group("/", auth.RequireAuth(), auth.RequireRole(auth.RoleAdmin))
+	// Admins impersonating a user can't use these routes.
+	sensitive := route.Group("/", auth.RequireAuth(), auth.ForbidImpersonation())
+
+	// Staff of the current store, and platform admins.
+	storeStaff := route.Group("/", auth.RequireAuth(), store.RequireRole(database.BunDB, store.RoleStaff, store.RoleAdmin))
+	storeAdmin := route.Group("/", auth.RequireAuth(), store.RequireRole(database.BunDB, store.RoleAdmin))
+
+	// Third-party apps may call these routes with a token granted the scope.
+	productsRead := route.Group("/", auth.RequireAuth(auth.ScopeProductsRead), store.RequireRole(database.BunDB, store.RoleStaff, store.RoleAdmin))
+	productsWrite := route.Group("/", auth.RequireAuth(auth.ScopeProductsWrite), store.RequireRole(database.BunDB, store.RoleStaff, store.RoleAdmin))
+	ordersRead := route.Group("/", auth.RequireAuth(auth.ScopeOrdersRead))
+	ordersWrite := route.Group("/", auth.RequireAuth(auth.ScopeOrdersWrite))
+
+	authorized.GET("/me", userRoutes.GetMe)
+	sensitive.PATCH("/me", userRoutes.UpdateMe)
+	sensitive.DELETE("/me", userRoutes.DeleteMe)
+	sensitive.POST("/me/password", userRoutes.ChangePassword)
+	sensitive.GET("/me/export", userRoutes.ExportMyData)
+	authorized.POST("/email/verify/resend", userRoutes.ResendVerification)
+	sensitive.POST("/mfa/totp/enroll", userRoutes.EnrollTOTP)
+	sensitive.POST("/mfa/totp/confirm", userRoutes.ConfirmTOTP)
+	sensitive.DELETE("/mfa/totp", userRoutes.DisableTOTP)
+	sensitive.POST("/mfa/recovery-codes", userRoutes.RegenerateRecoveryCodes)
+	sensitive.POST("/auth/:provider/link", userRoutes.LinkProvider)
+	authorized.GET("/auth/identities", userRoutes.GetIdentities)
+	sensitive.DELETE("/auth/identities/:provider", userRoutes.UnlinkProvider)
+
+	// OAuth routes
+	route.POST("/oauth/token", userRoutes.Token)
+	route.POST("/oauth/introspect", userRoutes.Introspect)
+	route.POST("/oauth/revoke", userRoutes.Revoke)
+	authorized.GET("/oauth/authorize", userRoutes.GetAuthorization)
+	sensitive.POST("/oauth/authorize", userRoutes.Authorize)
+	sensitive.POST("/oauth/clients", userRoutes.RegisterClient)
+	authorized.GET("/oauth/clients", userRoutes.GetClients)
+	sensitive.DELETE("/oauth/clients/:client_id", userRoutes.DeleteClient)
+	authorized.GET("/oauth/consents", userRoutes.GetConsents)
+	sensitive.DELETE("/oauth/consents/:client_id", userRoutes.RevokeConsent)
+
+	// API key routes
+	sensitive.POST("/api-keys", userRoutes.CreateAPIKey)
+	authorized.GET("/api-keys", userRoutes.GetAPIKeys)
+	sensitive.DELETE("/api-keys/:id", userRoutes.RevokeAPIKey)
+	admin.POST("/service-accounts", userRoutes.CreateServiceAccount)
+	admin.GET("/service-accounts", userRoutes.GetServiceAccounts)
+	admin.POST("/service-accounts/:id/api-keys", userRoutes.CreateServiceAccountKey)
+	admin.GET("/service-accounts/:id/api-keys", userRoutes.GetServiceAccountKeys)
+	admin.GET("/users", userRoutes.GetUsers)
+	admin.GET("/users/:id", userRoutes.GetUser)
+	admin.DELETE("/users/:id", userRoutes.DeleteUser)
+	admin.PUT("/users/:id/role", userRoutes.UpdateUserRole)
+	admin.POST("/users/:id/disable", userRoutes.DisableUser)
+	admin.POST("/users/:id/enable", userRoutes.EnableUser)
+	admin.POST("/users/:id/password-reset", userRoutes.ForcePasswordReset)
+	admin.DELETE("/users/:id/sessions", userRoutes.RevokeUserSessions)
+	admin.POST("/users/:id/unlock", userRoutes.UnlockUser)
+	admin.GET("/users/deleted", userRoutes.GetDeletedUsers)
+	admin.POST("/users/:id/restore", userRoutes.RestoreUser)
+	admin.GET("/users/:id/export", userRoutes.ExportUserData)
+	admin.POST("/users/:id/erase", userRoutes.EraseUser)
+	admin.POST("/users/:id/impersonate", userRoutes.ImpersonateUser)
+	admin.GET("/products/deleted", productRoutes.GetDeletedProducts)
+	admin.POST("/products/:id/restore", productRoutes.RestoreProduct)
+	admin.DELETE("/login-lockouts/ip/:ip", userRoutes.UnlockIP)
+	admin.GET("/audit-log", auditRoutes.GetAuditLog)
+	admin.GET("/audit-log/verify", auditRoutes.VerifyAuditLog)
+
+	productsWrite.POST("/products", productRoutes.AddProduct)
+	productsWrite.DELETE("/products/:id", productRoutes.DeleteProduct)
+	productsWrite.PUT("/products/:id/price", productRoutes.ChangePrice)
+	productsRead.GET("/products/:id/price-history", productRoutes.GetPriceHistory)
+	productsWrite.DELETE("/products/:id/scheduled-prices/:change_id", productRoutes.CancelScheduledPrice)
+	productsWrite.PUT("/products/:id/stock", productRoutes.UpdateStock)
+
+	// Promotion routes
+	storeStaff.POST("/promotions", promotionRoutes.CreatePromotion)
+	storeStaff.GET("/promotions", promotionRoutes.GetPromotions)
+	storeStaff.PUT("/promotions/:id", promotionRoutes.UpdatePromotion)
+	storeStaff.DELETE("/promotions/:id", promotionRoutes.DeletePromotion)
+	storeStaff.POST("/coupons", promotionRoutes.CreateCoupon)
+	storeStaff.GET("/coupons", promotionRoutes.GetCoupons)
+	storeStaff.DELETE("/coupons/:id", promotionRoutes.DeleteCoupon)
+
+	// Tax routes
+	storeStaff.POST("/tax/classes", taxRoutes.CreateTaxClass)
+	storeStaff.GET("/tax/classes", taxRoutes.GetTaxClasses)
+	storeStaff.DELETE("/tax/classes/:id", taxRoutes.DeleteTaxClass)
+	storeStaff.POST("/tax/rates", taxRoutes.CreateTaxRate)
+	storeStaff.GET("/tax/rates", taxRoutes.GetTaxRates)
+	storeStaff.DELETE("/tax/rates/:id", taxRoutes.DeleteTaxRate)
+	storeStaff.PUT("/products/:id/tax-class", taxRoutes.AssignProductTaxClass)
+
+	// Store routes
+	route.GET("/store", storeRoutes.GetCurrentStore)
+	admin.POST("/stores", storeRoutes.CreateStore)
+	admin.GET("/stores", storeRoutes.GetStores)
+	admin.PUT("/stores/:id", storeRoutes.UpdateStore)
+	storeAdmin.GET("/staff", storeRoutes.GetStaff)
+	storeAdmin.PUT("/staff/:user_id", storeRoutes.SetStaff)
+	storeAdmin.DELETE("/staff/:user_id", storeRoutes.RemoveStaff)
+
+	// Address routes
+	authorized.GET("/addresses", addressRoutes.GetAddresses)
+	authorized.POST("/addresses", addressRoutes.AddAddress)
+	authorized.PUT("/addresses/:id", addressRoutes.UpdateAddress)
+	authorized.POST("/addresses/:id/default", addressRoutes.SetDefaultAddress)
+	authorized.DELETE("/addresses/:id", addressRoutes.DeleteAddress)
+
+	// Delivery routes
+	authorized.GET("/delivery/check", deliveryRoutes.CheckDeliverability)
+	storeStaff.POST("/delivery/zones", deliveryRoutes.CreateZone)
+	storeStaff.GET("/delivery/zones", deliveryRoutes.GetZones)
+	storeStaff.PUT("/delivery/zones/:id", deliveryRoutes.UpdateZone)
+	storeStaff.DELETE("/delivery/zones/:id", deliveryRoutes.DeleteZone)
+	authorized.GET("/delivery/slots", deliveryRoutes.GetSlots)
+	authorized.POST("/delivery/slots/:id/reserve", deliveryRoutes.ReserveSlot)
+	authorized.DELETE("/delivery/reservations/:id", deliveryRoutes.ReleaseReservation)
+	storeStaff.POST("/delivery/slots", deliveryRoutes.CreateSlot)
+	storeStaff.POST("/delivery/slot-templates", deliveryRoutes.CreateSlotTemplate)
+	storeStaff.GET("/delivery/slot-templates", deliveryRoutes.GetSlotTemplates)
+	storeStaff.DELETE("/delivery/slot-templates/:id", deliveryRoutes.DeleteSlotTemplate)
+
+	// Cart routes
+	authorized.GET("/cart", cartRoutes.GetCart)
+	authorized.POST("/cart/items", cartRoutes.AddCartItem)
+	authorized.DELETE("/cart/items/:product_id", cartRoutes.RemoveCartItem)
+
+	// Subscription routes
+	authorized.GET("/subscriptions", subscriptionRoutes.GetSubscriptions)
+	authorized.POST("/subscriptions", auth.RequireVerifiedEmail("subscriptions"), subscriptionRoutes.CreateSubscription)
+	authorized.GET("/subscriptions/:id", subscriptionRoutes.GetSubscription)
+	authorized.PUT("/subscriptions/:id", subscriptionRoutes.UpdateSubscription)
+	authorized.DELETE("/subscriptions/:id", subscriptionRoutes.CancelSubscription)
+	authorized.PUT("/subscriptions/:id/next-delivery", subscriptionRoutes.UpdateNextDelivery)
+	authorized.POST("/subscriptions/:id/skip", subscriptionRoutes.SkipNextDelivery)
+	authorized.POST("/subscriptions/:id/pause", subscriptionRoutes.PauseSubscription)
+	authorized.POST("/subscriptions/:id/resume", subscriptionRoutes.ResumeSubscription)
+
+	// List routes
+	authorized.GET("/lists", wishlistRoutes.GetLists)
+	authorized.POST("/lists", wishlistRoutes.CreateList)
+	authorized.GET("/lists/:id", wishlistRoutes.GetList)
+	authorized.DELETE("/lists/:id", wishlistRoutes.DeleteList)
+	authorized.POST("/lists/:id/items", wishlistRoutes.AddListItem)
+	authorized.DELETE("/lists/:id/items/:product_id", wishlistRoutes.RemoveListItem)
+	authorized.POST("/lists/:id/share", wishlistRoutes.ShareList)
+	authorized.DELETE("/lists/:id/share", wishlistRoutes.UnshareList)
+	authorized.POST("/lists/:id/move-to-cart", wishlistRoutes.MoveListToCart)
+	route.GET("/shared-lists/:token", wishlistRoutes.GetSharedList)
+
+	// Notification routes
+	authorized.GET("/notifications", notificationRoutes.GetNotifications)
+	authorized.POST("/notifications/:id/read", notificationRoutes.MarkNotificationRead)
+
+	// Order routes
+	ordersWrite.POST("/checkout", auth.ForbidImpersonation(), auth.RequireVerifiedEmail("checkout"), orderRoutes.Checkout)
+	ordersRead.GET("/orders", orderRoutes.GetOrders)
+	ordersRead.GET("/orders/:id", orderRoutes.GetOrder)
+	ordersWrite.POST("/orders/:id/pay", auth.ForbidImpersonation(), orderRoutes.PayOrder)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	fmt.Printf("Server is running on port %s\n", port)
+	// Paths under /store/{slug} are routed without the prefix. Requests
+	// still running when the shutdown grace period ends are cancelled.
+	server := timeout.Server(":"+port, store.StripPrefix(route), deadlines)
+	base, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server.BaseContext = func(net.Listener) context.Context { return base }
 
-	err := route.Run(":" + port)
-	if err != nil {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-stop.Done()
+		fmt.Println("Shutting down")
+		if err := shutdown(server, timeout.ShutdownGrace()); err != nil {
+			// Cancelled requests answer 503, give them a moment to.
+			cancelRequests()
+			if err := shutdown(server, 5*time.Second); err != nil {
+				server.Close()
+			}
+		}
+	}()
+
+	fmt.Printf("Server is running on port %s\n", port)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(err)
 	}
+	<-drained
+}
+
+// shutdown waits up to grace for in-flight requests to finish.
+func shutdown(server *http.Server, grace time.Duration) error {
+	c, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	return server.Shutdown(c)
 }
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS users (
+	id BIGSERIAL PRIMARY KEY,
+	username VARCHAR NOT NULL UNIQUE,
+	password VARCHAR NOT NULL
+);
+
+--bun:split
+
+CREATE TABLE IF NOT EXISTS products (
+	id BIGSERIAL PRIMARY KEY,
+	image VARCHAR NOT NULL,
+	product_title VARCHAR NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	unit VARCHAR NOT NULL,
+	rating BIGINT NOT NULL
+);
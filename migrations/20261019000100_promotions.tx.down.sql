@@ -0,0 +1,33 @@
+DROP TABLE IF EXISTS coupon_redemptions;
+
+--bun:split
+
+DROP TABLE IF EXISTS order_discounts;
+
+--bun:split
+
+DROP TABLE IF EXISTS order_items;
+
+--bun:split
+
+DROP TABLE IF EXISTS orders;
+
+--bun:split
+
+DROP TABLE IF EXISTS cart_items;
+
+--bun:split
+
+DROP TABLE IF EXISTS coupons;
+
+--bun:split
+
+DROP TABLE IF EXISTS promotions;
+
+--bun:split
+
+ALTER TABLE products DROP COLUMN IF EXISTS category;
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
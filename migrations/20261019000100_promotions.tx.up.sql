@@ -0,0 +1,99 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR NOT NULL DEFAULT 'customer';
+
+--bun:split
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR NOT NULL DEFAULT '';
+
+--bun:split
+
+CREATE TABLE promotions (
+	id BIGSERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	type VARCHAR NOT NULL,
+	value DOUBLE PRECISION NOT NULL DEFAULT 0,
+	product_id BIGINT REFERENCES products (id) ON DELETE CASCADE,
+	category VARCHAR NOT NULL DEFAULT '',
+	buy_quantity BIGINT NOT NULL DEFAULT 0,
+	get_quantity BIGINT NOT NULL DEFAULT 0,
+	min_cart_total DOUBLE PRECISION NOT NULL DEFAULT 0,
+	stackable BOOLEAN NOT NULL DEFAULT FALSE,
+	priority BIGINT NOT NULL DEFAULT 0,
+	coupon_only BOOLEAN NOT NULL DEFAULT FALSE,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	starts_at TIMESTAMPTZ,
+	ends_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE TABLE coupons (
+	id BIGSERIAL PRIMARY KEY,
+	code VARCHAR NOT NULL UNIQUE,
+	promotion_id BIGINT NOT NULL REFERENCES promotions (id) ON DELETE CASCADE,
+	max_uses BIGINT NOT NULL DEFAULT 0,
+	max_uses_per_user BIGINT NOT NULL DEFAULT 0,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	starts_at TIMESTAMPTZ,
+	ends_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE TABLE cart_items (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	quantity BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, product_id)
+);
+
+--bun:split
+
+CREATE TABLE orders (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id),
+	status VARCHAR NOT NULL,
+	coupon_code VARCHAR NOT NULL DEFAULT '',
+	subtotal DOUBLE PRECISION NOT NULL,
+	discount_total DOUBLE PRECISION NOT NULL,
+	total DOUBLE PRECISION NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE TABLE order_items (
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+	product_id BIGINT NOT NULL,
+	product_title VARCHAR NOT NULL,
+	unit_price DOUBLE PRECISION NOT NULL,
+	quantity BIGINT NOT NULL,
+	discount DOUBLE PRECISION NOT NULL,
+	total DOUBLE PRECISION NOT NULL
+);
+
+--bun:split
+
+CREATE TABLE order_discounts (
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+	promotion_id BIGINT NOT NULL,
+	name VARCHAR NOT NULL,
+	coupon_code VARCHAR NOT NULL DEFAULT '',
+	amount DOUBLE PRECISION NOT NULL,
+	explanation VARCHAR NOT NULL
+);
+
+--bun:split
+
+CREATE TABLE coupon_redemptions (
+	id BIGSERIAL PRIMARY KEY,
+	coupon_id BIGINT NOT NULL REFERENCES coupons (id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	order_id BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
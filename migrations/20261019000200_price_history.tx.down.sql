@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS scheduled_prices;
+
+--bun:split
+
+DROP TABLE IF EXISTS price_histories;
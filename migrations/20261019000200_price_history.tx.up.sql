@@ -0,0 +1,36 @@
+CREATE TABLE price_histories (
+	id BIGSERIAL PRIMARY KEY,
+	product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	old_price DOUBLE PRECISION,
+	new_price DOUBLE PRECISION NOT NULL,
+	changed_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE INDEX price_histories_product_id_changed_at_idx ON price_histories (product_id, changed_at);
+
+--bun:split
+
+-- Seed the history with the prices products have today.
+INSERT INTO price_histories (product_id, new_price)
+SELECT id, price FROM products;
+
+--bun:split
+
+CREATE TABLE scheduled_prices (
+	id BIGSERIAL PRIMARY KEY,
+	product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	price DOUBLE PRECISION NOT NULL,
+	effective_at TIMESTAMPTZ NOT NULL,
+	created_by BIGINT NOT NULL REFERENCES users (id),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	applied_at TIMESTAMPTZ,
+	cancelled_at TIMESTAMPTZ
+);
+
+--bun:split
+
+CREATE INDEX scheduled_prices_pending_idx ON scheduled_prices (effective_at)
+WHERE applied_at IS NULL AND cancelled_at IS NULL;
@@ -0,0 +1,25 @@
+DROP TABLE IF EXISTS order_taxes;
+
+--bun:split
+
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax;
+
+--bun:split
+
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS tax_mode,
+	DROP COLUMN IF EXISTS tax_country,
+	DROP COLUMN IF EXISTS tax_region,
+	DROP COLUMN IF EXISTS tax_total;
+
+--bun:split
+
+ALTER TABLE products DROP COLUMN IF EXISTS tax_class_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS tax_rates;
+
+--bun:split
+
+DROP TABLE IF EXISTS tax_classes;
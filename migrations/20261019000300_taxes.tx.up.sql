@@ -0,0 +1,57 @@
+CREATE TABLE tax_classes (
+	id BIGSERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL UNIQUE,
+	is_default BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+--bun:split
+
+CREATE UNIQUE INDEX tax_classes_single_default_idx ON tax_classes (is_default) WHERE is_default;
+
+--bun:split
+
+INSERT INTO tax_classes (name, is_default) VALUES ('Standard', TRUE);
+
+--bun:split
+
+CREATE TABLE tax_rates (
+	id BIGSERIAL PRIMARY KEY,
+	tax_class_id BIGINT NOT NULL REFERENCES tax_classes (id) ON DELETE CASCADE,
+	name VARCHAR NOT NULL,
+	country VARCHAR(2) NOT NULL,
+	region VARCHAR NOT NULL DEFAULT '',
+	rate DOUBLE PRECISION NOT NULL
+);
+
+--bun:split
+
+CREATE INDEX tax_rates_country_region_idx ON tax_rates (country, region);
+
+--bun:split
+
+ALTER TABLE products ADD COLUMN tax_class_id BIGINT REFERENCES tax_classes (id) ON DELETE SET NULL;
+
+--bun:split
+
+ALTER TABLE orders
+	ADD COLUMN tax_mode VARCHAR NOT NULL DEFAULT 'exclusive',
+	ADD COLUMN tax_country VARCHAR NOT NULL DEFAULT '',
+	ADD COLUMN tax_region VARCHAR NOT NULL DEFAULT '',
+	ADD COLUMN tax_total DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+--bun:split
+
+ALTER TABLE order_items ADD COLUMN tax DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE order_taxes (
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+	name VARCHAR NOT NULL,
+	country VARCHAR NOT NULL,
+	region VARCHAR NOT NULL DEFAULT '',
+	rate DOUBLE PRECISION NOT NULL,
+	taxable DOUBLE PRECISION NOT NULL,
+	amount DOUBLE PRECISION NOT NULL
+);
@@ -0,0 +1,12 @@
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS delivery_zone_id,
+	DROP COLUMN IF EXISTS delivery_fee,
+	DROP COLUMN IF EXISTS shipping_address;
+
+--bun:split
+
+DROP TABLE IF EXISTS delivery_zones;
+
+--bun:split
+
+DROP TABLE IF EXISTS addresses;
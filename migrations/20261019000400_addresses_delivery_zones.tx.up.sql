@@ -0,0 +1,41 @@
+CREATE TABLE addresses (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	label VARCHAR NOT NULL DEFAULT '',
+	recipient VARCHAR NOT NULL,
+	line1 VARCHAR NOT NULL,
+	line2 VARCHAR NOT NULL DEFAULT '',
+	city VARCHAR NOT NULL,
+	region VARCHAR NOT NULL DEFAULT '',
+	postal_code VARCHAR NOT NULL,
+	country VARCHAR(2) NOT NULL,
+	phone VARCHAR NOT NULL DEFAULT '',
+	latitude DOUBLE PRECISION,
+	longitude DOUBLE PRECISION,
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE UNIQUE INDEX addresses_single_default_idx ON addresses (user_id) WHERE is_default;
+
+--bun:split
+
+CREATE TABLE delivery_zones (
+	id BIGSERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	country VARCHAR(2) NOT NULL,
+	postal_codes VARCHAR[],
+	polygon JSONB,
+	fee DOUBLE PRECISION NOT NULL DEFAULT 0,
+	min_order DOUBLE PRECISION NOT NULL DEFAULT 0,
+	active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+--bun:split
+
+ALTER TABLE orders
+	ADD COLUMN delivery_zone_id BIGINT REFERENCES delivery_zones (id) ON DELETE SET NULL,
+	ADD COLUMN delivery_fee DOUBLE PRECISION NOT NULL DEFAULT 0,
+	ADD COLUMN shipping_address JSONB;
@@ -0,0 +1,17 @@
+DROP TABLE IF EXISTS slot_reservations;
+
+--bun:split
+
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS delivery_slot_id,
+	DROP COLUMN IF EXISTS payment_due_at,
+	DROP COLUMN IF EXISTS payment_ref,
+	DROP COLUMN IF EXISTS paid_at;
+
+--bun:split
+
+DROP TABLE IF EXISTS delivery_slots;
+
+--bun:split
+
+DROP TABLE IF EXISTS delivery_slot_templates;
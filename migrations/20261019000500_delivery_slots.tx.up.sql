@@ -0,0 +1,50 @@
+CREATE TABLE delivery_slot_templates (
+	id BIGSERIAL PRIMARY KEY,
+	zone_id BIGINT NOT NULL REFERENCES delivery_zones (id) ON DELETE CASCADE,
+	weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+	start_time VARCHAR(5) NOT NULL,
+	end_time VARCHAR(5) NOT NULL,
+	capacity BIGINT NOT NULL CHECK (capacity > 0),
+	active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+--bun:split
+
+CREATE TABLE delivery_slots (
+	id BIGSERIAL PRIMARY KEY,
+	zone_id BIGINT NOT NULL REFERENCES delivery_zones (id) ON DELETE CASCADE,
+	starts_at TIMESTAMPTZ NOT NULL,
+	ends_at TIMESTAMPTZ NOT NULL,
+	capacity BIGINT NOT NULL CHECK (capacity > 0),
+	reserved BIGINT NOT NULL DEFAULT 0 CHECK (reserved >= 0 AND reserved <= capacity),
+	template_id BIGINT REFERENCES delivery_slot_templates (id) ON DELETE SET NULL,
+	UNIQUE (zone_id, starts_at)
+);
+
+--bun:split
+
+ALTER TABLE orders
+	ADD COLUMN delivery_slot_id BIGINT REFERENCES delivery_slots (id) ON DELETE SET NULL,
+	ADD COLUMN payment_due_at TIMESTAMPTZ,
+	ADD COLUMN payment_ref VARCHAR NOT NULL DEFAULT '',
+	ADD COLUMN paid_at TIMESTAMPTZ;
+
+--bun:split
+
+CREATE INDEX orders_pending_payment_idx ON orders (payment_due_at) WHERE status = 'pending_payment';
+
+--bun:split
+
+CREATE TABLE slot_reservations (
+	id BIGSERIAL PRIMARY KEY,
+	slot_id BIGINT NOT NULL REFERENCES delivery_slots (id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	order_id BIGINT REFERENCES orders (id) ON DELETE SET NULL,
+	status VARCHAR NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+--bun:split
+
+CREATE INDEX slot_reservations_held_idx ON slot_reservations (expires_at) WHERE status = 'held';
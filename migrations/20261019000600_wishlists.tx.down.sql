@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS notifications;
+
+--bun:split
+
+DROP TABLE IF EXISTS list_items;
+
+--bun:split
+
+DROP TABLE IF EXISTS lists;
+
+--bun:split
+
+ALTER TABLE products
+	DROP COLUMN IF EXISTS stock;
@@ -0,0 +1,49 @@
+ALTER TABLE products
+	ADD COLUMN stock BIGINT CHECK (stock >= 0);
+
+--bun:split
+
+CREATE TABLE lists (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	kind VARCHAR NOT NULL DEFAULT 'favorites',
+	share_token VARCHAR UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX lists_user_id_idx ON lists (user_id);
+
+--bun:split
+
+CREATE TABLE list_items (
+	id BIGSERIAL PRIMARY KEY,
+	list_id BIGINT NOT NULL REFERENCES lists (id) ON DELETE CASCADE,
+	product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	quantity BIGINT NOT NULL DEFAULT 1 CHECK (quantity > 0),
+	note VARCHAR(500) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+	UNIQUE (list_id, product_id)
+);
+
+--bun:split
+
+CREATE INDEX list_items_product_id_idx ON list_items (product_id);
+
+--bun:split
+
+CREATE TABLE notifications (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	kind VARCHAR NOT NULL,
+	message VARCHAR NOT NULL,
+	product_id BIGINT REFERENCES products (id) ON DELETE SET NULL,
+	read_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at);
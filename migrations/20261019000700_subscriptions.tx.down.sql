@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS subscription_runs;
+
+--bun:split
+
+DROP TABLE IF EXISTS subscription_items;
+
+--bun:split
+
+DROP TABLE IF EXISTS subscriptions;
@@ -0,0 +1,47 @@
+CREATE TABLE subscriptions (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	cadence VARCHAR NOT NULL,
+	address_id BIGINT REFERENCES addresses (id) ON DELETE SET NULL,
+	allow_substitutions BOOLEAN NOT NULL DEFAULT TRUE,
+	status VARCHAR NOT NULL,
+	paused_until TIMESTAMPTZ,
+	next_run_at TIMESTAMPTZ NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX subscriptions_due_idx ON subscriptions (status, next_run_at);
+
+--bun:split
+
+CREATE TABLE subscription_items (
+	id BIGSERIAL PRIMARY KEY,
+	subscription_id BIGINT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+	product_id BIGINT NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+	quantity BIGINT NOT NULL CHECK (quantity > 0),
+	next_quantity BIGINT CHECK (next_quantity >= 0),
+	substitute_product_id BIGINT REFERENCES products (id) ON DELETE SET NULL,
+	UNIQUE (subscription_id, product_id)
+);
+
+--bun:split
+
+CREATE TABLE subscription_runs (
+	id BIGSERIAL PRIMARY KEY,
+	subscription_id BIGINT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+	order_id BIGINT REFERENCES orders (id) ON DELETE SET NULL,
+	scheduled_for TIMESTAMPTZ NOT NULL,
+	status VARCHAR NOT NULL,
+	attempts BIGINT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ,
+	error VARCHAR NOT NULL DEFAULT '',
+	substitutions JSONB,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX subscription_runs_retry_idx ON subscription_runs (status, next_attempt_at);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS password_reset_tokens;
+
+--bun:split
+
+ALTER TABLE users
+	DROP COLUMN IF EXISTS email,
+	DROP COLUMN IF EXISTS session_version;
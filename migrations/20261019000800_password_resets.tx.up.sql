@@ -0,0 +1,14 @@
+ALTER TABLE users
+	ADD COLUMN email VARCHAR UNIQUE,
+	ADD COLUMN session_version BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE password_reset_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	token_hash VARCHAR NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
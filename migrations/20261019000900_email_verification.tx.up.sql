@@ -0,0 +1,18 @@
+ALTER TABLE users
+	ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+--bun:split
+
+CREATE TABLE email_verification_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	email VARCHAR NOT NULL,
+	token_hash VARCHAR NOT NULL UNIQUE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id, created_at);
@@ -0,0 +1,6 @@
+CREATE TABLE login_throttles (
+	key VARCHAR PRIMARY KEY,
+	failures BIGINT NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ
+);
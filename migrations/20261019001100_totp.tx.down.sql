@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+--bun:split
+
+ALTER TABLE users
+	DROP COLUMN IF EXISTS totp_secret,
+	DROP COLUMN IF EXISTS totp_enabled_at,
+	DROP COLUMN IF EXISTS totp_last_step;
@@ -0,0 +1,17 @@
+ALTER TABLE users
+	ADD COLUMN totp_secret VARCHAR,
+	ADD COLUMN totp_enabled_at TIMESTAMPTZ,
+	ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+--bun:split
+
+CREATE TABLE recovery_codes (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	code_hash VARCHAR NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+--bun:split
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
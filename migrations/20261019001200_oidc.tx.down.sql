@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS oidc_logins;
+
+--bun:split
+
+DROP TABLE IF EXISTS user_identities;
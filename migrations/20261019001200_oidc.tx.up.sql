@@ -0,0 +1,22 @@
+CREATE TABLE user_identities (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	provider VARCHAR NOT NULL,
+	subject VARCHAR NOT NULL,
+	email VARCHAR,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+	UNIQUE (provider, subject),
+	UNIQUE (user_id, provider)
+);
+
+--bun:split
+
+CREATE TABLE oidc_logins (
+	id BIGSERIAL PRIMARY KEY,
+	state_hash VARCHAR NOT NULL UNIQUE,
+	provider VARCHAR NOT NULL,
+	code_verifier VARCHAR NOT NULL,
+	nonce VARCHAR NOT NULL,
+	user_id BIGINT REFERENCES users (id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
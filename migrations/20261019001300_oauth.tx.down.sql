@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS oauth_tokens;
+
+--bun:split
+
+DROP TABLE IF EXISTS oauth_codes;
+
+--bun:split
+
+DROP TABLE IF EXISTS oauth_consents;
+
+--bun:split
+
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,52 @@
+CREATE TABLE oauth_clients (
+	id BIGSERIAL PRIMARY KEY,
+	client_id VARCHAR NOT NULL UNIQUE,
+	secret_hash VARCHAR,
+	name VARCHAR NOT NULL,
+	redirect_uris VARCHAR[] NOT NULL,
+	scopes VARCHAR[] NOT NULL,
+	owner_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE TABLE oauth_consents (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	client_id VARCHAR NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+	scopes VARCHAR[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+	UNIQUE (user_id, client_id)
+);
+
+--bun:split
+
+CREATE TABLE oauth_codes (
+	id BIGSERIAL PRIMARY KEY,
+	code_hash VARCHAR NOT NULL UNIQUE,
+	client_id VARCHAR NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	redirect_uri VARCHAR NOT NULL,
+	scope VARCHAR NOT NULL,
+	code_challenge VARCHAR NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ
+);
+
+--bun:split
+
+CREATE TABLE oauth_tokens (
+	id VARCHAR PRIMARY KEY,
+	client_id VARCHAR NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	scope VARCHAR NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX oauth_tokens_user_client_idx ON oauth_tokens (user_id, client_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS api_keys;
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN IF EXISTS service_account;
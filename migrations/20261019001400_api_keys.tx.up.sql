@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN service_account BOOLEAN NOT NULL DEFAULT FALSE;
+
+--bun:split
+
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name VARCHAR NOT NULL,
+	prefix VARCHAR NOT NULL UNIQUE,
+	key_hash VARCHAR NOT NULL,
+	scopes VARCHAR[] NOT NULL,
+	expires_at TIMESTAMPTZ,
+	last_used_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ,
+	created_by BIGINT REFERENCES users (id) ON DELETE SET NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
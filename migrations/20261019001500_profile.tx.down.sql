@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS users_deletion_scheduled_at_idx;
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS phone;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
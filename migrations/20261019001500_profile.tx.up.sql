@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN display_name VARCHAR;
+ALTER TABLE users ADD COLUMN phone VARCHAR;
+ALTER TABLE users ADD COLUMN avatar_url VARCHAR;
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMPTZ;
+
+--bun:split
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
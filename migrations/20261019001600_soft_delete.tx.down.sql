@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS products_deleted_at_idx;
+
+--bun:split
+
+DROP INDEX IF EXISTS users_deleted_at_idx;
+
+--bun:split
+
+ALTER TABLE products DROP COLUMN IF EXISTS deleted_at;
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN anonymized_at TIMESTAMPTZ;
+
+--bun:split
+
+ALTER TABLE products ADD COLUMN deleted_at TIMESTAMPTZ;
+
+--bun:split
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+--bun:split
+
+CREATE INDEX products_deleted_at_idx ON products (deleted_at) WHERE deleted_at IS NOT NULL;
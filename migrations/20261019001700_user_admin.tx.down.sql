@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS users_created_at_idx;
+
+--bun:split
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_reset_required;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS last_login_ip;
+ALTER TABLE users DROP COLUMN IF EXISTS last_login_at;
+ALTER TABLE users DROP COLUMN IF EXISTS signup_user_agent;
+ALTER TABLE users DROP COLUMN IF EXISTS signup_ip;
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,11 @@
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp;
+ALTER TABLE users ADD COLUMN signup_ip VARCHAR;
+ALTER TABLE users ADD COLUMN signup_user_agent VARCHAR;
+ALTER TABLE users ADD COLUMN last_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN last_login_ip VARCHAR;
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+--bun:split
+
+CREATE INDEX users_created_at_idx ON users (created_at);
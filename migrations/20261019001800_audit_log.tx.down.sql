@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS audit_log;
+
+--bun:split
+
+DROP FUNCTION IF EXISTS audit_log_append_only();
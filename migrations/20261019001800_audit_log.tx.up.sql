@@ -0,0 +1,46 @@
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	actor_id BIGINT,
+	action VARCHAR NOT NULL,
+	target_type VARCHAR NOT NULL,
+	target_id VARCHAR NOT NULL,
+	changes JSON,
+	request_id VARCHAR NOT NULL,
+	ip VARCHAR NOT NULL,
+	user_agent VARCHAR NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	prev_hash VARCHAR NOT NULL,
+	hash VARCHAR NOT NULL UNIQUE
+);
+
+--bun:split
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id);
+
+--bun:split
+
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id);
+
+--bun:split
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+--bun:split
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+--bun:split
+
+CREATE TRIGGER audit_log_append_only
+	BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+--bun:split
+
+CREATE TRIGGER audit_log_no_truncate
+	BEFORE TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
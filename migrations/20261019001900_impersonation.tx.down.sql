@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS audit_log_impersonator_id_idx;
+
+--bun:split
+
+ALTER TABLE audit_log DROP COLUMN IF EXISTS impersonator_id;
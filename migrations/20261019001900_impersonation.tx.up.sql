@@ -0,0 +1,5 @@
+ALTER TABLE audit_log ADD COLUMN impersonator_id BIGINT;
+
+--bun:split
+
+CREATE INDEX audit_log_impersonator_id_idx ON audit_log (impersonator_id) WHERE impersonator_id IS NOT NULL;
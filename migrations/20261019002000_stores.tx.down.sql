@@ -0,0 +1,17 @@
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+ALTER TABLE orders DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+ALTER TABLE products DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+DROP TABLE IF EXISTS store_staff;
+
+--bun:split
+
+DROP TABLE IF EXISTS stores;
@@ -0,0 +1,87 @@
+CREATE TABLE stores (
+	id BIGSERIAL PRIMARY KEY,
+	slug VARCHAR(50) NOT NULL UNIQUE,
+	name VARCHAR(100) NOT NULL,
+	host VARCHAR UNIQUE,
+	cors_origins VARCHAR[] NOT NULL DEFAULT '{}',
+	is_default BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp
+);
+
+--bun:split
+
+CREATE UNIQUE INDEX stores_default_idx ON stores (is_default) WHERE is_default;
+
+--bun:split
+
+INSERT INTO stores (slug, name, cors_origins, is_default)
+VALUES ('homebuzz', 'Homebuzz', '{https://homebuzz-backend.onrender.com,https://homebuzz.netlify.app}', TRUE);
+
+--bun:split
+
+CREATE TABLE store_staff (
+	store_id BIGINT NOT NULL REFERENCES stores (id) ON DELETE CASCADE,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	role VARCHAR NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT current_timestamp,
+	PRIMARY KEY (store_id, user_id)
+);
+
+--bun:split
+
+CREATE INDEX store_staff_user_id_idx ON store_staff (user_id);
+
+--bun:split
+
+INSERT INTO store_staff (store_id, user_id, role)
+SELECT stores.id, users.id, 'staff'
+FROM stores, users
+WHERE stores.is_default AND users.role = 'staff';
+
+--bun:split
+
+ALTER TABLE products ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE products SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE products ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+CREATE INDEX products_store_id_idx ON products (store_id);
+
+--bun:split
+
+ALTER TABLE orders ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE orders SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE orders ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+CREATE INDEX orders_store_id_idx ON orders (store_id, user_id);
+
+--bun:split
+
+ALTER TABLE subscriptions ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE subscriptions SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE subscriptions ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+CREATE INDEX subscriptions_store_id_idx ON subscriptions (store_id, user_id);
@@ -0,0 +1,29 @@
+ALTER TABLE delivery_zones DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+DROP INDEX IF EXISTS tax_classes_single_default_idx;
+
+--bun:split
+
+ALTER TABLE tax_classes DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+ALTER TABLE tax_classes ADD CONSTRAINT tax_classes_name_key UNIQUE (name);
+
+--bun:split
+
+CREATE UNIQUE INDEX tax_classes_single_default_idx ON tax_classes (is_default) WHERE is_default;
+
+--bun:split
+
+ALTER TABLE coupons DROP COLUMN IF EXISTS store_id;
+
+--bun:split
+
+ALTER TABLE coupons ADD CONSTRAINT coupons_code_key UNIQUE (code);
+
+--bun:split
+
+ALTER TABLE promotions DROP COLUMN IF EXISTS store_id;
@@ -0,0 +1,77 @@
+ALTER TABLE promotions ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE promotions SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE promotions ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+CREATE INDEX promotions_store_id_idx ON promotions (store_id);
+
+--bun:split
+
+ALTER TABLE coupons ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE coupons SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE coupons ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE coupons DROP CONSTRAINT coupons_code_key;
+
+--bun:split
+
+ALTER TABLE coupons ADD CONSTRAINT coupons_store_id_code_key UNIQUE (store_id, code);
+
+--bun:split
+
+ALTER TABLE tax_classes ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE tax_classes SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE tax_classes ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+ALTER TABLE tax_classes DROP CONSTRAINT tax_classes_name_key;
+
+--bun:split
+
+ALTER TABLE tax_classes ADD CONSTRAINT tax_classes_store_id_name_key UNIQUE (store_id, name);
+
+--bun:split
+
+DROP INDEX tax_classes_single_default_idx;
+
+--bun:split
+
+CREATE UNIQUE INDEX tax_classes_single_default_idx ON tax_classes (store_id) WHERE is_default;
+
+--bun:split
+
+ALTER TABLE delivery_zones ADD COLUMN store_id BIGINT REFERENCES stores (id);
+
+--bun:split
+
+UPDATE delivery_zones SET store_id = (SELECT id FROM stores WHERE is_default);
+
+--bun:split
+
+ALTER TABLE delivery_zones ALTER COLUMN store_id SET NOT NULL;
+
+--bun:split
+
+CREATE INDEX delivery_zones_store_id_idx ON delivery_zones (store_id);
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/migrate"
+)
+
+//go:embed *.sql
+var sqlMigrations embed.FS
+
+var Migrations = migrate.NewMigrations()
+
+func init() {
+	if err := Migrations.Discover(sqlMigrations); err != nil {
+		panic(err)
+	}
+}
+
+// Migrate applies every pending migration. It is safe to call on every start.
+func Migrate(db *bun.DB) {
+	ctx := context.Background()
+	migrator := migrate.NewMigrator(db, Migrations)
+
+	if err := migrator.Init(ctx); err != nil {
+		fmt.Println("Error initializing migrations:", err)
+		panic(err)
+	}
+
+	if err := migrator.Lock(ctx); err != nil {
+		fmt.Println("Error locking migrations:", err)
+		panic(err)
+	}
+	defer migrator.Unlock(ctx)
+
+	group, err := migrator.Migrate(ctx)
+	if err != nil {
+		fmt.Println("Error running migrations:", err)
+		panic(err)
+	}
+
+	if group.IsZero() {
+		fmt.Println("Database schema is up to date")
+		return
+	}
+	fmt.Printf("Migrated to %s\n", group)
+}
@@ -0,0 +1,44 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	KindPriceDrop    = "price_drop"
+	KindBackInStock  = "back_in_stock"
+	KindSubscription = "subscription"
+)
+
+// Notification is an in-app message shown to a user.
+type Notification struct {
+	ID        int64      `bun:",pk,autoincrement" json:"id"`
+	UserID    int64      `bun:"user_id,notnull" json:"user_id"`
+	Kind      string     `bun:"kind,notnull" json:"kind" example:"price_drop"`
+	Message   string     `bun:"message,notnull" json:"message" example:"Whole milk dropped from 2.49 to 1.99"`
+	ProductID *int64     `bun:"product_id" json:"product_id,omitempty"`
+	ReadAt    *time.Time `bun:"read_at" json:"read_at"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Send stores the same notification for every user in userIDs.
+func Send(ctx context.Context, db bun.IDB, userIDs []int64, kind, message string, productID *int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	notifications := make([]Notification, 0, len(userIDs))
+	for _, userID := range userIDs {
+		notifications = append(notifications, Notification{
+			UserID:    userID,
+			Kind:      kind,
+			Message:   message,
+			ProductID: productID,
+		})
+	}
+	_, err := db.NewInsert().Model(&notifications).Exec(ctx)
+	return err
+}
@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Discovery is the part of a provider's OpenID configuration the client uses.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is the account a user signed in with at a provider.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OpenID Connect identity provider such as Google or Apple,
+// signed in to with the authorization code flow and PKCE. Its endpoints and
+// signing keys are discovered from the issuer and cached.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// ResponseMode is passed on to the provider when set. Apple needs
+	// "form_post" to return the user's email.
+	ResponseMode string
+	Client       *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      map[string]any
+}
+
+func (p *Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	response, err := p.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: GET %s returned %s", p.Name, endpoint, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// Discover fetches the provider's OpenID configuration from the issuer's
+// well-known address.
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := new(Discovery)
+	endpoint := strings.TrimRight(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, endpoint, discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != strings.TrimRight(p.Issuer, "/") && discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("%s: discovery document is for issuer %q", p.Name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("%s: incomplete discovery document", p.Name)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// AuthCodeURL returns the address to send the user to for signing in.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	if p.ResponseMode != "" {
+		query.Set("response_mode", p.ResponseMode)
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the
+// verified ID token. The nonce must match the one sent with AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.client().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: token endpoint returned %s: %s", p.Name, response.Status, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%s: token response has no id_token", p.Name)
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewPKCE returns a code verifier and its S256 code challenge.
+func NewPKCE() (string, string, error) {
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewNonce returns a random value for the state and nonce parameters.
+func NewNonce() (string, error) {
+	return randomString(24)
+}
+
+func getenv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// defaultIssuers lets well-known providers be configured by name alone.
+var defaultIssuers = map[string]string{
+	"google": "https://accounts.google.com",
+	"apple":  "https://appleid.apple.com",
+}
+
+// ProvidersFromEnv configures the providers listed in OIDC_PROVIDERS, such as
+// "google,apple". Each is set up with OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_ISSUER (known for Google and Apple),
+// OIDC_<NAME>_REDIRECT_URL (API_URL/auth/<name>/callback by default),
+// OIDC_<NAME>_SCOPES and OIDC_<NAME>_RESPONSE_MODE. Providers without a
+// client ID are skipped.
+func ProvidersFromEnv() map[string]*Provider {
+	apiURL := strings.TrimRight(getenv("API_URL", "http://localhost:8080"), "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	providers := make(map[string]*Provider)
+	for _, name := range strings.Split(getenv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := &Provider{
+			Name:         name,
+			Issuer:       getenv(prefix+"ISSUER", defaultIssuers[name]),
+			ClientID:     getenv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getenv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getenv(prefix+"REDIRECT_URL", apiURL+"/auth/"+name+"/callback"),
+			Scopes:       strings.Fields(getenv(prefix+"SCOPES", "openid email profile")),
+			Client:       client,
+		}
+		if name == "apple" {
+			provider.Scopes = strings.Fields(getenv(prefix+"SCOPES", "openid email name"))
+			provider.ResponseMode = getenv(prefix+"RESPONSE_MODE", "form_post")
+		} else {
+			provider.ResponseMode = getenv(prefix+"RESPONSE_MODE", "")
+		}
+
+		if provider.ClientID == "" || provider.Issuer == "" {
+			fmt.Printf("OIDC provider %s is missing a client ID or issuer, skipping\n", name)
+			continue
+		}
+		providers[name] = provider
+	}
+	return providers
+}
@@ -0,0 +1,247 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/in43sh/homebuzz-backend/oidc"
+	"github.com/in43sh/homebuzz-backend/oidc/oidctest"
+)
+
+var ada = oidctest.User{Subject: "ada-1815", Email: "Ada@Example.com", EmailVerified: true, Name: "Ada Lovelace"}
+
+// signIn starts a sign-in like the callback does and has ada sign in at the
+// server, returning the code, verifier and nonce for Exchange.
+func signIn(t *testing.T, server *oidctest.Server, provider *oidc.Provider) (code, verifier, nonce string) {
+	t.Helper()
+
+	state, err := oidc.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err = oidc.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, returnedState := server.SignIn(t, authorizationURL, ada)
+	if returnedState != state {
+		t.Fatalf("state = %q, want %q", returnedState, state)
+	}
+	return code, verifier, nonce
+}
+
+func TestDiscover(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("mock")
+
+	discovery, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if discovery.Issuer != server.URL || discovery.TokenEndpoint != server.URL+"/token" || discovery.JWKSURI != server.URL+"/jwks" {
+		t.Errorf("Discover = %+v", discovery)
+	}
+
+	// The configuration is cached, so the provider isn't asked again.
+	server.Close()
+	if _, err := provider.Discover(context.Background()); err != nil {
+		t.Errorf("Discover after the first call: %v", err)
+	}
+}
+
+func TestDiscoverRejectsBadDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"other issuer", `{"issuer":"https://evil.example.com","authorization_endpoint":"a","token_endpoint":"t","jwks_uri":"j"}`},
+		{"incomplete", `{"issuer":"ISSUER","authorization_endpoint":"a"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.ReplaceAll(test.document, "ISSUER", server.URL)))
+			}))
+			defer server.Close()
+
+			provider := &oidc.Provider{Name: "mock", Issuer: server.URL, Client: server.Client()}
+			if _, err := provider.Discover(context.Background()); err == nil {
+				t.Error("Discover succeeded")
+			}
+		})
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("mock")
+	provider.ResponseMode = "form_post"
+
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier == challenge {
+		t.Fatal("challenge is the verifier")
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authorizationURL, server.URL+"/authorize?") {
+		t.Errorf("AuthCodeURL = %q, want the authorization endpoint", authorizationURL)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "homebuzz",
+		"redirect_uri":          provider.RedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+		"response_mode":         "form_post",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("mock")
+	code, verifier, nonce := signIn(t, server, provider)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := oidc.Identity{Provider: "mock", Subject: "ada-1815", Email: "ada@example.com", EmailVerified: true, Name: "Ada Lovelace"}
+	if *identity != want {
+		t.Errorf("Exchange = %+v, want %+v", *identity, want)
+	}
+
+	// Codes can only be redeemed once.
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("Exchange succeeded with a redeemed code")
+	}
+}
+
+func TestExchangeChecksPKCE(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("mock")
+	code, _, nonce := signIn(t, server, provider)
+
+	otherVerifier, _, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, nonce); err == nil {
+		t.Error("Exchange succeeded with the wrong code verifier")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("mock")
+	code, verifier, _ := signIn(t, server, provider)
+
+	_, err := provider.Exchange(context.Background(), code, verifier, "another-nonce")
+	if !errors.Is(err, oidc.ErrInvalidToken) {
+		t.Errorf("Exchange = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(server *oidctest.Server, claims jwt.MapClaims)
+	}{
+		{"signed with another key", func(server *oidctest.Server, claims jwt.MapClaims) {
+			server.SigningKey = otherKey
+		}},
+		{"other audience", func(server *oidctest.Server, claims jwt.MapClaims) {
+			claims["aud"] = "someone-else"
+		}},
+		{"other issuer", func(server *oidctest.Server, claims jwt.MapClaims) {
+			claims["iss"] = "https://evil.example.com"
+		}},
+		{"expired", func(server *oidctest.Server, claims jwt.MapClaims) {
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+		}},
+		{"no expiry", func(server *oidctest.Server, claims jwt.MapClaims) {
+			delete(claims, "exp")
+		}},
+		{"no subject", func(server *oidctest.Server, claims jwt.MapClaims) {
+			claims["sub"] = ""
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := oidctest.NewServer(t, "homebuzz")
+			server.Tamper = func(claims jwt.MapClaims) { test.tamper(server, claims) }
+			provider := server.Provider("mock")
+			code, verifier, nonce := signIn(t, server, provider)
+
+			_, err := provider.Exchange(context.Background(), code, verifier, nonce)
+			if !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("Exchange = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyReadsAppleEmailVerified(t *testing.T) {
+	server := oidctest.NewServer(t, "homebuzz")
+	provider := server.Provider("apple")
+
+	for value, want := range map[any]bool{"true": true, "false": false, true: true, nil: false} {
+		token := server.IDToken(jwt.MapClaims{
+			"iss":            server.URL,
+			"aud":            "homebuzz",
+			"sub":            "ada-1815",
+			"email":          "ada@example.com",
+			"email_verified": value,
+			"nonce":          "n",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		identity, err := provider.Verify(context.Background(), token, "n")
+		if err != nil {
+			t.Fatalf("Verify with email_verified %v: %v", value, err)
+		}
+		if identity.EmailVerified != want {
+			t.Errorf("email_verified %#v gives EmailVerified %v, want %v", value, identity.EmailVerified, want)
+		}
+	}
+}
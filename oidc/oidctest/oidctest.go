@@ -0,0 +1,204 @@
+// Package oidctest runs a local OpenID Connect provider for tests, with
+// discovery, a JWKS and a token endpoint that checks PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/in43sh/homebuzz-backend/oidc"
+)
+
+// KeyID is the kid of Server.Key in the JWKS and in ID tokens.
+const KeyID = "test-key"
+
+// User is the account a test signs in with at the provider.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// grant is an authorization code waiting to be redeemed.
+type grant struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Server is a provider for the client with ClientID. ID tokens are signed
+// with SigningKey, which is Key, published in the JWKS, unless a test swaps
+// it. Tamper, when set, may change an ID token's claims before signing.
+type Server struct {
+	*httptest.Server
+	ClientID   string
+	Key        *rsa.PrivateKey
+	SigningKey *rsa.PrivateKey
+	Tamper     func(claims jwt.MapClaims)
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// NewServer starts a provider that is closed when the test ends.
+func NewServer(t testing.TB, clientID string) *Server {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{ClientID: clientID, Key: key, SigningKey: key, grants: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Provider returns a client of the server, named name.
+func (s *Server) Provider(name string) *oidc.Provider {
+	return &oidc.Provider{
+		Name:        name,
+		Issuer:      s.URL,
+		ClientID:    s.ClientID,
+		RedirectURL: "http://localhost:8080/auth/" + name + "/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		Client:      s.Client(),
+	}
+}
+
+// SignIn acts as user signing in at the authorization URL and returns the
+// code and state the provider sends back to the redirect URL.
+func (s *Server) SignIn(t testing.TB, authorizationURL string, user User) (code, state string) {
+	t.Helper()
+
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if got := query.Get("client_id"); got != s.ClientID {
+		t.Fatalf("authorization URL has client_id %q, want %q", got, s.ClientID)
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("authorization URL has code_challenge_method %q, want S256", got)
+	}
+
+	code, err = oidc.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.grants[code] = grant{
+		user:        user,
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+		redirectURI: query.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+	return code, query.Get("state")
+}
+
+// IDToken signs claims as an ID token of the server.
+func (s *Server) IDToken(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	signed, err := token.SignedString(s.SigningKey)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + "/authorize",
+		TokenEndpoint:         s.URL + "/token",
+		JWKSURI:               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kid": KeyID,
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   encode(s.Key.N),
+			"e":   encode(big.NewInt(int64(s.Key.E))),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	grant, ok := s.grants[r.PostForm.Get("code")]
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("client_id") != s.ClientID:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	case !ok,
+		r.PostForm.Get("redirect_uri") != grant.redirectURI,
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            s.ClientID,
+		"sub":            grant.user.Subject,
+		"email":          grant.user.Email,
+		"email_verified": grant.user.EmailVerified,
+		"name":           grant.user.Name,
+		"nonce":          grant.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+	if s.Tamper != nil {
+		s.Tamper(claims)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + grant.user.Subject,
+		"token_type":   "Bearer",
+		"id_token":     s.IDToken(claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,34 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrDeclined is returned when the gateway refuses a charge. Other errors are
+// treated as transient and may be retried.
+var ErrDeclined = errors.New("payment declined")
+
+type Charge struct {
+	OrderID int64
+	UserID  int64
+	Amount  float64
+}
+
+type Result struct {
+	Reference string
+}
+
+// Gateway charges customers for orders. A card processor can be plugged in by
+// implementing it.
+type Gateway interface {
+	Charge(ctx context.Context, charge Charge) (Result, error)
+}
+
+// ManualGateway accepts every charge; the amount is collected on delivery.
+type ManualGateway struct{}
+
+func (ManualGateway) Charge(ctx context.Context, charge Charge) (Result, error) {
+	return Result{Reference: fmt.Sprintf("manual-%d", charge.OrderID)}, nil
+}
@@ -0,0 +1,309 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/in43sh/homebuzz-backend/requestid"
+)
+
+// ContentType is the media type of every error response, from RFC 7807.
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the problem's type URI.
+const typePrefix = "urn:homebuzz:problem:"
+
+// Codes every client can rely on. Handlers use the code of the status unless
+// a more specific one applies.
+const (
+	CodeInvalidInput     = "invalid_input"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodePaymentRequired  = "payment_required"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeGone             = "gone"
+	CodeUnprocessable    = "unprocessable"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+	CodeBadGateway       = "bad_gateway"
+	CodeUnavailable      = "service_unavailable"
+	CodeTimeout          = "timeout"
+
+	CodeInvalidToken        = "invalid_token"
+	CodeInsufficientScope   = "insufficient_scope"
+	CodeEmailNotVerified    = "email_not_verified"
+	CodeImpersonating       = "impersonation_forbidden"
+	CodeAccountDisabled     = "account_disabled"
+	CodeAccountLocked       = "account_locked"
+	CodeWeakPassword        = "weak_password"
+	CodeAlreadyExists       = "already_exists"
+	CodeStoreNotFound       = "store_not_found"
+	CodeCartEmpty           = "cart_empty"
+	CodeOutOfStock          = "out_of_stock"
+	CodeCouponNotFound      = "coupon_not_found"
+	CodeCouponInvalid       = "coupon_invalid"
+	CodeCouponNotApplicable = "coupon_not_applicable"
+	CodeNotDeliverable      = "not_deliverable"
+	CodeBelowMinimumOrder   = "below_minimum_order"
+	CodePaymentDeclined     = "payment_declined"
+	CodeNotAwaitingPayment  = "not_awaiting_payment"
+	CodeSlotUnavailable     = "slot_unavailable"
+	CodeProviderUnavailable = "provider_unavailable"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidInput,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusPaymentRequired:     CodePaymentRequired,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusGone:                CodeGone,
+	http.StatusUnprocessableEntity: CodeUnprocessable,
+	http.StatusTooManyRequests:     CodeTooManyRequests,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusBadGateway:          CodeBadGateway,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+	http.StatusGatewayTimeout:      CodeTimeout,
+}
+
+// Problem is the body of every error response, as described by RFC 7807.
+type Problem struct {
+	// Type identifies the kind of problem, as urn:homebuzz:problem:{code}.
+	Type   string `json:"type" example:"urn:homebuzz:problem:not_found"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	// Detail explains this occurrence of the problem to a person.
+	Detail   string `json:"detail,omitempty" example:"Product not found"`
+	Instance string `json:"instance,omitempty" example:"/products/12"`
+	// Code is the stable, machine-readable kind of problem.
+	Code string `json:"code" example:"not_found"`
+	// RequestID matches the X-Request-ID response header.
+	RequestID string `json:"request_id,omitempty" example:"9f86d081884c7d65"`
+	// Errors lists the invalid fields of a request that failed validation.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a request field that failed validation.
+type FieldError struct {
+	// Field is the path to the field, as in items[0].quantity.
+	Field string `json:"field" example:"price"`
+	// Rule is the validation rule that failed, such as required or gte.
+	Rule    string `json:"rule" example:"gt"`
+	Message string `json:"message" example:"must be greater than 0"`
+}
+
+// Validation errors name fields after their JSON, form or URI key.
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "uri"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+}
+
+// Abort ends the request with a problem of the status's code.
+func Abort(ctx *gin.Context, status int, detail string) {
+	AbortWithCode(ctx, status, statusCode(status), detail)
+}
+
+// AbortWithCode ends the request with a problem of a specific code.
+func AbortWithCode(ctx *gin.Context, status int, code, detail string) {
+	AbortWithFields(ctx, status, code, detail, nil)
+}
+
+// AbortWithFields ends the request with a problem listing the fields at
+// fault. A request whose context has ended was cut off rather than at fault,
+// so it gets a 504 if it ran past its deadline and a 503 if it was cancelled,
+// whatever the handler made of the failed query.
+func AbortWithFields(ctx *gin.Context, status int, code, detail string, fields []FieldError) {
+	switch err := ctx.Request.Context().Err(); {
+	case errors.Is(err, context.DeadlineExceeded):
+		status, code, detail, fields = http.StatusGatewayTimeout, CodeTimeout, "The request took too long", nil
+	case errors.Is(err, context.Canceled):
+		status, code, detail, fields = http.StatusServiceUnavailable, CodeUnavailable, "The request was cancelled", nil
+		ctx.Header("Retry-After", "1")
+	}
+
+	ctx.Header("Content-Type", ContentType)
+	ctx.AbortWithStatusJSON(status, Problem{
+		Type:      typePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  ctx.Request.URL.Path,
+		Code:      code,
+		RequestID: requestid.Get(ctx),
+		Errors:    fields,
+	})
+}
+
+// Invalid ends the request with a 400 for an error from binding the request,
+// listing the fields that failed validation.
+func Invalid(ctx *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fieldErr),
+				Rule:    fieldErr.Tag(),
+				Message: message(fieldErr),
+			})
+		}
+		AbortWithFields(ctx, http.StatusBadRequest, CodeValidationFailed, "Invalid input", fields)
+	case errors.As(err, &typeErr):
+		AbortWithFields(ctx, http.StatusBadRequest, CodeValidationFailed, "Invalid input", []FieldError{{
+			Field:   jsonPath(typeErr.Field),
+			Rule:    "type",
+			Message: "must be " + article(typeErr.Type.Kind().String()),
+		}})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		Abort(ctx, http.StatusBadRequest, "Request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		Abort(ctx, http.StatusBadRequest, "Request body is empty")
+	default:
+		Abort(ctx, http.StatusBadRequest, "Invalid input")
+	}
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidInput
+}
+
+// fieldPath drops the name of the request struct from the field's
+// namespace.
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, ok := strings.Cut(fieldErr.Namespace(), ".")
+	if !ok {
+		return fieldErr.Field()
+	}
+	return path
+}
+
+// jsonPath writes the indexes in a JSON decoding error's field, as in
+// items.0.quantity, the way fieldPath does.
+func jsonPath(field string) string {
+	var path strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil && i > 0 {
+			path.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(part)
+	}
+	return path.String()
+}
+
+// message describes the failed rule to a person.
+func message(fieldErr validator.FieldError) string {
+	param := fieldErr.Param()
+	unit := ""
+	switch fieldErr.Kind() {
+	case reflect.String:
+		unit = "character"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "item"
+	}
+	switch fieldErr.Tag() {
+	case "required", "required_if", "required_with", "required_without":
+		return "is required"
+	case "eq":
+		return "must be " + param
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(param), ", ")
+	case "len":
+		if unit != "" {
+			return "must have exactly " + count(param, unit)
+		}
+		return "must be " + param
+	case "min", "gte":
+		if unit != "" {
+			return "must have at least " + count(param, unit)
+		}
+		return "must be at least " + param
+	case "max", "lte":
+		if unit != "" {
+			return "must have at most " + count(param, unit)
+		}
+		return "must be at most " + param
+	case "gt":
+		return "must be greater than " + param
+	case "lt":
+		return "must be less than " + param
+	case "e164":
+		return "must be a phone number in E.164 format"
+	case "iso3166_1_alpha2":
+		return "must be an ISO 3166-1 alpha-2 country code"
+	case "latitude":
+		return "must be a latitude"
+	case "longitude":
+		return "must be a longitude"
+	case "datetime":
+		return "must be a date in the format " + param
+	default:
+		return "failed the " + fieldErr.Tag() + " rule"
+	}
+}
+
+func count(n, unit string) string {
+	if n == "1" {
+		return n + " " + unit
+	}
+	return n + " " + unit + "s"
+}
+
+func article(kind string) string {
+	switch kind {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "an integer"
+	case "float32", "float64":
+		return "a number"
+	case "bool":
+		return "true or false"
+	case "slice", "array":
+		return "a list"
+	case "struct", "map":
+		return "an object"
+	default:
+		return "a " + kind
+	}
+}
@@ -0,0 +1,160 @@
+package problem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type itemRequest struct {
+	ProductID int64 `json:"product_id" binding:"required"`
+	Quantity  int   `json:"quantity" binding:"gte=1"`
+}
+
+type orderRequest struct {
+	Email   string        `json:"email" binding:"required,email"`
+	Name    string        `json:"name" binding:"min=2,max=5"`
+	Initial string        `json:"initial" binding:"omitempty,len=1"`
+	Kind    string        `json:"kind" binding:"omitempty,oneof=favorites shopping"`
+	Price   float64       `json:"price" binding:"gt=0"`
+	Country string        `json:"country" binding:"omitempty,iso3166_1_alpha2"`
+	Phone   string        `json:"phone" binding:"omitempty,e164"`
+	Website string        `json:"website" binding:"omitempty,url"`
+	Items   []itemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// bind posts body to a handler that binds it to an orderRequest.
+func bind(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/orders", func(ctx *gin.Context) {
+		var request orderRequest
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			Invalid(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	return response
+}
+
+// decode checks that response is a problem of status and returns it.
+func decode(t *testing.T, response *httptest.ResponseRecorder, status int) Problem {
+	t.Helper()
+
+	if response.Code != status {
+		t.Fatalf("status = %d %s, want %d", response.Code, response.Body, status)
+	}
+	if got := response.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(response.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != status || problem.Title != http.StatusText(status) || problem.Type != typePrefix+problem.Code {
+		t.Errorf("problem = %+v doesn't match status %d", problem, status)
+	}
+	return problem
+}
+
+func TestInvalidFields(t *testing.T) {
+	body := `{"email":"not an address","name":"a","initial":"ab","kind":"wish","price":0,
+		"country":"Germany","phone":"030 123","website":"homebuzz","items":[{"product_id":1,"quantity":1},{"quantity":0}]}`
+	problem := decode(t, bind(body), http.StatusBadRequest)
+
+	if problem.Code != CodeValidationFailed || problem.Detail != "Invalid input" || problem.Instance != "/orders" {
+		t.Errorf("problem = %+v", problem)
+	}
+	want := []FieldError{
+		{"email", "email", "must be a valid email address"},
+		{"name", "min", "must have at least 2 characters"},
+		{"initial", "len", "must have exactly 1 character"},
+		{"kind", "oneof", "must be one of: favorites, shopping"},
+		{"price", "gt", "must be greater than 0"},
+		{"country", "iso3166_1_alpha2", "must be an ISO 3166-1 alpha-2 country code"},
+		{"phone", "e164", "must be a phone number in E.164 format"},
+		{"website", "url", "must be a valid URL"},
+		{"items[1].product_id", "required", "is required"},
+		{"items[1].quantity", "gte", "must be at least 1"},
+	}
+	if fmt.Sprint(problem.Errors) != fmt.Sprint(want) {
+		t.Errorf("errors = %v\nwant %v", problem.Errors, want)
+	}
+}
+
+func TestInvalidFieldNames(t *testing.T) {
+	problem := decode(t, bind(`{"name":"abcdef","price":1,"items":[]}`), http.StatusBadRequest)
+
+	want := []FieldError{
+		{"email", "required", "is required"},
+		{"name", "max", "must have at most 5 characters"},
+		{"items", "min", "must have at least 1 item"},
+	}
+	if fmt.Sprint(problem.Errors) != fmt.Sprint(want) {
+		t.Errorf("errors = %v\nwant %v", problem.Errors, want)
+	}
+}
+
+func TestInvalidBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		detail string
+		errors []FieldError
+	}{
+		{"wrong type", `{"price":"cheap"}`, "Invalid input", []FieldError{{"price", "type", "must be a number"}}},
+		{"wrong nested type", `{"items":[{"product_id":1},{"product_id":"two"}]}`, "Invalid input", []FieldError{{"items[1].product_id", "type", "must be an integer"}}},
+		{"list expected", `{"items":{}}`, "Invalid input", []FieldError{{"items", "type", "must be a list"}}},
+		{"not JSON", `{"price":`, "Request body is not valid JSON", nil},
+		{"syntax error", `{"price" 1}`, "Request body is not valid JSON", nil},
+		{"empty", ``, "Request body is empty", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problem := decode(t, bind(test.body), http.StatusBadRequest)
+			if problem.Detail != test.detail {
+				t.Errorf("detail = %q, want %q", problem.Detail, test.detail)
+			}
+			if fmt.Sprint(problem.Errors) != fmt.Sprint(test.errors) {
+				t.Errorf("errors = %v, want %v", problem.Errors, test.errors)
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	tests := []struct {
+		status int
+		code   string
+	}{
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusConflict, CodeConflict},
+		{http.StatusTeapot, CodeInvalidInput},
+		{http.StatusInternalServerError, CodeInternal},
+		{http.StatusNotImplemented, CodeInternal},
+	}
+	for _, test := range tests {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.GET("/products/:id", func(ctx *gin.Context) { Abort(ctx, test.status, "Product not found") })
+
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/products/12", nil))
+
+		problem := decode(t, response, test.status)
+		if problem.Code != test.code || problem.Detail != "Product not found" || problem.Instance != "/products/12" {
+			t.Errorf("Abort(%d) = %+v, want code %s", test.status, problem, test.code)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package promotion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrCouponNotFound  = errors.New("coupon not found")
+	ErrCouponInactive  = errors.New("coupon is not active")
+	ErrCouponExhausted = errors.New("coupon usage limit reached")
+	ErrCouponUserLimit = errors.New("coupon already used the maximum number of times")
+	// ErrCouponNotApplicable means the coupon is valid but its promotion gave
+	// no discount, as when a non-stackable promotion of higher priority won
+	// or the cart is below the promotion's minimum.
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this cart")
+)
+
+// NormalizeCode makes coupon codes case-insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidateCoupon looks up code in the store and checks its schedule and usage limits for
+// userID. When db is a transaction the coupon row is locked so concurrent
+// checkouts cannot exceed the global limit.
+func ValidateCoupon(ctx context.Context, db bun.IDB, storeID int64, code string, userID int64, now time.Time) (*Coupon, error) {
+	coupon := new(Coupon)
+	query := db.NewSelect().
+		Model(coupon).
+		Where("store_id = ?", storeID).
+		Where("code = ?", NormalizeCode(code))
+	if _, ok := db.(bun.Tx); ok {
+		query = query.For("UPDATE")
+	}
+	if err := query.Scan(ctx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+
+	if !coupon.Active || !Scheduled(coupon.StartsAt, coupon.EndsAt, now) {
+		return nil, ErrCouponInactive
+	}
+
+	if coupon.MaxUses > 0 {
+		uses, err := db.NewSelect().
+			Model((*CouponRedemption)(nil)).
+			Where("coupon_id = ?", coupon.ID).
+			Count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if uses >= coupon.MaxUses {
+			return nil, ErrCouponExhausted
+		}
+	}
+
+	if coupon.MaxUsesPerUser > 0 {
+		uses, err := db.NewSelect().
+			Model((*CouponRedemption)(nil)).
+			Where("coupon_id = ?", coupon.ID).
+			Where("user_id = ?", userID).
+			Count(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if uses >= coupon.MaxUsesPerUser {
+			return nil, ErrCouponUserLimit
+		}
+	}
+
+	return coupon, nil
+}
+
+// ActivePromotions loads every promotion of the store currently running.
+func ActivePromotions(ctx context.Context, db bun.IDB, storeID int64, now time.Time) ([]Promotion, error) {
+	var promotions []Promotion
+	err := db.NewSelect().
+		Model(&promotions).
+		Where("store_id = ?", storeID).
+		Where("active = TRUE").
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Scan(ctx)
+	return promotions, err
+}
+
+// Price validates the optional coupon and calculates a quote for items with
+// the store's promotions. A
+// coupon that doesn't end up discounting anything is rejected, so it isn't
+// used up for nothing.
+func Price(ctx context.Context, db bun.IDB, storeID int64, items []Item, couponCode string, userID int64, now time.Time) (Quote, *Coupon, error) {
+	var coupon *Coupon
+	if strings.TrimSpace(couponCode) != "" {
+		var err error
+		coupon, err = ValidateCoupon(ctx, db, storeID, couponCode, userID, now)
+		if err != nil {
+			return Quote{}, nil, err
+		}
+	}
+
+	promotions, err := ActivePromotions(ctx, db, storeID, now)
+	if err != nil {
+		return Quote{}, nil, err
+	}
+
+	quote := Calculate(items, promotions, coupon, now)
+	if coupon != nil && !applied(quote, coupon.Code) {
+		return Quote{}, nil, ErrCouponNotApplicable
+	}
+	return quote, coupon, nil
+}
+
+// applied reports whether the coupon's promotion discounted the quote.
+func applied(quote Quote, code string) bool {
+	for _, discount := range quote.Discounts {
+		if discount.CouponCode == code {
+			return true
+		}
+	}
+	return false
+}
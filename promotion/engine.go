@@ -0,0 +1,255 @@
+package promotion
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Item is a cart line as seen by the engine.
+type Item struct {
+	ProductID    int64
+	ProductTitle string
+	Category     string
+	UnitPrice    float64
+	Quantity     int
+}
+
+type Line struct {
+	ProductID    int64   `json:"product_id" example:"1"`
+	ProductTitle string  `json:"product_title" example:"Whole milk"`
+	UnitPrice    float64 `json:"unit_price" example:"2.5"`
+	Quantity     int     `json:"quantity" example:"3"`
+	Subtotal     float64 `json:"subtotal" example:"7.5"`
+	Discount     float64 `json:"discount" example:"2.5"`
+	Total        float64 `json:"total" example:"5"`
+}
+
+// AppliedDiscount explains one promotion's contribution to a quote.
+type AppliedDiscount struct {
+	PromotionID int64   `json:"promotion_id" example:"1"`
+	Name        string  `json:"name" example:"Milk 3 for 2"`
+	CouponCode  string  `json:"coupon_code,omitempty" example:"SUMMER10"`
+	Amount      float64 `json:"amount" example:"2.5"`
+	Explanation string  `json:"explanation" example:"Buy 2, get 1 free on Whole milk"`
+}
+
+type Quote struct {
+	Lines         []Line            `json:"lines"`
+	Subtotal      float64           `json:"subtotal" example:"7.5"`
+	Discounts     []AppliedDiscount `json:"discounts"`
+	DiscountTotal float64           `json:"discount_total" example:"2.5"`
+	Total         float64           `json:"total" example:"5"`
+}
+
+// Calculate prices items against promotions at the given time.
+//
+// Eligible promotions are applied in descending priority (ties broken by ID).
+// Stackable promotions accumulate. A non-stackable promotion only applies if
+// nothing has been applied before it, and stops evaluation once applied.
+// Minimum cart thresholds are checked against the undiscounted subtotal.
+func Calculate(items []Item, promotions []Promotion, coupon *Coupon, now time.Time) Quote {
+	quote := Quote{Lines: make([]Line, 0, len(items)), Discounts: []AppliedDiscount{}}
+	categories := make([]string, 0, len(items))
+
+	for _, item := range items {
+		subtotal := roundMoney(item.UnitPrice * float64(item.Quantity))
+		quote.Lines = append(quote.Lines, Line{
+			ProductID:    item.ProductID,
+			ProductTitle: item.ProductTitle,
+			UnitPrice:    item.UnitPrice,
+			Quantity:     item.Quantity,
+			Subtotal:     subtotal,
+		})
+		categories = append(categories, item.Category)
+		quote.Subtotal += subtotal
+	}
+	quote.Subtotal = roundMoney(quote.Subtotal)
+
+	eligible := make([]Promotion, 0, len(promotions))
+	for _, p := range promotions {
+		if !p.Active || !Scheduled(p.StartsAt, p.EndsAt, now) {
+			continue
+		}
+		if p.CouponOnly && (coupon == nil || coupon.PromotionID != p.ID) {
+			continue
+		}
+		eligible = append(eligible, p)
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		if eligible[i].Priority != eligible[j].Priority {
+			return eligible[i].Priority > eligible[j].Priority
+		}
+		return eligible[i].ID < eligible[j].ID
+	})
+
+	for _, p := range eligible {
+		if quote.Subtotal < p.MinCartTotal {
+			continue
+		}
+		if !p.Stackable && len(quote.Discounts) > 0 {
+			continue
+		}
+
+		targets := make([]int, 0, len(quote.Lines))
+		for i, line := range quote.Lines {
+			if matches(p, line.ProductID, categories[i]) {
+				targets = append(targets, i)
+			}
+		}
+
+		allocation := allocate(p, quote.Lines, targets)
+		amount := 0.0
+		for i, value := range allocation {
+			quote.Lines[i].Discount = roundMoney(quote.Lines[i].Discount + value)
+			amount += value
+		}
+		amount = roundMoney(amount)
+		if amount <= 0 {
+			continue
+		}
+
+		applied := AppliedDiscount{
+			PromotionID: p.ID,
+			Name:        p.Name,
+			Amount:      amount,
+			Explanation: explain(p, quote.Lines, targets),
+		}
+		if coupon != nil && coupon.PromotionID == p.ID {
+			applied.CouponCode = coupon.Code
+		}
+		quote.Discounts = append(quote.Discounts, applied)
+		quote.DiscountTotal = roundMoney(quote.DiscountTotal + amount)
+
+		if !p.Stackable {
+			break
+		}
+	}
+
+	for i := range quote.Lines {
+		quote.Lines[i].Total = roundMoney(quote.Lines[i].Subtotal - quote.Lines[i].Discount)
+	}
+	quote.Total = roundMoney(quote.Subtotal - quote.DiscountTotal)
+
+	return quote
+}
+
+func matches(p Promotion, productID int64, category string) bool {
+	if p.ProductID != nil {
+		return *p.ProductID == productID
+	}
+	if p.Category != "" {
+		return strings.EqualFold(p.Category, category)
+	}
+	return true
+}
+
+func cartWide(p Promotion) bool {
+	return p.ProductID == nil && p.Category == ""
+}
+
+// allocate returns the discount to add to each line index, never exceeding
+// what is left to pay on that line.
+func allocate(p Promotion, lines []Line, targets []int) map[int]float64 {
+	allocation := make(map[int]float64, len(targets))
+	remaining := func(i int) float64 {
+		return lines[i].Subtotal - lines[i].Discount
+	}
+
+	switch p.Type {
+	case TypePercentage:
+		percent := math.Min(p.Value, 100)
+		for _, i := range targets {
+			allocation[i] = roundMoney(remaining(i) * percent / 100)
+		}
+
+	case TypeFixed:
+		if !cartWide(p) {
+			for _, i := range targets {
+				allocation[i] = roundMoney(math.Min(p.Value*float64(lines[i].Quantity), remaining(i)))
+			}
+			break
+		}
+
+		// A cart-wide fixed amount is spread proportionally over the lines,
+		// the last taking what rounding left over.
+		total := 0.0
+		for _, i := range targets {
+			total += remaining(i)
+		}
+		if total <= 0 {
+			break
+		}
+		amount := roundMoney(math.Min(p.Value, total))
+		left := amount
+		for n, i := range targets {
+			share := roundMoney(amount * remaining(i) / total)
+			if n == len(targets)-1 {
+				share = roundMoney(math.Max(0, math.Min(left, remaining(i))))
+			}
+			allocation[i] = share
+			left = roundMoney(left - share)
+		}
+
+	case TypeBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			break
+		}
+
+		// Free units are taken from the cheapest matching units first.
+		sorted := append([]int(nil), targets...)
+		sort.SliceStable(sorted, func(a, b int) bool {
+			return lines[sorted[a]].UnitPrice < lines[sorted[b]].UnitPrice
+		})
+		units := 0
+		for _, i := range sorted {
+			units += lines[i].Quantity
+		}
+		free := units / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+		for _, i := range sorted {
+			if free == 0 {
+				break
+			}
+			count := min(free, lines[i].Quantity)
+			allocation[i] = roundMoney(math.Min(lines[i].UnitPrice*float64(count), remaining(i)))
+			free -= count
+		}
+	}
+
+	return allocation
+}
+
+func explain(p Promotion, lines []Line, targets []int) string {
+	scope := "your order"
+	switch {
+	case p.ProductID != nil && len(targets) > 0:
+		scope = lines[targets[0]].ProductTitle
+	case p.Category != "":
+		scope = p.Category
+	}
+
+	var explanation string
+	switch p.Type {
+	case TypePercentage:
+		explanation = fmt.Sprintf("%g%% off %s", math.Min(p.Value, 100), scope)
+	case TypeFixed:
+		if cartWide(p) {
+			explanation = fmt.Sprintf("%.2f off %s", p.Value, scope)
+		} else {
+			explanation = fmt.Sprintf("%.2f off each unit of %s", p.Value, scope)
+		}
+	case TypeBuyXGetY:
+		explanation = fmt.Sprintf("Buy %d, get %d free on %s", p.BuyQuantity, p.GetQuantity, scope)
+	}
+
+	if p.MinCartTotal > 0 {
+		explanation += fmt.Sprintf(" (orders over %.2f)", p.MinCartTotal)
+	}
+	return explanation
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,268 @@
+package promotion
+
+import (
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func id(n int64) *int64 {
+	return &n
+}
+
+func at(t time.Time) *time.Time {
+	return &t
+}
+
+var (
+	milk   = Item{ProductID: 1, ProductTitle: "Whole milk", Category: "Dairy", UnitPrice: 2.5, Quantity: 3}
+	cheese = Item{ProductID: 2, ProductTitle: "Cheddar", Category: "Dairy", UnitPrice: 4, Quantity: 1}
+	bread  = Item{ProductID: 3, ProductTitle: "Rye bread", Category: "Bakery", UnitPrice: 3.5, Quantity: 1}
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name       string
+		items      []Item
+		promotions []Promotion
+		coupon     *Coupon
+		// applied are the IDs of the promotions applied, in order.
+		applied []int64
+		// discounts are the discounts of the lines.
+		discounts []float64
+		total     float64
+	}{
+		{
+			name:       "percentage off a product",
+			items:      []Item{milk, bread},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 10, ProductID: id(1), Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{0.75, 0},
+			total:      10.25,
+		},
+		{
+			name:       "percentage off a category, case insensitively",
+			items:      []Item{milk, cheese, bread},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 50, Category: "dairy", Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{3.75, 2, 0},
+			total:      9.25,
+		},
+		{
+			name:       "highest priority non-stackable wins",
+			items:      []Item{milk},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 50, Priority: 1, Active: true}, {ID: 2, Type: TypePercentage, Value: 10, Priority: 5, Active: true}},
+			applied:    []int64{2},
+			discounts:  []float64{0.75},
+			total:      6.75,
+		},
+		{
+			name:       "equal priority goes by ID",
+			items:      []Item{milk},
+			promotions: []Promotion{{ID: 2, Type: TypePercentage, Value: 50, Active: true}, {ID: 1, Type: TypePercentage, Value: 10, Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{0.75},
+			total:      6.75,
+		},
+		{
+			name:  "stackable promotions apply to what is left",
+			items: []Item{milk},
+			promotions: []Promotion{
+				{ID: 1, Type: TypePercentage, Value: 10, Stackable: true, Priority: 2, Active: true},
+				{ID: 2, Type: TypePercentage, Value: 10, Stackable: true, Priority: 1, Active: true},
+			},
+			applied:   []int64{1, 2},
+			discounts: []float64{1.43},
+			total:     6.07,
+		},
+		{
+			name:  "non-stackable is skipped after a stackable one",
+			items: []Item{milk},
+			promotions: []Promotion{
+				{ID: 1, Type: TypePercentage, Value: 10, Stackable: true, Priority: 2, Active: true},
+				{ID: 2, Type: TypePercentage, Value: 50, Priority: 1, Active: true},
+				{ID: 3, Type: TypeFixed, Value: 1, Stackable: true, Active: true},
+			},
+			applied:   []int64{1, 3},
+			discounts: []float64{1.75},
+			total:     5.75,
+		},
+		{
+			name:  "non-stackable stops later stackable ones",
+			items: []Item{milk},
+			promotions: []Promotion{
+				{ID: 1, Type: TypePercentage, Value: 10, Priority: 2, Active: true},
+				{ID: 2, Type: TypePercentage, Value: 10, Stackable: true, Priority: 1, Active: true},
+			},
+			applied:   []int64{1},
+			discounts: []float64{0.75},
+			total:     6.75,
+		},
+		{
+			name:  "promotions without a discount don't block others",
+			items: []Item{milk},
+			promotions: []Promotion{
+				{ID: 1, Type: TypePercentage, Value: 50, ProductID: id(9), Priority: 2, Active: true},
+				{ID: 2, Type: TypePercentage, Value: 10, Priority: 1, Active: true},
+			},
+			applied:   []int64{2},
+			discounts: []float64{0.75},
+			total:     6.75,
+		},
+		{
+			name:  "minimum is checked against the undiscounted subtotal",
+			items: []Item{milk, bread},
+			promotions: []Promotion{
+				{ID: 1, Type: TypeFixed, Value: 2, Stackable: true, Priority: 2, Active: true},
+				{ID: 2, Type: TypeFixed, Value: 1, MinCartTotal: 11, Stackable: true, Priority: 1, Active: true},
+				{ID: 3, Type: TypeFixed, Value: 1, MinCartTotal: 11.01, Stackable: true, Active: true},
+			},
+			applied:   []int64{1, 2},
+			discounts: []float64{2.04, 0.96},
+			total:     8,
+		},
+		{
+			name:  "inactive and unscheduled promotions are ignored",
+			items: []Item{milk},
+			promotions: []Promotion{
+				{ID: 1, Type: TypePercentage, Value: 50, Active: false},
+				{ID: 2, Type: TypePercentage, Value: 50, Active: true, StartsAt: at(now.Add(time.Hour))},
+				{ID: 3, Type: TypePercentage, Value: 50, Active: true, EndsAt: at(now)},
+				{ID: 4, Type: TypePercentage, Value: 10, Active: true, StartsAt: at(now), EndsAt: at(now.Add(time.Hour))},
+			},
+			applied:   []int64{4},
+			discounts: []float64{0.75},
+			total:     6.75,
+		},
+		{
+			name:       "coupon-only promotions need their coupon",
+			items:      []Item{milk},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 10, CouponOnly: true, Active: true}},
+			coupon:     &Coupon{Code: "OTHER", PromotionID: 2},
+			applied:    []int64{},
+			discounts:  []float64{0},
+			total:      7.5,
+		},
+		{
+			name:       "buy 2 get 1 frees the cheapest units",
+			items:      []Item{milk, cheese, {ProductID: 4, ProductTitle: "Butter", Category: "Dairy", UnitPrice: 1.99, Quantity: 2}},
+			promotions: []Promotion{{ID: 1, Type: TypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1, Category: "Dairy", Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{0, 0, 3.98},
+			total:      11.5,
+		},
+		{
+			name:       "fixed discount per unit is capped at the line",
+			items:      []Item{milk, bread},
+			promotions: []Promotion{{ID: 1, Type: TypeFixed, Value: 3, ProductID: id(1), Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{7.5, 0},
+			total:      3.5,
+		},
+		{
+			name:       "percentages over 100 are capped",
+			items:      []Item{bread},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 150, Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{3.5},
+			total:      0,
+		},
+		{
+			name:       "percentages round per line",
+			items:      []Item{{ProductID: 1, UnitPrice: 0.35, Quantity: 3}, {ProductID: 2, UnitPrice: 0.35, Quantity: 3}},
+			promotions: []Promotion{{ID: 1, Type: TypePercentage, Value: 15, Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{0.16, 0.16},
+			total:      1.78,
+		},
+		{
+			name:       "cart-wide fixed amounts are split without losing cents",
+			items:      []Item{{ProductID: 1, UnitPrice: 5}, {ProductID: 2, UnitPrice: 5}, {ProductID: 3, UnitPrice: 5}},
+			promotions: []Promotion{{ID: 1, Type: TypeFixed, Value: 10, Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{3.33, 3.33, 3.34},
+			total:      5,
+		},
+		{
+			name:       "cart-wide fixed amounts are capped at the cart",
+			items:      []Item{bread},
+			promotions: []Promotion{{ID: 1, Type: TypeFixed, Value: 10, Active: true}},
+			applied:    []int64{1},
+			discounts:  []float64{3.5},
+			total:      0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := range test.items {
+				if test.items[i].Quantity == 0 {
+					test.items[i].Quantity = 1
+				}
+			}
+			quote := Calculate(test.items, test.promotions, test.coupon, now)
+
+			applied := make([]int64, 0, len(quote.Discounts))
+			sum := 0.0
+			for _, discount := range quote.Discounts {
+				applied = append(applied, discount.PromotionID)
+				sum += discount.Amount
+			}
+			if !equal(applied, test.applied) {
+				t.Errorf("applied %v, want %v", applied, test.applied)
+			}
+
+			lineDiscounts := 0.0
+			for i, line := range quote.Lines {
+				if line.Discount != test.discounts[i] {
+					t.Errorf("line %d discount = %v, want %v", i, line.Discount, test.discounts[i])
+				}
+				if want := roundMoney(line.Subtotal - line.Discount); line.Total != want {
+					t.Errorf("line %d total = %v, want %v", i, line.Total, want)
+				}
+				lineDiscounts += line.Discount
+			}
+
+			if quote.Total != test.total {
+				t.Errorf("total = %v, want %v", quote.Total, test.total)
+			}
+			if roundMoney(sum) != quote.DiscountTotal || roundMoney(lineDiscounts) != quote.DiscountTotal {
+				t.Errorf("discounts %v and line discounts %v don't add up to %v", sum, lineDiscounts, quote.DiscountTotal)
+			}
+		})
+	}
+}
+
+func TestCalculateNamesCoupon(t *testing.T) {
+	promotions := []Promotion{
+		{ID: 1, Name: "Welcome", Type: TypePercentage, Value: 10, CouponOnly: true, Stackable: true, Active: true},
+		{ID: 2, Name: "Dairy week", Type: TypeFixed, Value: 0.5, Category: "Dairy", MinCartTotal: 5, Stackable: true, Active: true},
+	}
+	quote := Calculate([]Item{milk}, promotions, &Coupon{Code: "WELCOME", PromotionID: 1}, now)
+
+	want := []AppliedDiscount{
+		{PromotionID: 1, Name: "Welcome", CouponCode: "WELCOME", Amount: 0.75, Explanation: "10% off your order"},
+		{PromotionID: 2, Name: "Dairy week", Amount: 1.5, Explanation: "0.50 off each unit of Dairy (orders over 5.00)"},
+	}
+	if len(quote.Discounts) != len(want) {
+		t.Fatalf("discounts = %+v, want %+v", quote.Discounts, want)
+	}
+	for i := range want {
+		if quote.Discounts[i] != want[i] {
+			t.Errorf("discount %d = %+v, want %+v", i, quote.Discounts[i], want[i])
+		}
+	}
+}
+
+func equal(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
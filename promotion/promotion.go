@@ -0,0 +1,67 @@
+package promotion
+
+import "time"
+
+const (
+	TypePercentage = "percentage"
+	TypeFixed      = "fixed"
+	TypeBuyXGetY   = "buy_x_get_y"
+)
+
+// Promotion describes a discount rule. A promotion targets a single product
+// when ProductID is set, a category when Category is set, and the whole cart
+// otherwise. Promotions linked to a coupon only apply when that coupon is used.
+type Promotion struct {
+	ID           int64      `bun:",pk,autoincrement" json:"id"`
+	StoreID      int64      `bun:"store_id,notnull" json:"-"`
+	Name         string     `bun:"name,notnull" json:"name" binding:"required" example:"Summer sale"`
+	Type         string     `bun:"type,notnull" json:"type" binding:"required,oneof=percentage fixed buy_x_get_y" example:"percentage"`
+	Value        float64    `bun:"value,notnull,default:0" json:"value" binding:"gte=0" example:"10"`
+	ProductID    *int64     `bun:"product_id" json:"product_id,omitempty"`
+	Category     string     `bun:"category,notnull,default:''" json:"category" example:"Dairy"`
+	BuyQuantity  int        `bun:"buy_quantity,notnull,default:0" json:"buy_quantity" binding:"gte=0"`
+	GetQuantity  int        `bun:"get_quantity,notnull,default:0" json:"get_quantity" binding:"gte=0"`
+	MinCartTotal float64    `bun:"min_cart_total,notnull,default:0" json:"min_cart_total" binding:"gte=0"`
+	Stackable    bool       `bun:"stackable,notnull,default:false" json:"stackable"`
+	Priority     int        `bun:"priority,notnull,default:0" json:"priority"`
+	CouponOnly   bool       `bun:"coupon_only,notnull,default:false" json:"coupon_only"`
+	Active       bool       `bun:"active,notnull,default:true" json:"active"`
+	StartsAt     *time.Time `bun:"starts_at" json:"starts_at,omitempty"`
+	EndsAt       *time.Time `bun:"ends_at" json:"ends_at,omitempty"`
+	CreatedAt    time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Coupon unlocks a coupon-only promotion. Zero limits mean unlimited. Codes
+// are unique within a store.
+type Coupon struct {
+	ID             int64      `bun:",pk,autoincrement" json:"id"`
+	StoreID        int64      `bun:"store_id,notnull" json:"-"`
+	Code           string     `bun:"code,notnull" json:"code" binding:"required" example:"SUMMER10"`
+	PromotionID    int64      `bun:"promotion_id,notnull" json:"promotion_id" binding:"required"`
+	MaxUses        int        `bun:"max_uses,notnull,default:0" json:"max_uses" binding:"gte=0"`
+	MaxUsesPerUser int        `bun:"max_uses_per_user,notnull,default:0" json:"max_uses_per_user" binding:"gte=0"`
+	Active         bool       `bun:"active,notnull,default:true" json:"active"`
+	StartsAt       *time.Time `bun:"starts_at" json:"starts_at,omitempty"`
+	EndsAt         *time.Time `bun:"ends_at" json:"ends_at,omitempty"`
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// CouponRedemption records a coupon being used on an order.
+type CouponRedemption struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	CouponID  int64     `bun:"coupon_id,notnull" json:"coupon_id"`
+	UserID    int64     `bun:"user_id,notnull" json:"user_id"`
+	OrderID   int64     `bun:"order_id,notnull" json:"order_id"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Scheduled reports whether now falls within the optional start/end window.
+func Scheduled(startsAt, endsAt *time.Time, now time.Time) bool {
+	if startsAt != nil && now.Before(*startsAt) {
+		return false
+	}
+	if endsAt != nil && !now.Before(*endsAt) {
+		return false
+	}
+	return true
+}
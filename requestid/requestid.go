@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carries the ID of a request, taken from the client or generated, so
+// log entries and error responses can be matched with it.
+const Header = "X-Request-ID"
+
+const contextKey = "requestID"
+
+// Middleware gives every request an ID, keeping one sent by the client in
+// X-Request-ID, and echoes it in the response.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(Header)
+		if id == "" || len(id) > 128 {
+			buf := make([]byte, 8)
+			_, _ = rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+		ctx.Set(contextKey, id)
+		ctx.Header(Header, id)
+		ctx.Next()
+	}
+}
+
+// Get returns the ID Middleware gave the request.
+func Get(ctx *gin.Context) string {
+	return ctx.GetString(contextKey)
+}
@@ -0,0 +1,347 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/delivery"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+type Address struct {
+	ID         int64     `bun:",pk,autoincrement" json:"id"`
+	UserID     int64     `bun:"user_id,notnull" json:"user_id"`
+	Label      string    `bun:"label,notnull,default:''" json:"label" binding:"max=50" example:"Home"`
+	Recipient  string    `bun:"recipient,notnull" json:"recipient" binding:"required,max=100" example:"John Doe"`
+	Line1      string    `bun:"line1,notnull" json:"line1" binding:"required,max=200" example:"Invalidenstraße 1"`
+	Line2      string    `bun:"line2,notnull,default:''" json:"line2" binding:"max=200"`
+	City       string    `bun:"city,notnull" json:"city" binding:"required,max=100" example:"Berlin"`
+	Region     string    `bun:"region,notnull,default:''" json:"region" binding:"max=100"`
+	PostalCode string    `bun:"postal_code,notnull" json:"postal_code" binding:"required,max=20" example:"10115"`
+	Country    string    `bun:"country,notnull" json:"country" binding:"required,iso3166_1_alpha2" example:"DE"`
+	Phone      string    `bun:"phone,notnull,default:''" json:"phone" binding:"omitempty,e164" example:"+4930123456"`
+	Latitude   *float64  `bun:"latitude" json:"latitude" binding:"omitempty,latitude" example:"52.5321"`
+	Longitude  *float64  `bun:"longitude" json:"longitude" binding:"omitempty,longitude" example:"13.3849"`
+	IsDefault  bool      `bun:"is_default,notnull,default:false" json:"is_default"`
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Address deleted successfully!"`
+}
+
+// postalCodePatterns validates postal codes of the countries we know about.
+// Other countries only get a generic sanity check.
+var postalCodePatterns = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+}
+
+var genericPostalCode = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+func validateAddress(address *Address) string {
+	address.Country = strings.ToUpper(address.Country)
+	address.PostalCode = strings.ToUpper(strings.TrimSpace(address.PostalCode))
+
+	pattern, ok := postalCodePatterns[address.Country]
+	if !ok {
+		pattern = genericPostalCode
+	}
+	if !pattern.MatchString(address.PostalCode) {
+		return "Invalid postal code for " + address.Country
+	}
+	if (address.Latitude == nil) != (address.Longitude == nil) {
+		return "latitude and longitude must be given together"
+	}
+	return ""
+}
+
+// Location returns the parts of the address used for delivery zone lookups.
+func (a *Address) Location() delivery.Location {
+	return delivery.Location{
+		Country:    a.Country,
+		PostalCode: a.PostalCode,
+		Latitude:   a.Latitude,
+		Longitude:  a.Longitude,
+	}
+}
+
+// FindAddress loads one of the user's addresses, or their default address
+// when addressID is nil.
+func FindAddress(ctx context.Context, db bun.IDB, userID int64, addressID *int64) (*Address, error) {
+	address := new(Address)
+	query := db.NewSelect().
+		Model(address).
+		Where("user_id = ?", userID)
+	if addressID != nil {
+		query = query.Where("id = ?", *addressID)
+	} else {
+		query = query.Where("is_default = TRUE")
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// clearDefault unsets the user's current default address.
+func clearDefault(ctx context.Context, tx bun.Tx, userID int64) error {
+	_, err := tx.NewUpdate().
+		Model((*Address)(nil)).
+		Set("is_default = FALSE").
+		Where("user_id = ?", userID).
+		Where("is_default = TRUE").
+		Exec(ctx)
+	return err
+}
+
+// @Summary Get my addresses
+// @Description Retrieve the current user's address book, default address first
+// @Tags Addresses
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of addresses"
+// @Failure 500 {object} problem.Problem "Couldn't fetch addresses"
+// @Router /addresses [get]
+func GetAddresses(ctx *gin.Context) {
+	var addresses []Address
+
+	err := database.BunDB.NewSelect().
+		Model(&addresses).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("is_default DESC", "id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch addresses")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"addresses": addresses})
+}
+
+// @Summary Add an address
+// @Description Add an address to the current user's address book. The first address becomes the default.
+// @Tags Addresses
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param address body Address true "Address"
+// @Success 201 {object} Address
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not save address"
+// @Router /addresses [post]
+func AddAddress(ctx *gin.Context) {
+	var address Address
+
+	if err := ctx.ShouldBindJSON(&address); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateAddress(&address); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	address.UserID = auth.CurrentClaims(ctx).UserID
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		count, err := tx.NewSelect().
+			Model((*Address)(nil)).
+			Where("user_id = ?", address.UserID).
+			Count(c)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+		if address.IsDefault {
+			if err := clearDefault(c, tx, address.UserID); err != nil {
+				return err
+			}
+		}
+		_, err = tx.NewInsert().Model(&address).Returning("*").Exec(c)
+		return err
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not save address")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, address)
+}
+
+// @Summary Update an address
+// @Description Replace one of the current user's addresses
+// @Tags Addresses
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Address ID"
+// @Param address body Address true "Address"
+// @Success 200 {object} Address
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Address not found"
+// @Failure 500 {object} problem.Problem "Could not save address"
+// @Router /addresses/{id} [put]
+func UpdateAddress(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+
+	existing := new(Address)
+	err := database.BunDB.NewSelect().
+		Model(existing).
+		Where("id = ?", ctx.Param("id")).
+		Where("user_id = ?", userID).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Address not found")
+		return
+	}
+
+	var address Address
+	if err := ctx.ShouldBindJSON(&address); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateAddress(&address); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	address.ID = existing.ID
+	address.UserID = userID
+	address.CreatedAt = existing.CreatedAt
+	// The default can only be moved, never removed, so every user with
+	// addresses keeps exactly one.
+	address.IsDefault = address.IsDefault || existing.IsDefault
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if address.IsDefault && !existing.IsDefault {
+			if err := clearDefault(c, tx, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewUpdate().Model(&address).WherePK().Exec(c)
+		return err
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not save address")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, address)
+}
+
+// @Summary Set the default address
+// @Description Make one of the current user's addresses the default shipping address
+// @Tags Addresses
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Address ID"
+// @Success 200 {object} SuccessResponse "Default address updated"
+// @Failure 404 {object} problem.Problem "Address not found"
+// @Failure 500 {object} problem.Problem "Could not update default address"
+// @Router /addresses/{id}/default [post]
+func SetDefaultAddress(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+
+	var rowsAffected int64
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*Address)(nil)).
+			Where("id = ?", ctx.Param("id")).
+			Where("user_id = ?", userID).
+			Exists(c)
+		if err != nil || !exists {
+			return err
+		}
+		if err := clearDefault(c, tx, userID); err != nil {
+			return err
+		}
+		result, err := tx.NewUpdate().
+			Model((*Address)(nil)).
+			Set("is_default = TRUE").
+			Where("id = ?", ctx.Param("id")).
+			Where("user_id = ?", userID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		rowsAffected, _ = result.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update default address")
+		return
+	}
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Address not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Default address updated"})
+}
+
+// @Summary Delete an address
+// @Description Delete one of the current user's addresses. If it was the default, the oldest remaining address becomes the default.
+// @Tags Addresses
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Address ID"
+// @Success 200 {object} SuccessResponse "Address deleted successfully!"
+// @Failure 404 {object} problem.Problem "Address not found"
+// @Failure 500 {object} problem.Problem "Failed to delete address"
+// @Router /addresses/{id} [delete]
+func DeleteAddress(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+
+	deleted := new(Address)
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(deleted).
+			Where("id = ?", ctx.Param("id")).
+			Where("user_id = ?", userID).
+			For("UPDATE").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.NewDelete().Model(deleted).WherePK().Exec(c); err != nil {
+			return err
+		}
+		if !deleted.IsDefault {
+			return nil
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*Address)(nil)).
+			Set("is_default = TRUE").
+			Where("id = (SELECT MIN(id) FROM addresses WHERE user_id = ?)", userID).
+			Exec(c)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Address not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete address")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Address deleted successfully!"})
+}
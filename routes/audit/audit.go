@@ -0,0 +1,130 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// maxPerPage caps the page size of audit log queries.
+const maxPerPage = 200
+
+// AuditLogResponse is a page of audit log entries, newest first.
+type AuditLogResponse struct {
+	Entries []audit.Entry `json:"entries"`
+	Page    int           `json:"page" example:"1"`
+	PerPage int           `json:"per_page" example:"50"`
+	Total   int           `json:"total" example:"1042"`
+}
+
+type VerificationResponse struct {
+	Valid   bool `json:"valid" example:"true"`
+	Checked int  `json:"checked" example:"1042"`
+	// BrokenAt is the first entry that was changed, removed or inserted out
+	// of order.
+	BrokenAt *int64 `json:"broken_at,omitempty" example:"977"`
+}
+
+// @Summary Query the audit log
+// @Description Page through the audit log, newest first. Every filter is optional.
+// @Tags Audit
+// @Produce  json
+// @Security BearerAuth
+// @Param actor_id query int false "User who took the action"
+// @Param impersonator_id query int false "Admin who took the action while impersonating the user"
+// @Param action query string false "Action" example(product.delete)
+// @Param target_type query string false "Target type" example(product)
+// @Param target_id query string false "Target ID"
+// @Param request_id query string false "Request ID"
+// @Param from query string false "Earliest time, RFC 3339" example(2026-10-01T00:00:00Z)
+// @Param to query string false "Latest time, RFC 3339" example(2026-10-19T00:00:00Z)
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Entries per page, at most 200" default(50)
+// @Success 200 {object} AuditLogResponse
+// @Failure 400 {object} problem.Problem "Invalid filter"
+// @Failure 500 {object} problem.Problem "Couldn't fetch the audit log"
+// @Router /audit-log [get]
+func GetAuditLog(ctx *gin.Context) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid page")
+		return
+	}
+	perPage, err := strconv.Atoi(ctx.DefaultQuery("per_page", "50"))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		problem.Abort(ctx, http.StatusBadRequest, "per_page must be between 1 and "+strconv.Itoa(maxPerPage))
+		return
+	}
+
+	var entries []audit.Entry
+	query := database.BunDB.NewSelect().Model(&entries)
+
+	for _, column := range []string{"actor_id", "impersonator_id"} {
+		if value := ctx.Query(column); value != "" {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				problem.Abort(ctx, http.StatusBadRequest, "Invalid "+column)
+				return
+			}
+			query.Where("? = ?", bun.Ident(column), id)
+		}
+	}
+	for _, column := range []string{"action", "target_type", "target_id", "request_id"} {
+		if value := ctx.Query(column); value != "" {
+			query.Where("? = ?", bun.Ident(column), value)
+		}
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<="} {
+		if value := ctx.Query(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				problem.Abort(ctx, http.StatusBadRequest, "Invalid "+param+", use RFC 3339")
+				return
+			}
+			query.Where("created_at "+op+" ?", at)
+		}
+	}
+
+	total, err := query.
+		Order("id DESC").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		ScanAndCount(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch the audit log")
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	ctx.JSON(http.StatusOK, AuditLogResponse{Entries: entries, Page: page, PerPage: perPage, Total: total})
+}
+
+// @Summary Verify the audit log
+// @Description Recompute the hash chain of the whole audit log and report the first entry that was tampered with, if any
+// @Tags Audit
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} VerificationResponse
+// @Failure 500 {object} problem.Problem "Couldn't verify the audit log"
+// @Router /audit-log/verify [get]
+func VerifyAuditLog(ctx *gin.Context) {
+	checked, brokenAt, err := audit.Verify(ctx.Request.Context(), database.BunDB)
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't verify the audit log")
+		return
+	}
+
+	response := VerificationResponse{Valid: brokenAt == 0, Checked: checked}
+	if brokenAt != 0 {
+		response.BrokenAt = &brokenAt
+	}
+	ctx.JSON(http.StatusOK, response)
+}
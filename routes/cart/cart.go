@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/promotion"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/uptrace/bun"
+)
+
+type CartItem struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	UserID    int64     `bun:"user_id,notnull" json:"user_id"`
+	ProductID int64     `bun:"product_id,notnull" json:"product_id" binding:"required" example:"1"`
+	Quantity  int       `bun:"quantity,notnull" json:"quantity" binding:"required,gte=1" example:"2"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Cart updated successfully!"`
+}
+
+// Items loads the user's cart in a store as priceable engine items. A cart
+// holds products from every store the user shops in, and each store only
+// sees and sells its own.
+func Items(ctx context.Context, db bun.IDB, storeID, userID int64) ([]promotion.Item, error) {
+	var cartItems []CartItem
+	err := db.NewSelect().
+		Model(&cartItems).
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil || len(cartItems) == 0 {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(cartItems))
+	for _, item := range cartItems {
+		ids = append(ids, item.ProductID)
+	}
+
+	var products []productRoutes.Product
+	err = db.NewSelect().
+		Model(&products).
+		Where("id IN (?)", bun.In(ids)).
+		Where("store_id = ?", storeID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]productRoutes.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	items := make([]promotion.Item, 0, len(cartItems))
+	for _, cartItem := range cartItems {
+		product, ok := byID[cartItem.ProductID]
+		if !ok {
+			continue
+		}
+		items = append(items, promotion.Item{
+			ProductID:    product.ID,
+			ProductTitle: product.ProductTitle,
+			Category:     product.Category,
+			UnitPrice:    product.Price,
+			Quantity:     cartItem.Quantity,
+		})
+	}
+	return items, nil
+}
+
+// CouponErrorStatus maps coupon validation errors to an HTTP status, problem
+// code and message.
+func CouponErrorStatus(err error) (int, string, string) {
+	switch {
+	case errors.Is(err, promotion.ErrCouponNotFound):
+		return http.StatusNotFound, problem.CodeCouponNotFound, "Coupon not found"
+	case errors.Is(err, promotion.ErrCouponInactive),
+		errors.Is(err, promotion.ErrCouponExhausted),
+		errors.Is(err, promotion.ErrCouponUserLimit):
+		return http.StatusUnprocessableEntity, problem.CodeCouponInvalid, "Coupon cannot be used: " + err.Error()
+	case errors.Is(err, promotion.ErrCouponNotApplicable):
+		return http.StatusUnprocessableEntity, problem.CodeCouponNotApplicable, "Coupon cannot be used: " + err.Error()
+	default:
+		return http.StatusInternalServerError, problem.CodeInternal, "Couldn't price cart"
+	}
+}
+
+// @Summary Get the cart
+// @Description Retrieve the current user's cart in the current store with totals and a breakdown of every discount applied
+// @Tags Cart
+// @Produce  json
+// @Security BearerAuth
+// @Param coupon query string false "Coupon code to apply"
+// @Success 200 {object} promotion.Quote
+// @Failure 404 {object} problem.Problem "Coupon not found"
+// @Failure 422 {object} problem.Problem "Coupon cannot be used"
+// @Failure 500 {object} problem.Problem "Couldn't price cart"
+// @Router /cart [get]
+func GetCart(ctx *gin.Context) {
+	claims := auth.CurrentClaims(ctx)
+
+	items, err := Items(ctx.Request.Context(), database.BunDB, store.ID(ctx), claims.UserID)
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch cart")
+		return
+	}
+
+	quote, _, err := promotion.Price(ctx.Request.Context(), database.BunDB, store.ID(ctx), items, ctx.Query("coupon"), claims.UserID, time.Now())
+	if err != nil {
+		status, code, msg := CouponErrorStatus(err)
+		problem.AbortWithCode(ctx, status, code, msg)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, quote)
+}
+
+// @Summary Add a product to the cart
+// @Description Add a product to the current user's cart, replacing its quantity if it is already there
+// @Tags Cart
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param item body CartItem true "Product and quantity"
+// @Success 200 {object} SuccessResponse "Cart updated successfully!"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 409 {object} problem.Problem "Not enough stock"
+// @Failure 500 {object} problem.Problem "Could not update cart"
+// @Router /cart/items [post]
+func AddCartItem(ctx *gin.Context) {
+	var item CartItem
+
+	if err := ctx.ShouldBindJSON(&item); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	item.UserID = auth.CurrentClaims(ctx).UserID
+
+	product := new(productRoutes.Product)
+	err := database.BunDB.NewSelect().
+		Model(product).
+		Where("id = ?", item.ProductID).
+		Where("store_id = ?", store.ID(ctx)).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+	if !product.InStock(item.Quantity) {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeOutOfStock, "Not enough stock")
+		return
+	}
+
+	_, err = database.BunDB.NewInsert().
+		Model(&item).
+		On("CONFLICT (user_id, product_id) DO UPDATE").
+		Set("quantity = EXCLUDED.quantity").
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update cart")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Cart updated successfully!"})
+}
+
+// @Summary Remove a product from the cart
+// @Description Remove a product from the current user's cart
+// @Tags Cart
+// @Produce  json
+// @Security BearerAuth
+// @Param product_id path int64 true "Product ID"
+// @Success 200 {object} SuccessResponse "Item removed from cart"
+// @Failure 404 {object} problem.Problem "Item not in cart"
+// @Failure 500 {object} problem.Problem "Failed to remove item"
+// @Router /cart/items/{product_id} [delete]
+func RemoveCartItem(ctx *gin.Context) {
+	productID := ctx.Param("product_id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*CartItem)(nil)).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Where("product_id = ?", productID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to remove item")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Item not in cart")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Item removed from cart"})
+}
@@ -0,0 +1,255 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/delivery"
+	"github.com/in43sh/homebuzz-backend/problem"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/uptrace/bun"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Delivery zone deleted successfully!"`
+}
+
+type DeliverabilityResponse struct {
+	Deliverable bool           `json:"deliverable" example:"true"`
+	Zone        *delivery.Zone `json:"zone,omitempty"`
+	Fee         float64        `json:"fee" example:"3.99"`
+	MinOrder    float64        `json:"min_order" example:"25"`
+}
+
+// storeZones selects the IDs of the current store's delivery zones.
+func storeZones(ctx *gin.Context) *bun.SelectQuery {
+	return database.BunDB.NewSelect().
+		Model((*delivery.Zone)(nil)).
+		Column("id").
+		Where("store_id = ?", store.ID(ctx))
+}
+
+func validateZone(zone *delivery.Zone) string {
+	zone.Country = strings.ToUpper(zone.Country)
+	if len(zone.PostalCodes) == 0 && zone.Polygon == nil {
+		return "A zone needs postal_codes or a polygon"
+	}
+	if zone.Polygon != nil {
+		if err := zone.Polygon.Validate(); err != nil {
+			return "Invalid polygon: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// @Summary Create a delivery zone
+// @Description Create a delivery zone of the current store from a list of postal codes and/or a GeoJSON polygon
+// @Tags Delivery
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param zone body delivery.Zone true "Delivery zone"
+// @Success 201 {object} delivery.Zone
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create delivery zone"
+// @Router /delivery/zones [post]
+func CreateZone(ctx *gin.Context) {
+	zone := delivery.Zone{Active: true}
+
+	if err := ctx.ShouldBindJSON(&zone); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateZone(&zone); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	zone.StoreID = store.ID(ctx)
+
+	_, err := database.BunDB.NewInsert().Model(&zone).Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create delivery zone")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, zone)
+}
+
+// @Summary Get all delivery zones
+// @Description Retrieve every delivery zone of the current store
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of delivery zones"
+// @Failure 500 {object} problem.Problem "Couldn't fetch delivery zones"
+// @Router /delivery/zones [get]
+func GetZones(ctx *gin.Context) {
+	var zones []delivery.Zone
+
+	err := database.BunDB.NewSelect().
+		Model(&zones).
+		Where("store_id = ?", store.ID(ctx)).
+		Order("id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch delivery zones")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"zones": zones})
+}
+
+// @Summary Update a delivery zone
+// @Description Replace an existing delivery zone
+// @Tags Delivery
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Zone ID"
+// @Param zone body delivery.Zone true "Delivery zone"
+// @Success 200 {object} delivery.Zone
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Delivery zone not found"
+// @Failure 500 {object} problem.Problem "Could not update delivery zone"
+// @Router /delivery/zones/{id} [put]
+func UpdateZone(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Delivery zone not found")
+		return
+	}
+
+	zone := delivery.Zone{Active: true}
+	if err := ctx.ShouldBindJSON(&zone); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateZone(&zone); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	zone.ID = id
+	zone.StoreID = store.ID(ctx)
+
+	result, err := database.BunDB.NewUpdate().
+		Model(&zone).
+		WherePK().
+		Where("store_id = ?", zone.StoreID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update delivery zone")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Delivery zone not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, zone)
+}
+
+// @Summary Delete a delivery zone by ID
+// @Description Delete a delivery zone
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Zone ID"
+// @Success 200 {object} SuccessResponse "Delivery zone deleted successfully!"
+// @Failure 404 {object} problem.Problem "Delivery zone not found"
+// @Failure 500 {object} problem.Problem "Failed to delete delivery zone"
+// @Router /delivery/zones/{id} [delete]
+func DeleteZone(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*delivery.Zone)(nil)).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete delivery zone")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Delivery zone not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Delivery zone deleted successfully!"})
+}
+
+// @Summary Check whether an address is deliverable
+// @Description Check a saved address (address_id) or an ad-hoc location (country, postal_code and optional coordinates) against the current store's delivery zones, returning the delivery fee and minimum order
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param address_id query int64 false "Saved address ID"
+// @Param country query string false "ISO 3166-1 alpha-2 country code"
+// @Param postal_code query string false "Postal code"
+// @Param lat query number false "Latitude"
+// @Param lng query number false "Longitude"
+// @Success 200 {object} DeliverabilityResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Address not found"
+// @Failure 500 {object} problem.Problem "Couldn't check delivery zones"
+// @Router /delivery/check [get]
+func CheckDeliverability(ctx *gin.Context) {
+	var location delivery.Location
+
+	if addressID := ctx.Query("address_id"); addressID != "" {
+		id, err := strconv.ParseInt(addressID, 10, 64)
+		if err != nil {
+			problem.Abort(ctx, http.StatusBadRequest, "Invalid address_id")
+			return
+		}
+		address, err := addressRoutes.FindAddress(ctx.Request.Context(), database.BunDB, auth.CurrentClaims(ctx).UserID, &id)
+		if err != nil {
+			problem.Abort(ctx, http.StatusNotFound, "Address not found")
+			return
+		}
+		location = address.Location()
+	} else {
+		location = delivery.Location{Country: ctx.Query("country"), PostalCode: ctx.Query("postal_code")}
+		if location.Country == "" || (location.PostalCode == "" && ctx.Query("lat") == "") {
+			problem.Abort(ctx, http.StatusBadRequest, "Provide address_id, or country with postal_code or lat/lng")
+			return
+		}
+		if lat, lng := ctx.Query("lat"), ctx.Query("lng"); lat != "" || lng != "" {
+			latitude, latErr := strconv.ParseFloat(lat, 64)
+			longitude, lngErr := strconv.ParseFloat(lng, 64)
+			if latErr != nil || lngErr != nil {
+				problem.Abort(ctx, http.StatusBadRequest, "Invalid coordinates")
+				return
+			}
+			location.Latitude, location.Longitude = &latitude, &longitude
+		}
+	}
+
+	zone, err := delivery.FindZone(ctx.Request.Context(), database.BunDB, store.ID(ctx), location)
+	if errors.Is(err, delivery.ErrNotDeliverable) {
+		ctx.JSON(http.StatusOK, DeliverabilityResponse{Deliverable: false})
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't check delivery zones")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, DeliverabilityResponse{
+		Deliverable: true,
+		Zone:        zone,
+		Fee:         zone.Fee,
+		MinOrder:    zone.MinOrder,
+	})
+}
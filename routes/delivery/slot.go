@@ -0,0 +1,344 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/delivery"
+	"github.com/in43sh/homebuzz-backend/problem"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/uptrace/bun"
+)
+
+// SlotDays is how far ahead slots are generated from templates and offered.
+const SlotDays = 14
+
+type AvailableSlot struct {
+	delivery.Slot
+	Available int `json:"available" example:"5"`
+}
+
+// holdDuration is how long a reserved slot is kept before checkout,
+// configured with SLOT_HOLD_MINUTES.
+func holdDuration() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("SLOT_HOLD_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 10
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// @Summary Get available delivery slots
+// @Description Retrieve the current store's upcoming delivery slots with free capacity for a saved address, or the default address
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param address_id query int64 false "Saved address ID"
+// @Success 200 {object} map[string]interface{} "List of slots"
+// @Failure 404 {object} problem.Problem "Address not found"
+// @Failure 422 {object} problem.Problem "Address is not deliverable"
+// @Failure 500 {object} problem.Problem "Couldn't fetch delivery slots"
+// @Router /delivery/slots [get]
+func GetSlots(ctx *gin.Context) {
+	var addressID *int64
+	if value := ctx.Query("address_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			problem.Abort(ctx, http.StatusBadRequest, "Invalid address_id")
+			return
+		}
+		addressID = &id
+	}
+
+	address, err := addressRoutes.FindAddress(ctx.Request.Context(), database.BunDB, auth.CurrentClaims(ctx).UserID, addressID)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Address not found")
+		return
+	}
+
+	zone, err := delivery.FindZone(ctx.Request.Context(), database.BunDB, store.ID(ctx), address.Location())
+	if errors.Is(err, delivery.ErrNotDeliverable) {
+		problem.AbortWithCode(ctx, http.StatusUnprocessableEntity, problem.CodeNotDeliverable, "We don't deliver to this address")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch delivery slots")
+		return
+	}
+
+	var slots []delivery.Slot
+	now := time.Now()
+	err = database.BunDB.NewSelect().
+		Model(&slots).
+		Where("zone_id = ?", zone.ID).
+		Where("starts_at > ?", now).
+		Where("starts_at < ?", now.AddDate(0, 0, SlotDays)).
+		Where("reserved < capacity").
+		Order("starts_at ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch delivery slots")
+		return
+	}
+
+	available := make([]AvailableSlot, 0, len(slots))
+	for _, slot := range slots {
+		available = append(available, AvailableSlot{Slot: slot, Available: slot.Capacity - slot.Reserved})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"zone": zone, "slots": available})
+}
+
+// @Summary Reserve a delivery slot
+// @Description Hold a delivery slot for the current user until checkout. Any other slot the user is holding is released. The hold expires after SLOT_HOLD_MINUTES.
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Slot ID"
+// @Success 201 {object} delivery.SlotReservation
+// @Failure 404 {object} problem.Problem "Slot not found"
+// @Failure 409 {object} problem.Problem "Slot is full"
+// @Failure 500 {object} problem.Problem "Could not reserve slot"
+// @Router /delivery/slots/{id}/reserve [post]
+func ReserveSlot(ctx *gin.Context) {
+	slotID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Slot not found")
+		return
+	}
+	userID := auth.CurrentClaims(ctx).UserID
+
+	var reservation *delivery.SlotReservation
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*delivery.Slot)(nil)).
+			Where("id = ?", slotID).
+			Where("zone_id IN (?)", storeZones(ctx)).
+			Exists(c)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		var holds []delivery.SlotReservation
+		err = tx.NewSelect().
+			Model(&holds).
+			Where("user_id = ?", userID).
+			Where("status = ?", delivery.ReservationHeld).
+			Where("order_id IS NULL").
+			For("UPDATE").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+		for i := range holds {
+			if err := delivery.Release(c, tx, &holds[i]); err != nil {
+				return err
+			}
+		}
+
+		reservation, err = delivery.Reserve(c, tx, slotID, userID, time.Now().Add(holdDuration()))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Slot not found")
+		return
+	}
+	if errors.Is(err, delivery.ErrSlotFull) {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeSlotUnavailable, "Slot is full or no longer available")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not reserve slot")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, reservation)
+}
+
+// @Summary Release a slot reservation
+// @Description Give up a delivery slot held by the current user before checkout
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Reservation ID"
+// @Success 200 {object} SuccessResponse "Reservation released"
+// @Failure 404 {object} problem.Problem "Reservation not found"
+// @Failure 500 {object} problem.Problem "Could not release reservation"
+// @Router /delivery/reservations/{id} [delete]
+func ReleaseReservation(ctx *gin.Context) {
+	reservationID, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Reservation not found")
+		return
+	}
+	userID := auth.CurrentClaims(ctx).UserID
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		reservation, err := delivery.ActiveHold(c, tx, reservationID, userID)
+		if err != nil {
+			return err
+		}
+		return delivery.Release(c, tx, reservation)
+	})
+	if errors.Is(err, delivery.ErrReservationGone) {
+		problem.Abort(ctx, http.StatusNotFound, "Reservation not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not release reservation")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Reservation released"})
+}
+
+// @Summary Create a delivery slot
+// @Description Create a one-off delivery slot in a zone of the current store
+// @Tags Delivery
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param slot body delivery.Slot true "Delivery slot"
+// @Success 201 {object} delivery.Slot
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 409 {object} problem.Problem "A slot already starts at that time"
+// @Router /delivery/slots [post]
+func CreateSlot(ctx *gin.Context) {
+	var slot delivery.Slot
+
+	if err := ctx.ShouldBindJSON(&slot); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if !slot.EndsAt.After(slot.StartsAt) {
+		problem.Abort(ctx, http.StatusBadRequest, "ends_at must be after starts_at")
+		return
+	}
+	slot.Reserved = 0
+	slot.TemplateID = nil
+
+	exists, err := storeZones(ctx).Where("id = ?", slot.ZoneID).Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusBadRequest, "Delivery zone not found")
+		return
+	}
+
+	_, err = database.BunDB.NewInsert().Model(&slot).Exec(ctx.Request.Context())
+	if err != nil {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "A slot already starts at that time")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, slot)
+}
+
+// @Summary Create a recurring slot template
+// @Description Create a weekly slot template for a zone of the current store. Slots are generated from active templates for the next two weeks.
+// @Tags Delivery
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param template body delivery.SlotTemplate true "Slot template"
+// @Success 201 {object} delivery.SlotTemplate
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create slot template"
+// @Router /delivery/slot-templates [post]
+func CreateSlotTemplate(ctx *gin.Context) {
+	template := delivery.SlotTemplate{Active: true}
+
+	if err := ctx.ShouldBindJSON(&template); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if _, _, err := template.Window(time.Now()); err != nil {
+		problem.Abort(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exists, err := storeZones(ctx).Where("id = ?", template.ZoneID).Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusBadRequest, "Delivery zone not found")
+		return
+	}
+
+	_, err = database.BunDB.NewInsert().Model(&template).Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create slot template")
+		return
+	}
+
+	if err := delivery.GenerateSlots(database.BunDB, SlotDays)(ctx.Request.Context()); err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Template created but slots could not be generated")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, template)
+}
+
+// @Summary Get slot templates
+// @Description Retrieve every recurring slot template of the current store
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of slot templates"
+// @Failure 500 {object} problem.Problem "Couldn't fetch slot templates"
+// @Router /delivery/slot-templates [get]
+func GetSlotTemplates(ctx *gin.Context) {
+	var templates []delivery.SlotTemplate
+
+	err := database.BunDB.NewSelect().
+		Model(&templates).
+		Where("zone_id IN (?)", storeZones(ctx)).
+		Order("zone_id ASC", "weekday ASC", "start_time ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch slot templates")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// @Summary Delete a slot template by ID
+// @Description Delete a recurring slot template. Slots already generated from it are kept.
+// @Tags Delivery
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Template ID"
+// @Success 200 {object} SuccessResponse "Slot template deleted successfully!"
+// @Failure 404 {object} problem.Problem "Slot template not found"
+// @Failure 500 {object} problem.Problem "Failed to delete slot template"
+// @Router /delivery/slot-templates/{id} [delete]
+func DeleteSlotTemplate(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*delivery.SlotTemplate)(nil)).
+		Where("id = ?", id).
+		Where("zone_id IN (?)", storeZones(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete slot template")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Slot template not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Slot template deleted successfully!"})
+}
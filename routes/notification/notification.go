@@ -0,0 +1,76 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/notification"
+	"github.com/in43sh/homebuzz-backend/problem"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Notification marked as read"`
+}
+
+// @Summary Get the current user's notifications
+// @Description Retrieve the current user's notifications, newest first. With unread=true, only unread ones.
+// @Tags Notifications
+// @Produce  json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Success 200 {object} map[string]interface{} "List of notifications"
+// @Failure 500 {object} problem.Problem "Couldn't fetch notifications"
+// @Router /notifications [get]
+func GetNotifications(ctx *gin.Context) {
+	var notifications []notification.Notification
+
+	query := database.BunDB.NewSelect().
+		Model(&notifications).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("created_at DESC", "id DESC").
+		Limit(100)
+	if ctx.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if err := query.Scan(ctx.Request.Context()); err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch notifications")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"notifications": notifications})
+}
+
+// @Summary Mark a notification as read
+// @Description Mark one of the current user's notifications as read
+// @Tags Notifications
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Notification ID"
+// @Success 200 {object} SuccessResponse "Notification marked as read"
+// @Failure 404 {object} problem.Problem "Notification not found"
+// @Failure 500 {object} problem.Problem "Failed to update notification"
+// @Router /notifications/{id}/read [post]
+func MarkNotificationRead(ctx *gin.Context) {
+	result, err := database.BunDB.NewUpdate().
+		Model((*notification.Notification)(nil)).
+		Set("read_at = COALESCE(read_at, ?)", time.Now()).
+		Where("id = ?", ctx.Param("id")).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to update notification")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Notification not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Notification marked as read"})
+}
@@ -0,0 +1,654 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/delivery"
+	"github.com/in43sh/homebuzz-backend/payment"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/promotion"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	cartRoutes "github.com/in43sh/homebuzz-backend/routes/cart"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/tax"
+	"github.com/uptrace/bun"
+)
+
+const (
+	StatusPendingPayment = "pending_payment"
+	StatusPlaced         = "placed"
+	StatusCancelled      = "cancelled"
+)
+
+// TaxCalculator computes order taxes at checkout. It is set up in main.
+var TaxCalculator tax.Calculator
+
+// PaymentGateway charges orders. It is set up in main.
+var PaymentGateway payment.Gateway
+
+type Order struct {
+	bun.BaseModel `bun:"table:orders,alias:o" swaggerignore:"true"`
+
+	ID              int64            `bun:",pk,autoincrement" json:"id"`
+	StoreID         int64            `bun:"store_id,notnull" json:"store_id"`
+	UserID          int64            `bun:"user_id,notnull" json:"user_id"`
+	Status          string           `bun:"status,notnull" json:"status" example:"pending_payment"`
+	CouponCode      string           `bun:"coupon_code,notnull,default:''" json:"coupon_code,omitempty"`
+	Subtotal        float64          `bun:"subtotal,notnull" json:"subtotal"`
+	DiscountTotal   float64          `bun:"discount_total,notnull" json:"discount_total"`
+	TaxMode         string           `bun:"tax_mode,notnull,default:'exclusive'" json:"tax_mode" example:"exclusive"`
+	TaxCountry      string           `bun:"tax_country,notnull,default:''" json:"tax_country" example:"DE"`
+	TaxRegion       string           `bun:"tax_region,notnull,default:''" json:"tax_region"`
+	TaxTotal        float64          `bun:"tax_total,notnull,default:0" json:"tax_total"`
+	DeliveryZoneID  *int64           `bun:"delivery_zone_id" json:"delivery_zone_id,omitempty"`
+	DeliveryFee     float64          `bun:"delivery_fee,notnull,default:0" json:"delivery_fee"`
+	ShippingAddress *ShippingAddress `bun:"shipping_address,type:jsonb" json:"shipping_address,omitempty"`
+	DeliverySlotID  *int64           `bun:"delivery_slot_id" json:"delivery_slot_id,omitempty"`
+	PaymentDueAt    *time.Time       `bun:"payment_due_at" json:"payment_due_at,omitempty"`
+	PaymentRef      string           `bun:"payment_ref,notnull,default:''" json:"payment_ref,omitempty"`
+	PaidAt          *time.Time       `bun:"paid_at" json:"paid_at,omitempty"`
+	Total           float64          `bun:"total,notnull" json:"total"`
+	CreatedAt       time.Time        `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	Items           []OrderItem      `bun:"rel:has-many,join:id=order_id" json:"items"`
+	Discounts       []OrderDiscount  `bun:"rel:has-many,join:id=order_id" json:"discounts"`
+	Taxes           []OrderTax       `bun:"rel:has-many,join:id=order_id" json:"taxes"`
+}
+
+type OrderItem struct {
+	ID           int64   `bun:",pk,autoincrement" json:"id"`
+	OrderID      int64   `bun:"order_id,notnull" json:"order_id"`
+	ProductID    int64   `bun:"product_id,notnull" json:"product_id"`
+	ProductTitle string  `bun:"product_title,notnull" json:"product_title"`
+	UnitPrice    float64 `bun:"unit_price,notnull" json:"unit_price"`
+	Quantity     int     `bun:"quantity,notnull" json:"quantity"`
+	Discount     float64 `bun:"discount,notnull" json:"discount"`
+	Tax          float64 `bun:"tax,notnull,default:0" json:"tax"`
+	Total        float64 `bun:"total,notnull" json:"total"`
+}
+
+// OrderDiscount keeps the price explanation shown at checkout.
+type OrderDiscount struct {
+	ID          int64   `bun:",pk,autoincrement" json:"id"`
+	OrderID     int64   `bun:"order_id,notnull" json:"order_id"`
+	PromotionID int64   `bun:"promotion_id,notnull" json:"promotion_id"`
+	Name        string  `bun:"name,notnull" json:"name"`
+	CouponCode  string  `bun:"coupon_code,notnull,default:''" json:"coupon_code,omitempty"`
+	Amount      float64 `bun:"amount,notnull" json:"amount"`
+	Explanation string  `bun:"explanation,notnull" json:"explanation"`
+}
+
+// OrderTax is one line of the tax breakdown stored on an order.
+type OrderTax struct {
+	ID      int64   `bun:",pk,autoincrement" json:"id"`
+	OrderID int64   `bun:"order_id,notnull" json:"order_id"`
+	Name    string  `bun:"name,notnull" json:"name"`
+	Country string  `bun:"country,notnull" json:"country"`
+	Region  string  `bun:"region,notnull,default:''" json:"region"`
+	Rate    float64 `bun:"rate,notnull" json:"rate"`
+	Taxable float64 `bun:"taxable,notnull" json:"taxable"`
+	Amount  float64 `bun:"amount,notnull" json:"amount"`
+}
+
+// ShippingAddress is a copy of the address an order is delivered to, so later
+// edits to the address book do not change past orders.
+type ShippingAddress struct {
+	Recipient  string `json:"recipient"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone,omitempty"`
+}
+
+// CheckoutRequest selects how the order is delivered. Without an address_id
+// the default address is used. The order is taxed where it is shipped to.
+type CheckoutRequest struct {
+	CouponCode        string `json:"coupon_code" example:"SUMMER10"`
+	AddressID         *int64 `json:"address_id" example:"1"`
+	SlotReservationID *int64 `json:"slot_reservation_id" example:"1"`
+}
+
+// checkoutError carries an HTTP status and problem code out of the checkout
+// transaction.
+type checkoutError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *checkoutError) Error() string {
+	return e.msg
+}
+
+// IsCheckoutError reports whether err is a checkout failure meant for the
+// customer, such as an undeliverable address, rather than an internal error.
+func IsCheckoutError(err error) bool {
+	var checkoutErr *checkoutError
+	return errors.As(err, &checkoutErr)
+}
+
+// paymentTimeout is how long a checked-out order waits for payment before it
+// is cancelled, configured with PAYMENT_TIMEOUT_MINUTES.
+func paymentTimeout() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PAYMENT_TIMEOUT_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// @Summary Check out the cart
+// @Description Turn the current user's cart into an order for delivery to a saved address, taxed where it is shipped to, applying promotions, an optional coupon code, the delivery fee and taxes. The order and its reserved delivery slot are held until it is paid or PAYMENT_TIMEOUT_MINUTES pass.
+// @Tags Orders
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param checkout body CheckoutRequest false "Optional coupon code"
+// @Success 201 {object} Order
+// @Failure 400 {object} problem.Problem "Cart is empty"
+// @Failure 404 {object} problem.Problem "Coupon, address or slot reservation not found"
+// @Failure 409 {object} problem.Problem "Not enough stock"
+// @Failure 422 {object} problem.Problem "Coupon cannot be used, no shipping address, address is not deliverable or order is below the minimum"
+// @Failure 500 {object} problem.Problem "Could not place order"
+// @Router /checkout [post]
+func Checkout(ctx *gin.Context) {
+	var request CheckoutRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			problem.Invalid(ctx, err)
+			return
+		}
+	}
+	storeID := store.ID(ctx)
+	userID := auth.CurrentClaims(ctx).UserID
+	dueAt := time.Now().Add(paymentTimeout())
+
+	var order *Order
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		items, err := cartRoutes.Items(c, tx, storeID, userID)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return &checkoutError{status: http.StatusBadRequest, code: problem.CodeCartEmpty, msg: "Cart is empty"}
+		}
+
+		order, err = PlaceOrder(c, tx, storeID, userID, items, request, &dueAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*cartRoutes.CartItem)(nil)).
+			Where("user_id = ?", userID).
+			Where("product_id IN (?)", tx.NewSelect().Model((*productRoutes.Product)(nil)).Column("id").Where("store_id = ?", storeID)).
+			Exec(c)
+		return err
+	})
+	if err != nil {
+		if checkoutErr, ok := err.(*checkoutError); ok {
+			problem.AbortWithCode(ctx, checkoutErr.status, checkoutErr.code, checkoutErr.msg)
+			return
+		}
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not place order")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, order)
+}
+
+// PlaceOrder prices items, which must all belong to the store, and stores them
+// as an order awaiting payment until dueAt, or indefinitely when dueAt is nil.
+// Errors meant for the customer are returned as *checkoutError.
+func PlaceOrder(ctx context.Context, tx bun.Tx, storeID, userID int64, items []promotion.Item, request CheckoutRequest, dueAt *time.Time) (*Order, error) {
+	order := &Order{StoreID: storeID, UserID: userID, Status: StatusPendingPayment, PaymentDueAt: dueAt}
+
+	quote, coupon, err := promotion.Price(ctx, tx, storeID, items, request.CouponCode, userID, time.Now())
+	if err != nil {
+		status, code, msg := cartRoutes.CouponErrorStatus(err)
+		return nil, &checkoutError{status: status, code: code, msg: msg}
+	}
+
+	address, err := addressRoutes.FindAddress(ctx, tx, userID, request.AddressID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && request.AddressID != nil:
+		return nil, &checkoutError{status: http.StatusNotFound, code: problem.CodeNotFound, msg: "Address not found"}
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, &checkoutError{status: http.StatusUnprocessableEntity, code: problem.CodeUnprocessable, msg: "A shipping address is needed"}
+	case err != nil:
+		return nil, err
+	}
+
+	zone, err := delivery.FindZone(ctx, tx, storeID, address.Location())
+	if errors.Is(err, delivery.ErrNotDeliverable) {
+		return nil, &checkoutError{status: http.StatusUnprocessableEntity, code: problem.CodeNotDeliverable, msg: "We don't deliver to this address"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if quote.Total < zone.MinOrder {
+		return nil, &checkoutError{
+			status: http.StatusUnprocessableEntity,
+			code:   problem.CodeBelowMinimumOrder,
+			msg:    fmt.Sprintf("The minimum order for this address is %.2f", zone.MinOrder),
+		}
+	}
+
+	order.DeliveryZoneID = &zone.ID
+	order.DeliveryFee = zone.Fee
+	order.ShippingAddress = &ShippingAddress{
+		Recipient:  address.Recipient,
+		Line1:      address.Line1,
+		Line2:      address.Line2,
+		City:       address.City,
+		Region:     address.Region,
+		PostalCode: address.PostalCode,
+		Country:    address.Country,
+		Phone:      address.Phone,
+	}
+	jurisdiction := tax.Jurisdiction{Country: address.Country, Region: address.Region}
+
+	var reservation *delivery.SlotReservation
+	if request.SlotReservationID != nil {
+		reservation, err = delivery.ActiveHold(ctx, tx, *request.SlotReservationID, userID)
+		if errors.Is(err, delivery.ErrReservationGone) {
+			return nil, &checkoutError{status: http.StatusNotFound, code: problem.CodeNotFound, msg: "Slot reservation not found or expired"}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		slot := new(delivery.Slot)
+		if err := tx.NewSelect().Model(slot).Where("id = ?", reservation.SlotID).Scan(ctx); err != nil {
+			return nil, err
+		}
+		if slot.ZoneID != *order.DeliveryZoneID {
+			return nil, &checkoutError{status: http.StatusUnprocessableEntity, code: problem.CodeSlotUnavailable, msg: "The reserved slot is not in this address's delivery zone"}
+		}
+		order.DeliverySlotID = &slot.ID
+	}
+
+	quantities := make(map[int64]int, len(quote.Lines))
+	for _, line := range quote.Lines {
+		quantities[line.ProductID] += line.Quantity
+	}
+	err = productRoutes.TakeStock(ctx, tx, quantities)
+	var stockErr *productRoutes.OutOfStockError
+	if errors.As(err, &stockErr) {
+		return nil, &checkoutError{status: http.StatusConflict, code: problem.CodeOutOfStock, msg: "Not enough stock of " + stockErr.ProductTitle}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	taxes, err := calculateTaxes(ctx, tx, storeID, quote, jurisdiction)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Subtotal = quote.Subtotal
+	order.DiscountTotal = quote.DiscountTotal
+	order.TaxMode = taxes.Mode
+	order.TaxCountry = taxes.Jurisdiction.Country
+	order.TaxRegion = taxes.Jurisdiction.Region
+	order.TaxTotal = taxes.Total
+	order.Total = roundMoney(quote.Total + order.DeliveryFee)
+	if taxes.Mode == tax.ModeExclusive {
+		order.Total = roundMoney(order.Total + taxes.Total)
+	}
+	if coupon != nil {
+		order.CouponCode = coupon.Code
+	}
+	if _, err := tx.NewInsert().Model(order).Returning("*").Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for i, line := range quote.Lines {
+		order.Items = append(order.Items, OrderItem{
+			OrderID:      order.ID,
+			ProductID:    line.ProductID,
+			ProductTitle: line.ProductTitle,
+			UnitPrice:    line.UnitPrice,
+			Quantity:     line.Quantity,
+			Discount:     line.Discount,
+			Tax:          taxes.Lines[i].Tax,
+			Total:        line.Total,
+		})
+	}
+	if _, err := tx.NewInsert().Model(&order.Items).Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, discount := range quote.Discounts {
+		order.Discounts = append(order.Discounts, OrderDiscount{
+			OrderID:     order.ID,
+			PromotionID: discount.PromotionID,
+			Name:        discount.Name,
+			CouponCode:  discount.CouponCode,
+			Amount:      discount.Amount,
+			Explanation: discount.Explanation,
+		})
+	}
+	if len(order.Discounts) > 0 {
+		if _, err := tx.NewInsert().Model(&order.Discounts).Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, breakdown := range taxes.Breakdown {
+		order.Taxes = append(order.Taxes, OrderTax{
+			OrderID: order.ID,
+			Name:    breakdown.Name,
+			Country: breakdown.Country,
+			Region:  breakdown.Region,
+			Rate:    breakdown.Rate,
+			Taxable: breakdown.Taxable,
+			Amount:  breakdown.Amount,
+		})
+	}
+	if len(order.Taxes) > 0 {
+		if _, err := tx.NewInsert().Model(&order.Taxes).Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if coupon != nil {
+		redemption := &promotion.CouponRedemption{CouponID: coupon.ID, UserID: userID, OrderID: order.ID}
+		if _, err := tx.NewInsert().Model(redemption).Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if reservation != nil {
+		// The hold now lasts until the order is paid or cancelled.
+		err := delivery.Claim(ctx, tx, reservation.ID, order.ID, dueAt)
+		if errors.Is(err, delivery.ErrReservationGone) {
+			return nil, &checkoutError{status: http.StatusNotFound, code: problem.CodeNotFound, msg: "Slot reservation not found or expired"}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// calculateTaxes runs the tax calculator over the discounted cart lines.
+func calculateTaxes(ctx context.Context, db bun.IDB, storeID int64, quote promotion.Quote, jurisdiction tax.Jurisdiction) (tax.Result, error) {
+	ids := make([]int64, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		ids = append(ids, line.ProductID)
+	}
+
+	var products []productRoutes.Product
+	err := db.NewSelect().
+		Model(&products).
+		Column("id", "tax_class_id").
+		Where("id IN (?)", bun.In(ids)).
+		Scan(ctx)
+	if err != nil {
+		return tax.Result{}, err
+	}
+	classes := make(map[int64]*int64, len(products))
+	for _, product := range products {
+		classes[product.ID] = product.TaxClassID
+	}
+
+	request := tax.Request{StoreID: storeID, Jurisdiction: jurisdiction}
+	for _, line := range quote.Lines {
+		request.Lines = append(request.Lines, tax.Line{
+			ProductID:  line.ProductID,
+			TaxClassID: classes[line.ProductID],
+			Amount:     line.Total,
+		})
+	}
+
+	return TaxCalculator.Calculate(ctx, request)
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// @Summary Pay for an order
+// @Description Charge a pending order through the payment gateway. A successful payment confirms the order and its delivery slot.
+// @Tags Orders
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Order ID"
+// @Success 200 {object} Order
+// @Failure 402 {object} problem.Problem "Payment declined"
+// @Failure 404 {object} problem.Problem "Order not found"
+// @Failure 409 {object} problem.Problem "Order is not awaiting payment"
+// @Failure 502 {object} problem.Problem "Payment could not be processed"
+// @Router /orders/{id}/pay [post]
+func PayOrder(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+	order := new(Order)
+
+	// Once the gateway has taken the money the order has to be marked paid,
+	// so the payment isn't cut off with the request.
+	err := database.BunDB.RunInTx(context.WithoutCancel(ctx.Request.Context()), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(order).
+			Where("o.id = ?", ctx.Param("id")).
+			Where("o.store_id = ?", store.ID(ctx)).
+			Where("o.user_id = ?", userID).
+			For("UPDATE").
+			Scan(c)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &checkoutError{status: http.StatusNotFound, code: problem.CodeNotFound, msg: "Order not found"}
+		}
+		if err != nil {
+			return err
+		}
+		if order.Status != StatusPendingPayment || (order.PaymentDueAt != nil && time.Now().After(*order.PaymentDueAt)) {
+			return &checkoutError{status: http.StatusConflict, code: problem.CodeNotAwaitingPayment, msg: "Order is not awaiting payment"}
+		}
+
+		err = Charge(c, tx, order)
+		if errors.Is(err, payment.ErrDeclined) {
+			return &checkoutError{status: http.StatusPaymentRequired, code: problem.CodePaymentDeclined, msg: "Payment declined"}
+		}
+		if err != nil {
+			return &checkoutError{status: http.StatusBadGateway, code: problem.CodeBadGateway, msg: "Payment could not be processed"}
+		}
+		return nil
+	})
+	if err != nil {
+		if checkoutErr, ok := err.(*checkoutError); ok {
+			problem.AbortWithCode(ctx, checkoutErr.status, checkoutErr.code, checkoutErr.msg)
+			return
+		}
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not record payment")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// Charge takes payment for a pending order through the payment gateway and
+// marks it paid. Gateway errors are returned unchanged.
+func Charge(ctx context.Context, tx bun.Tx, order *Order) error {
+	result, err := PaymentGateway.Charge(ctx, payment.Charge{OrderID: order.ID, UserID: order.UserID, Amount: order.Total})
+	if err != nil {
+		return err
+	}
+	return MarkPaid(ctx, tx, order, result.Reference)
+}
+
+// MarkPaid places a paid order and confirms its delivery slot.
+func MarkPaid(ctx context.Context, tx bun.Tx, order *Order, reference string) error {
+	now := time.Now()
+	order.Status = StatusPlaced
+	order.PaymentRef = reference
+	order.PaidAt = &now
+
+	_, err := tx.NewUpdate().
+		Model(order).
+		Column("status", "payment_ref", "paid_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*delivery.SlotReservation)(nil)).
+		Set("status = ?", delivery.ReservationConfirmed).
+		Where("order_id = ?", order.ID).
+		Where("status = ?", delivery.ReservationHeld).
+		Exec(ctx)
+	return err
+}
+
+// ExpireUnpaidOrders cancels orders whose payment window has passed, giving
+// back their stock, delivery slot and coupon use. It is run periodically by the
+// scheduler.
+func ExpireUnpaidOrders(ctx context.Context) error {
+	return database.BunDB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var orders []Order
+		err := tx.NewSelect().
+			Model(&orders).
+			Where("o.status = ?", StatusPendingPayment).
+			Where("o.payment_due_at <= ?", time.Now()).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if err != nil || len(orders) == 0 {
+			return err
+		}
+
+		ids := make([]int64, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+		return CancelOrders(ctx, tx, ids)
+	})
+}
+
+// CancelOrders cancels unpaid orders, giving back their stock, delivery slot
+// and coupon use.
+func CancelOrders(ctx context.Context, tx bun.Tx, ids []int64) error {
+	_, err := tx.NewUpdate().
+		Model((*Order)(nil)).
+		Set("status = ?", StatusCancelled).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	var items []OrderItem
+	err = tx.NewSelect().
+		Model(&items).
+		Where("order_id IN (?)", bun.In(ids)).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	quantities := make(map[int64]int, len(items))
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	if err := productRoutes.ReturnStock(ctx, tx, quantities); err != nil {
+		return err
+	}
+
+	var reservations []delivery.SlotReservation
+	err = tx.NewSelect().
+		Model(&reservations).
+		Where("order_id IN (?)", bun.In(ids)).
+		Where("status = ?", delivery.ReservationHeld).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range reservations {
+		if err := delivery.Release(ctx, tx, &reservations[i]); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.NewDelete().
+		Model((*promotion.CouponRedemption)(nil)).
+		Where("order_id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	return err
+}
+
+// @Summary Get my orders
+// @Description Retrieve the current user's orders in the current store, newest first
+// @Tags Orders
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "List of orders"
+// @Failure 500 {object} problem.Problem "Couldn't fetch orders"
+// @Router /orders [get]
+func GetOrders(ctx *gin.Context) {
+	var orders []Order
+
+	err := database.BunDB.NewSelect().
+		Model(&orders).
+		Relation("Items").
+		Relation("Discounts").
+		Relation("Taxes").
+		Where("o.store_id = ?", store.ID(ctx)).
+		Where("o.user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("o.id DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch orders")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// @Summary Get one of my orders by ID
+// @Description Retrieve a single order of the current user, including its price breakdown
+// @Tags Orders
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Order ID"
+// @Success 200 {object} Order
+// @Failure 404 {object} problem.Problem "Order not found"
+// @Router /orders/{id} [get]
+func GetOrder(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	order := new(Order)
+	err := database.BunDB.NewSelect().
+		Model(order).
+		Relation("Items").
+		Relation("Discounts").
+		Relation("Taxes").
+		Where("o.id = ?", id).
+		Where("o.store_id = ?", store.ID(ctx)).
+		Where("o.user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Order not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,71 @@
+package routes
+
+import "time"
+
+type ProductRequest struct {
+	Image        string  `json:"image" binding:"required" example:"https://cdn.homebuzz.local/products/milk.jpg"`
+	ProductTitle string  `json:"product_title" binding:"required" example:"Whole milk"`
+	Price        float64 `json:"price" binding:"required" example:"1.99"`
+	Unit         string  `json:"unit" binding:"required" example:"1 l"`
+	Category     string  `json:"category" example:"Dairy"`
+	Rating       int     `json:"rating" binding:"required,gte=1,lte=5" example:"4"`
+}
+
+// Product maps the request to a new Product.
+func (r *ProductRequest) Product() Product {
+	return Product{
+		Image:        r.Image,
+		ProductTitle: r.ProductTitle,
+		Price:        r.Price,
+		Unit:         r.Unit,
+		Category:     r.Category,
+		Rating:       r.Rating,
+	}
+}
+
+// ProductResponse is the public view of a Product.
+type ProductResponse struct {
+	ID           int64   `json:"id" example:"1"`
+	Image        string  `json:"image" example:"https://cdn.homebuzz.local/products/milk.jpg"`
+	ProductTitle string  `json:"product_title" example:"Whole milk"`
+	Price        float64 `json:"price" example:"1.99"`
+	Unit         string  `json:"unit" example:"1 l"`
+	Category     string  `json:"category" example:"Dairy"`
+	TaxClassID   *int64  `json:"tax_class_id" example:"1"`
+	Stock        *int    `json:"stock" example:"12"`
+	Rating       int     `json:"rating" example:"4"`
+	// DeletedAt is only set in the list of deleted products.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+type ProductsResponse struct {
+	Products []ProductResponse `json:"products"`
+}
+
+// NewProductResponse maps a Product to its public view.
+func NewProductResponse(product *Product) ProductResponse {
+	response := ProductResponse{
+		ID:           product.ID,
+		Image:        product.Image,
+		ProductTitle: product.ProductTitle,
+		Price:        product.Price,
+		Unit:         product.Unit,
+		Category:     product.Category,
+		TaxClassID:   product.TaxClassID,
+		Stock:        product.Stock,
+		Rating:       product.Rating,
+	}
+	if !product.DeletedAt.IsZero() {
+		response.DeletedAt = &product.DeletedAt
+	}
+	return response
+}
+
+// NewProductResponses maps a list of products to their public views.
+func NewProductResponses(products []Product) []ProductResponse {
+	responses := make([]ProductResponse, 0, len(products))
+	for i := range products {
+		responses = append(responses, NewProductResponse(&products[i]))
+	}
+	return responses
+}
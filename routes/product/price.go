@@ -0,0 +1,355 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/wishlist"
+	"github.com/uptrace/bun"
+)
+
+// PriceHistory records a single change of a product's price.
+type PriceHistory struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	ProductID int64     `bun:"product_id,notnull" json:"product_id"`
+	OldPrice  *float64  `bun:"old_price" json:"old_price"`
+	NewPrice  float64   `bun:"new_price,notnull" json:"new_price"`
+	ChangedBy *int64    `bun:"changed_by" json:"changed_by"`
+	ChangedAt time.Time `bun:"changed_at,notnull,default:current_timestamp" json:"changed_at"`
+}
+
+// ScheduledPrice is a future-dated price change waiting for the scheduler.
+type ScheduledPrice struct {
+	ID          int64      `bun:",pk,autoincrement" json:"id"`
+	ProductID   int64      `bun:"product_id,notnull" json:"product_id"`
+	Price       float64    `bun:"price,notnull" json:"price"`
+	EffectiveAt time.Time  `bun:"effective_at,notnull" json:"effective_at"`
+	CreatedBy   int64      `bun:"created_by,notnull" json:"created_by"`
+	CreatedAt   time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	AppliedAt   *time.Time `bun:"applied_at" json:"applied_at"`
+	CancelledAt *time.Time `bun:"cancelled_at" json:"cancelled_at"`
+}
+
+type PriceChangeRequest struct {
+	Price       float64    `json:"price" binding:"required,gt=0" example:"3.49"`
+	EffectiveAt *time.Time `json:"effective_at" example:"2026-10-26T00:00:00Z"`
+}
+
+// setPrice updates the product's price and records the change in its history
+// and, with entry, in the audit log.
+func setPrice(ctx context.Context, tx bun.Tx, productID int64, price float64, changedBy *int64, entry audit.Entry) error {
+	product := new(Product)
+	err := tx.NewSelect().
+		Model(product).
+		Where("id = ?", productID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	if product.Price == price {
+		return nil
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*Product)(nil)).
+		Set("price = ?", price).
+		Where("id = ?", productID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldPrice := product.Price
+	_, err = tx.NewInsert().Model(&PriceHistory{
+		ProductID: productID,
+		OldPrice:  &oldPrice,
+		NewPrice:  price,
+		ChangedBy: changedBy,
+	}).Exec(ctx)
+	if err != nil {
+		return err
+	}
+	err = audit.Record(ctx, tx, entry.Diff(map[string]any{"price": oldPrice}, map[string]any{"price": price}))
+	if err != nil {
+		return err
+	}
+
+	return wishlist.NotifyPriceDrop(ctx, tx, productID, product.ProductTitle, oldPrice, price)
+}
+
+// ApplyScheduledPrices applies every scheduled price change that has become
+// due, each in its own transaction. A change that fails is logged and left
+// for the next run, without holding back the others. It is run periodically
+// by the scheduler.
+func ApplyScheduledPrices(ctx context.Context) error {
+	var due []int64
+	err := database.BunDB.NewSelect().
+		Model((*ScheduledPrice)(nil)).
+		Column("id").
+		Where("applied_at IS NULL").
+		Where("cancelled_at IS NULL").
+		Where("effective_at <= ?", time.Now()).
+		Order("effective_at ASC", "id ASC").
+		Scan(ctx, &due)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := applyScheduledPrice(ctx, id); err != nil {
+			fmt.Printf("Applying scheduled price change %d failed: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// applyScheduledPrice applies one scheduled price change, unless it was
+// applied, cancelled or locked by another run in the meantime.
+func applyScheduledPrice(ctx context.Context, id int64) error {
+	return database.BunDB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		change := new(ScheduledPrice)
+		err := tx.NewSelect().
+			Model(change).
+			Where("id = ?", id).
+			Where("applied_at IS NULL").
+			Where("cancelled_at IS NULL").
+			Where("effective_at <= ?", time.Now()).
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		createdBy := change.CreatedBy
+		entry := audit.System("product.price_change", "product", change.ProductID)
+		if err := setPrice(ctx, tx, change.ProductID, change.Price, &createdBy, entry); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*ScheduledPrice)(nil)).
+			Set("applied_at = ?", time.Now()).
+			Where("id = ?", change.ID).
+			Exec(ctx)
+		return err
+	})
+}
+
+// @Summary Change a product's price
+// @Description Change a product's price now, or schedule the change for a future effective_at
+// @Tags Products
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Product ID"
+// @Param price body PriceChangeRequest true "New price"
+// @Success 200 {object} SuccessResponse "Price updated successfully!"
+// @Success 202 {object} ScheduledPrice
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 500 {object} problem.Problem "Failed to change price"
+// @Router /products/{id}/price [put]
+func ChangePrice(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var request PriceChangeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	product := new(Product)
+	err := database.BunDB.NewSelect().
+		Model(product).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	userID := auth.CurrentClaims(ctx).UserID
+
+	if request.EffectiveAt != nil && request.EffectiveAt.After(time.Now()) {
+		scheduled := &ScheduledPrice{
+			ProductID:   product.ID,
+			Price:       request.Price,
+			EffectiveAt: *request.EffectiveAt,
+			CreatedBy:   userID,
+		}
+		err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+			if _, err := tx.NewInsert().Model(scheduled).Returning("*").Exec(c); err != nil {
+				return err
+			}
+			return audit.Record(c, tx, audit.New(ctx, "product.price_schedule", "scheduled_price", scheduled.ID).Diff(nil, scheduled))
+		})
+		if err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Failed to schedule price change")
+			return
+		}
+		ctx.JSON(http.StatusAccepted, scheduled)
+		return
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		return setPrice(c, tx, product.ID, request.Price, &userID, audit.New(ctx, "product.price_change", "product", product.ID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to change price")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Price updated successfully!"})
+}
+
+// @Summary Get a product's price history
+// @Description Retrieve every recorded price change of a product, newest first. With "at", return the price that was in effect at that time instead.
+// @Tags Products
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Product ID"
+// @Param at query string false "RFC 3339 timestamp or YYYY-MM-DD date"
+// @Success 200 {object} map[string]interface{} "Price history"
+// @Failure 400 {object} problem.Problem "Invalid date"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 500 {object} problem.Problem "Couldn't fetch price history"
+// @Router /products/{id}/price-history [get]
+func GetPriceHistory(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	exists, err := database.BunDB.NewSelect().
+		Model((*Product)(nil)).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	if at := ctx.Query("at"); at != "" {
+		moment, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			// A bare date means the price at the end of that day.
+			day, dayErr := time.Parse(time.DateOnly, at)
+			if dayErr != nil {
+				problem.Abort(ctx, http.StatusBadRequest, "Invalid date")
+				return
+			}
+			moment = day.Add(24*time.Hour - time.Nanosecond)
+		}
+
+		entry := new(PriceHistory)
+		err = database.BunDB.NewSelect().
+			Model(entry).
+			Where("product_id = ?", id).
+			Where("changed_at <= ?", moment).
+			Order("changed_at DESC", "id DESC").
+			Limit(1).
+			Scan(ctx.Request.Context())
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Abort(ctx, http.StatusNotFound, "No price recorded at that time")
+			return
+		}
+		if err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch price history")
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"at": moment, "price": entry.NewPrice, "change": entry})
+		return
+	}
+
+	var history []PriceHistory
+	err = database.BunDB.NewSelect().
+		Model(&history).
+		Where("product_id = ?", id).
+		Order("changed_at DESC", "id DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch price history")
+		return
+	}
+
+	var scheduled []ScheduledPrice
+	err = database.BunDB.NewSelect().
+		Model(&scheduled).
+		Where("product_id = ?", id).
+		Where("applied_at IS NULL").
+		Where("cancelled_at IS NULL").
+		Order("effective_at ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch price history")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"history": history, "scheduled": scheduled})
+}
+
+// @Summary Cancel a scheduled price change
+// @Description Cancel a future price change that has not been applied yet
+// @Tags Products
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Product ID"
+// @Param change_id path int64 true "Scheduled change ID"
+// @Success 200 {object} SuccessResponse "Scheduled price change cancelled"
+// @Failure 404 {object} problem.Problem "Scheduled price change not found"
+// @Failure 500 {object} problem.Problem "Failed to cancel price change"
+// @Router /products/{id}/scheduled-prices/{change_id} [delete]
+func CancelScheduledPrice(ctx *gin.Context) {
+	change := new(ScheduledPrice)
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model(change).
+			Set("cancelled_at = ?", time.Now()).
+			Where("id = ?", ctx.Param("change_id")).
+			Where("product_id = ?", ctx.Param("id")).
+			Where("product_id IN (?)", tx.NewSelect().Model((*Product)(nil)).Column("id").Where("store_id = ?", store.ID(ctx))).
+			Where("applied_at IS NULL").
+			Where("cancelled_at IS NULL").
+			Returning("*").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		entry := audit.New(ctx, "product.price_schedule_cancel", "scheduled_price", change.ID).
+			Diff(map[string]any{"cancelled_at": nil}, map[string]any{"cancelled_at": change.CancelledAt})
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Scheduled price change not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to cancel price change")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Scheduled price change cancelled"})
+}
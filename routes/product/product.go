@@ -2,19 +2,39 @@ package routes
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
 	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/uptrace/bun"
 )
 
+// Product is the persistence model of a product. Requests bind to
+// ProductRequest and responses use ProductResponse.
 type Product struct {
-	ID           int64   `bun:",pk,autoincrement"`
-	Image        string  `bun:"image,notnull" json:"image" binding:"required"`
-	ProductTitle string  `bun:"product_title,notnull" json:"product_title" binding:"required"`
-	Price        float64 `bun:"price,notnull" json:"price" binding:"required"`
-	Unit         string  `bun:"unit,notnull" json:"unit" binding:"required"`
-	Rating       int     `bun:"rating,notnull" json:"rating" binding:"required,gte=1,lte=5"`
+	ID           int64   `bun:",pk,autoincrement" json:"-"`
+	StoreID      int64   `bun:"store_id,notnull" json:"-"`
+	Image        string  `bun:"image,notnull" json:"-"`
+	ProductTitle string  `bun:"product_title,notnull" json:"-"`
+	Price        float64 `bun:"price,notnull" json:"-"`
+	Unit         string  `bun:"unit,notnull" json:"-"`
+	Category     string  `bun:"category,notnull,default:''" json:"-"`
+	TaxClassID   *int64  `bun:"tax_class_id" json:"-"`
+	Stock        *int    `bun:"stock" json:"-"`
+	Rating       int     `bun:"rating,notnull" json:"-"`
+	// DeletedAt soft deletes the product, so orders keep pointing at it.
+	// PurgeDeletedProducts removes it for good after DELETED_RETENTION_DAYS.
+	DeletedAt time.Time `bun:",soft_delete,nullzero" json:"-"`
 }
 
 // SuccessResponse for consistent success responses
@@ -22,32 +42,42 @@ type SuccessResponse struct {
 	Message string `json:"message" example:"Product added successfully!"`
 }
 
-// ErrorResponse for consistent error responses
-type ErrorResponse struct {
-	Error string `json:"error" example:"Invalid input"`
-}
-
 // @Summary Add a new product
-// @Description Add a new product by providing image, title, price, unit, and rating
+// @Description Add a new product to the current store by providing image, title, price, unit, rating, and an optional category
 // @Tags Products
 // @Accept  json
 // @Produce  json
-// @Param product body Product true "Product information"
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param product body ProductRequest true "Product information"
 // @Success 200 {object} SuccessResponse "Product added successfully!"
-// @Failure 400 {object} ErrorResponse "Invalid input"
-// @Failure 500 {object} ErrorResponse "Could not insert product into database"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 401 {object} problem.Problem "Missing authorization token"
+// @Failure 403 {object} problem.Problem "Insufficient permissions"
+// @Failure 500 {object} problem.Problem "Could not insert product into database"
 // @Router /products [post]
 func AddProduct(ctx *gin.Context) {
-	var product Product
+	var request ProductRequest
 
-	if err := ctx.ShouldBindJSON(&product); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
 		return
 	}
+	product := request.Product()
+	product.StoreID = store.ID(ctx)
+	userID := auth.CurrentClaims(ctx).UserID
 
-	_, err := database.BunDB.NewInsert().Model(&product).Exec(context.Background())
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&product).Exec(c); err != nil {
+			return err
+		}
+		if _, err := tx.NewInsert().Model(&PriceHistory{ProductID: product.ID, NewPrice: product.Price, ChangedBy: &userID}).Exec(c); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "product.create", "product", product.ID).Diff(nil, NewProductResponse(&product)))
+	})
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Could not insert product into database"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not insert product into database")
 		return
 	}
 
@@ -55,54 +85,187 @@ func AddProduct(ctx *gin.Context) {
 }
 
 // @Summary Get all products
-// @Description Retrieve a list of all products in the system
+// @Description Retrieve a list of all products in the current store
 // @Tags Products
 // @Accept  json
 // @Produce  json
-// @Success 200 {object} map[string]interface{} "List of products"
-// @Failure 500 {object} ErrorResponse "Couldn't fetch products"
+// @Success 200 {object} ProductsResponse "List of products"
+// @Failure 500 {object} problem.Problem "Couldn't fetch products"
 // @Router /products [get]
 func GetProducts(ctx *gin.Context) {
 	var products []Product
 
 	err := database.BunDB.NewSelect().
 		Model(&products).
-		Scan(context.Background())
+		Where("store_id = ?", store.ID(ctx)).
+		Scan(ctx.Request.Context())
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Couldn't fetch products"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch products")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"products": products})
+	ctx.JSON(http.StatusOK, ProductsResponse{Products: NewProductResponses(products)})
 }
 
 // @Summary Delete a product by ID
-// @Description Delete a product from the system by its ID
+// @Description Soft delete a product. It disappears from the catalog, carts and subscriptions, its pending price changes are cancelled, and it can be restored until DELETED_RETENTION_DAYS pass.
 // @Tags Products
 // @Accept  json
 // @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Param id path int64 true "Product ID"
 // @Success 200 {object} map[string]interface{} "Product deleted successfully!"
-// @Failure 404 {object} ErrorResponse "Product not found"
-// @Failure 500 {object} ErrorResponse "Failed to delete product"
+// @Failure 401 {object} problem.Problem "Missing authorization token"
+// @Failure 403 {object} problem.Problem "Insufficient permissions"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 500 {object} problem.Problem "Failed to delete product"
 // @Router /products/{id} [delete]
 func DeleteProduct(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	result, err := database.BunDB.NewDelete().
-		Model((*Product)(nil)).
-		Where("id = ?", id).
-		Exec(context.Background())
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		product := new(Product)
+		err := tx.NewSelect().
+			Model(product).
+			Where("id = ?", id).
+			Where("store_id = ?", store.ID(ctx)).
+			For("UPDATE").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.NewDelete().Model(product).WherePK().Exec(c); err != nil {
+			return err
+		}
+
+		// A scheduled price would fail to apply to a product that is gone.
+		_, err = tx.NewUpdate().
+			Model((*ScheduledPrice)(nil)).
+			Set("cancelled_at = ?", time.Now()).
+			Where("product_id = ?", id).
+			Where("applied_at IS NULL").
+			Where("cancelled_at IS NULL").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "product.delete", "product", product.ID).Diff(NewProductResponse(product), nil))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete product")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully!"})
+}
+
+// deletedRetention is how long a deleted product can still be restored,
+// configured with DELETED_RETENTION_DAYS.
+func deletedRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("DELETED_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// @Summary Get deleted products
+// @Description Retrieve the soft deleted products that can still be restored, most recently deleted first
+// @Tags Products
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} ProductsResponse "List of deleted products"
+// @Failure 500 {object} problem.Problem "Couldn't fetch products"
+// @Router /products/deleted [get]
+func GetDeletedProducts(ctx *gin.Context) {
+	var products []Product
+
+	err := database.BunDB.NewSelect().
+		Model(&products).
+		Where("store_id = ?", store.ID(ctx)).
+		WhereDeleted().
+		Order("deleted_at DESC").
+		Scan(ctx.Request.Context())
 	if err != nil {
-		ctx.AbortWithStatusJSON((http.StatusInternalServerError), gin.H{"error": "Failed to delete product"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch products")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	ctx.JSON(http.StatusOK, ProductsResponse{Products: NewProductResponses(products)})
+}
+
+// @Summary Restore a deleted product
+// @Description Bring back a soft deleted product. Price changes cancelled by the deletion stay cancelled.
+// @Tags Products
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Product ID"
+// @Success 200 {object} SuccessResponse "Product restored"
+// @Failure 404 {object} problem.Problem "Deleted product not found"
+// @Failure 500 {object} problem.Problem "Failed to restore product"
+// @Router /products/{id}/restore [post]
+func RestoreProduct(ctx *gin.Context) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model((*Product)(nil)).
+			Set("deleted_at = NULL").
+			Where("id = ?", ctx.Param("id")).
+			Where("store_id = ?", store.ID(ctx)).
+			WhereDeleted().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "product.restore", "product", ctx.Param("id")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Deleted product not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to restore product")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully!"})
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Product restored"})
+}
+
+// PurgeDeletedProducts removes products deleted more than
+// DELETED_RETENTION_DAYS ago for good. It runs on a schedule.
+func PurgeDeletedProducts(ctx context.Context) error {
+	var purged []int64
+	err := database.BunDB.RunInTx(ctx, nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewDelete().
+			Model((*Product)(nil)).
+			WhereDeleted().
+			Where("deleted_at < ?", time.Now().Add(-deletedRetention())).
+			ForceDelete().
+			Returning("id").
+			Scan(c, &purged)
+		if err != nil {
+			return err
+		}
+		for _, id := range purged {
+			if err := audit.Record(c, tx, audit.System("product.purge", "product", id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(purged) > 0 {
+		fmt.Printf("Purged %d deleted products\n", len(purged))
+	}
+	return nil
 }
@@ -0,0 +1,201 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/wishlist"
+	"github.com/uptrace/bun"
+)
+
+// StockUpdateRequest sets a product's stock level. A null stock stops
+// tracking stock for the product, which is then always available.
+type StockUpdateRequest struct {
+	Stock *int `json:"stock" binding:"omitempty,gte=0" example:"25"`
+}
+
+// OutOfStockError names a product that has fewer units than an order asks
+// for.
+type OutOfStockError struct {
+	ProductID    int64
+	ProductTitle string
+}
+
+func (e *OutOfStockError) Error() string {
+	return "not enough stock of " + e.ProductTitle
+}
+
+// InStock reports whether quantity units of the product can be sold.
+func (p *Product) InStock(quantity int) bool {
+	return p.Stock == nil || *p.Stock >= quantity
+}
+
+// SetStock updates the product's stock level, records it in the audit log
+// with entry, and notifies shoppers who saved the product when it comes back
+// into stock.
+func SetStock(ctx context.Context, tx bun.Tx, productID int64, stock *int, entry audit.Entry) error {
+	product := new(Product)
+	err := tx.NewSelect().
+		Model(product).
+		Where("id = ?", productID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*Product)(nil)).
+		Set("stock = ?", stock).
+		Where("id = ?", productID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	err = audit.Record(ctx, tx, entry.Diff(map[string]any{"stock": product.Stock}, map[string]any{"stock": stock}))
+	if err != nil {
+		return err
+	}
+
+	wasOut := product.Stock != nil && *product.Stock == 0
+	isIn := stock == nil || *stock > 0
+	if wasOut && isIn {
+		return wishlist.NotifyBackInStock(ctx, tx, productID, product.ProductTitle)
+	}
+	return nil
+}
+
+// TakeStock takes the quantities, keyed by product ID, out of stock for an
+// order. The products are locked, in ID order so concurrent orders can't
+// deadlock, and nothing is taken unless every product has enough, otherwise
+// an *OutOfStockError is returned. Products without stock tracking are left
+// alone.
+func TakeStock(ctx context.Context, tx bun.Tx, quantities map[int64]int) error {
+	products, err := lockProducts(ctx, tx, quantities)
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if !product.InStock(quantities[product.ID]) {
+			return &OutOfStockError{ProductID: product.ID, ProductTitle: product.ProductTitle}
+		}
+	}
+
+	for _, product := range products {
+		if product.Stock == nil {
+			continue
+		}
+		_, err := tx.NewUpdate().
+			Model((*Product)(nil)).
+			Set("stock = stock - ?", quantities[product.ID]).
+			Where("id = ?", product.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReturnStock puts the quantities, keyed by product ID, back into stock, as
+// when an order is cancelled, and notifies shoppers who saved a product that
+// comes back into stock.
+func ReturnStock(ctx context.Context, tx bun.Tx, quantities map[int64]int) error {
+	products, err := lockProducts(ctx, tx, quantities)
+	if err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		quantity := quantities[product.ID]
+		if product.Stock == nil || quantity <= 0 {
+			continue
+		}
+		_, err := tx.NewUpdate().
+			Model((*Product)(nil)).
+			Set("stock = stock + ?", quantity).
+			Where("id = ?", product.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if *product.Stock == 0 {
+			if err := wishlist.NotifyBackInStock(ctx, tx, product.ID, product.ProductTitle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func lockProducts(ctx context.Context, tx bun.Tx, quantities map[int64]int) ([]Product, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+
+	var products []Product
+	err := tx.NewSelect().
+		Model(&products).
+		Where("id IN (?)", bun.In(ids)).
+		Order("id ASC").
+		For("UPDATE").
+		Scan(ctx)
+	return products, err
+}
+
+// @Summary Update a product's stock
+// @Description Set how many units of a product are available. Shoppers who saved the product are notified when it comes back into stock.
+// @Tags Products
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Param id path int64 true "Product ID"
+// @Param stock body StockUpdateRequest true "Stock level"
+// @Success 200 {object} SuccessResponse "Stock updated successfully!"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 500 {object} problem.Problem "Failed to update stock"
+// @Router /products/{id}/stock [put]
+func UpdateStock(ctx *gin.Context) {
+	var request StockUpdateRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var productID int64
+		err := tx.NewSelect().
+			Model((*Product)(nil)).
+			Column("id").
+			Where("id = ?", ctx.Param("id")).
+			Where("store_id = ?", store.ID(ctx)).
+			Scan(c, &productID)
+		if err != nil {
+			return err
+		}
+		return SetStock(c, tx, productID, request.Stock, audit.New(ctx, "product.stock_change", "product", productID))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to update stock")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Stock updated successfully!"})
+}
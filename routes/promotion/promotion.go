@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/promotion"
+	"github.com/in43sh/homebuzz-backend/store"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Promotion created successfully!"`
+}
+
+func validatePromotion(p *promotion.Promotion) string {
+	switch {
+	case p.Type == promotion.TypePercentage && p.Value > 100:
+		return "Percentage discounts cannot exceed 100"
+	case p.Type != promotion.TypeBuyXGetY && p.Value <= 0:
+		return "Discount value must be greater than zero"
+	case p.Type == promotion.TypeBuyXGetY && (p.BuyQuantity <= 0 || p.GetQuantity <= 0):
+		return "Buy X get Y promotions need buy_quantity and get_quantity"
+	case p.ProductID != nil && p.Category != "":
+		return "A promotion can target a product or a category, not both"
+	case p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt):
+		return "ends_at must be after starts_at"
+	}
+	return ""
+}
+
+// @Summary Create a promotion
+// @Description Create a percentage, fixed or buy-X-get-Y promotion in the current store on a product, a category or the whole cart
+// @Tags Promotions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param promotion body promotion.Promotion true "Promotion rules"
+// @Success 201 {object} promotion.Promotion
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create promotion"
+// @Router /promotions [post]
+func CreatePromotion(ctx *gin.Context) {
+	p := promotion.Promotion{Active: true}
+
+	if err := ctx.ShouldBindJSON(&p); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validatePromotion(&p); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	p.StoreID = store.ID(ctx)
+
+	_, err := database.BunDB.NewInsert().Model(&p).Returning("*").Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create promotion")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, p)
+}
+
+// @Summary Get all promotions
+// @Description Retrieve every promotion of the current store, including inactive and scheduled ones
+// @Tags Promotions
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of promotions"
+// @Failure 500 {object} problem.Problem "Couldn't fetch promotions"
+// @Router /promotions [get]
+func GetPromotions(ctx *gin.Context) {
+	var promotions []promotion.Promotion
+
+	err := database.BunDB.NewSelect().
+		Model(&promotions).
+		Where("store_id = ?", store.ID(ctx)).
+		Order("id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch promotions")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"promotions": promotions})
+}
+
+// @Summary Update a promotion
+// @Description Replace the rules of an existing promotion
+// @Tags Promotions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Promotion ID"
+// @Param promotion body promotion.Promotion true "Promotion rules"
+// @Success 200 {object} promotion.Promotion
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Promotion not found"
+// @Failure 500 {object} problem.Problem "Could not update promotion"
+// @Router /promotions/{id} [put]
+func UpdatePromotion(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	existing := new(promotion.Promotion)
+	err := database.BunDB.NewSelect().
+		Model(existing).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	p := promotion.Promotion{Active: true}
+	if err := ctx.ShouldBindJSON(&p); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validatePromotion(&p); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	p.ID = existing.ID
+	p.StoreID = existing.StoreID
+	p.CreatedAt = existing.CreatedAt
+
+	_, err = database.BunDB.NewUpdate().Model(&p).WherePK().Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update promotion")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+// @Summary Delete a promotion by ID
+// @Description Delete a promotion and any coupons that unlock it
+// @Tags Promotions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Promotion ID"
+// @Success 200 {object} SuccessResponse "Promotion deleted successfully!"
+// @Failure 404 {object} problem.Problem "Promotion not found"
+// @Failure 500 {object} problem.Problem "Failed to delete promotion"
+// @Router /promotions/{id} [delete]
+func DeletePromotion(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*promotion.Promotion)(nil)).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete promotion")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Promotion not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Promotion deleted successfully!"})
+}
+
+// @Summary Create a coupon code
+// @Description Create a coupon code that unlocks a promotion of the current store, with optional global and per-user usage limits
+// @Tags Promotions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param coupon body promotion.Coupon true "Coupon"
+// @Success 201 {object} promotion.Coupon
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 409 {object} problem.Problem "Coupon code already exists"
+// @Router /coupons [post]
+func CreateCoupon(ctx *gin.Context) {
+	coupon := promotion.Coupon{Active: true}
+
+	if err := ctx.ShouldBindJSON(&coupon); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	coupon.Code = promotion.NormalizeCode(coupon.Code)
+	coupon.StoreID = store.ID(ctx)
+
+	exists, err := database.BunDB.NewSelect().
+		Model((*promotion.Promotion)(nil)).
+		Where("id = ?", coupon.PromotionID).
+		Where("store_id = ?", coupon.StoreID).
+		Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusBadRequest, "Promotion not found")
+		return
+	}
+
+	_, err = database.BunDB.NewInsert().Model(&coupon).Returning("*").Exec(ctx.Request.Context())
+	if err != nil {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Coupon code already exists")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, coupon)
+}
+
+// @Summary Get all coupons
+// @Description Retrieve every coupon code of the current store with its usage count
+// @Tags Promotions
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of coupons"
+// @Failure 500 {object} problem.Problem "Couldn't fetch coupons"
+// @Router /coupons [get]
+func GetCoupons(ctx *gin.Context) {
+	type couponWithUsage struct {
+		promotion.Coupon `bun:",extend"`
+		Uses             int `bun:"uses" json:"uses"`
+	}
+	var coupons []couponWithUsage
+
+	err := database.BunDB.NewSelect().
+		Model(&coupons).
+		ColumnExpr("coupon.*").
+		ColumnExpr("(SELECT COUNT(*) FROM coupon_redemptions AS r WHERE r.coupon_id = coupon.id) AS uses").
+		Where("coupon.store_id = ?", store.ID(ctx)).
+		Order("coupon.id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch coupons")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"coupons": coupons})
+}
+
+// @Summary Delete a coupon by ID
+// @Description Delete a coupon code
+// @Tags Promotions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Coupon ID"
+// @Success 200 {object} SuccessResponse "Coupon deleted successfully!"
+// @Failure 404 {object} problem.Problem "Coupon not found"
+// @Failure 500 {object} problem.Problem "Failed to delete coupon"
+// @Router /coupons/{id} [delete]
+func DeleteCoupon(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*promotion.Coupon)(nil)).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete coupon")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.AbortWithCode(ctx, http.StatusNotFound, problem.CodeCouponNotFound, "Coupon not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Coupon deleted successfully!"})
+}
@@ -0,0 +1,341 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/tax"
+	"github.com/uptrace/bun"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Staff member removed"`
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type StoreRequest struct {
+	Slug string  `json:"slug" binding:"required,max=50" example:"homebuzz"`
+	Name string  `json:"name" binding:"required,max=100" example:"Homebuzz"`
+	Host *string `json:"host" example:"shop.homebuzz.local"`
+	// CORSOrigins are the browser origins allowed to call the API for the
+	// store, as scheme://host[:port].
+	CORSOrigins []string `json:"cors_origins" example:"https://homebuzz.netlify.app"`
+}
+
+type StaffRequest struct {
+	Role string `json:"role" binding:"required,oneof=staff admin" example:"staff"`
+}
+
+// validateStore normalizes the request and returns a message for the first
+// invalid field.
+func validateStore(request *StoreRequest) string {
+	request.Slug = strings.ToLower(request.Slug)
+	if !slugPattern.MatchString(request.Slug) {
+		return "Slug must be lowercase letters, digits and hyphens"
+	}
+	if request.Host != nil {
+		host := strings.ToLower(strings.TrimSpace(*request.Host))
+		if host == "" {
+			request.Host = nil
+		} else {
+			request.Host = &host
+		}
+	}
+	if request.CORSOrigins == nil {
+		request.CORSOrigins = []string{}
+	}
+	for _, origin := range request.CORSOrigins {
+		parsed, err := url.Parse(origin)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			origin != parsed.Scheme+"://"+parsed.Host {
+			return "Invalid origin: " + origin
+		}
+	}
+	return ""
+}
+
+// @Summary Get the current store
+// @Description Retrieve the store the request is for, named by the /store/{slug} path prefix, the X-Store header or the host, or the default store
+// @Tags Stores
+// @Produce  json
+// @Param X-Store header string false "Store slug"
+// @Success 200 {object} store.Store
+// @Failure 404 {object} problem.Problem "Store not found"
+// @Router /store [get]
+func GetCurrentStore(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, store.Current(ctx))
+}
+
+// @Summary Create a store
+// @Description Create a store with its own products, orders, staff, promotions, tax classes, delivery zones and allowed CORS origins. It starts with a default "Standard" tax class. Requests reach it through the /store/{slug} path prefix, the X-Store header or its host.
+// @Tags Stores
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param store body StoreRequest true "Store"
+// @Success 201 {object} store.Store
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 409 {object} problem.Problem "Slug or host already in use"
+// @Router /stores [post]
+func CreateStore(ctx *gin.Context) {
+	var request StoreRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateStore(&request); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+
+	newStore := &store.Store{Slug: request.Slug, Name: request.Name, Host: request.Host, CORSOrigins: request.CORSOrigins}
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(newStore).Returning("*").Exec(c); err != nil {
+			return err
+		}
+		standard := &tax.TaxClass{StoreID: newStore.ID, Name: "Standard", IsDefault: true}
+		if _, err := tx.NewInsert().Model(standard).Exec(c); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "store.create", "store", newStore.ID).Diff(nil, newStore))
+	})
+	if err != nil {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Slug or host already in use")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, newStore)
+}
+
+// @Summary Get all stores
+// @Description Retrieve every store on the platform
+// @Tags Stores
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of stores"
+// @Failure 500 {object} problem.Problem "Couldn't fetch stores"
+// @Router /stores [get]
+func GetStores(ctx *gin.Context) {
+	var stores []store.Store
+
+	err := database.BunDB.NewSelect().
+		Model(&stores).
+		Order("id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch stores")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"stores": stores})
+}
+
+// @Summary Update a store
+// @Description Replace a store's slug, name, host and allowed CORS origins
+// @Tags Stores
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Store ID"
+// @Param store body StoreRequest true "Store"
+// @Success 200 {object} store.Store
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Store not found"
+// @Failure 409 {object} problem.Problem "Slug or host already in use"
+// @Router /stores/{id} [put]
+func UpdateStore(ctx *gin.Context) {
+	var request StoreRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if msg := validateStore(&request); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+
+	updated := new(store.Store)
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(updated).
+			Where("id = ?", ctx.Param("id")).
+			For("UPDATE").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+		before := *updated
+
+		updated.Slug = request.Slug
+		updated.Name = request.Name
+		updated.Host = request.Host
+		updated.CORSOrigins = request.CORSOrigins
+		_, err = tx.NewUpdate().
+			Model(updated).
+			Column("slug", "name", "host", "cors_origins").
+			WherePK().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "store.update", "store", updated.ID).Diff(&before, updated))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.AbortWithCode(ctx, http.StatusNotFound, problem.CodeStoreNotFound, "Store not found")
+		return
+	}
+	if err != nil {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Slug or host already in use")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// @Summary Get the current store's staff
+// @Description Retrieve the users with a role in the current store
+// @Tags Stores
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of staff members"
+// @Failure 500 {object} problem.Problem "Couldn't fetch staff"
+// @Router /staff [get]
+func GetStaff(ctx *gin.Context) {
+	var members []store.Member
+
+	err := database.BunDB.NewSelect().
+		Model(&members).
+		Where("store_id = ?", store.ID(ctx)).
+		Order("user_id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch staff")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"staff": members})
+}
+
+// @Summary Give a user a role in the current store
+// @Description Add a user to the current store's staff, or change their role. Staff manage the store's products; store admins also manage its staff.
+// @Tags Stores
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param user_id path int64 true "User ID"
+// @Param role body StaffRequest true "Role"
+// @Success 200 {object} store.Member
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Could not update staff"
+// @Router /staff/{user_id} [put]
+func SetStaff(ctx *gin.Context) {
+	var request StaffRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	member := &store.Member{StoreID: store.ID(ctx), Role: request.Role}
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Table("users").
+			Column("id").
+			Where("id = ?", ctx.Param("user_id")).
+			Where("deleted_at IS NULL").
+			Scan(c, &member.UserID)
+		if err != nil {
+			return err
+		}
+
+		before := new(store.Member)
+		err = tx.NewSelect().
+			Model(before).
+			Where("store_id = ?", member.StoreID).
+			Where("user_id = ?", member.UserID).
+			Scan(c)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			before = nil
+		case err != nil:
+			return err
+		}
+
+		_, err = tx.NewInsert().
+			Model(member).
+			On("CONFLICT (store_id, user_id) DO UPDATE").
+			Set("role = EXCLUDED.role").
+			Returning("*").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "store_staff.set", "user", member.UserID)
+		if before != nil {
+			entry = entry.Diff(map[string]any{"store_id": member.StoreID, "role": before.Role}, map[string]any{"store_id": member.StoreID, "role": member.Role})
+		} else {
+			entry = entry.Diff(nil, map[string]any{"store_id": member.StoreID, "role": member.Role})
+		}
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update staff")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, member)
+}
+
+// @Summary Remove a user from the current store's staff
+// @Description Take away a user's role in the current store
+// @Tags Stores
+// @Produce  json
+// @Security BearerAuth
+// @Param user_id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "Staff member removed"
+// @Failure 404 {object} problem.Problem "Staff member not found"
+// @Failure 500 {object} problem.Problem "Could not update staff"
+// @Router /staff/{user_id} [delete]
+func RemoveStaff(ctx *gin.Context) {
+	member := new(store.Member)
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewDelete().
+			Model(member).
+			Where("store_id = ?", store.ID(ctx)).
+			Where("user_id = ?", ctx.Param("user_id")).
+			Returning("*").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "store_staff.remove", "user", member.UserID).
+			Diff(map[string]any{"store_id": member.StoreID, "role": member.Role}, nil)
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Staff member not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update staff")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Staff member removed"})
+}
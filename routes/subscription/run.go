@@ -0,0 +1,479 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/notification"
+	"github.com/in43sh/homebuzz-backend/payment"
+	"github.com/in43sh/homebuzz-backend/promotion"
+	orderRoutes "github.com/in43sh/homebuzz-backend/routes/order"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/uptrace/bun"
+)
+
+const (
+	RunPlaced        = "placed"
+	RunPaymentFailed = "payment_failed"
+	RunFailed        = "failed"
+	RunSkipped       = "skipped"
+)
+
+var errUnknownItem = errors.New("product is not part of the subscription")
+
+// SubscriptionRun records what happened to one scheduled delivery of a
+// subscription.
+type SubscriptionRun struct {
+	ID             int64          `bun:",pk,autoincrement" json:"id"`
+	SubscriptionID int64          `bun:"subscription_id,notnull" json:"subscription_id"`
+	OrderID        *int64         `bun:"order_id" json:"order_id,omitempty"`
+	ScheduledFor   time.Time      `bun:"scheduled_for,notnull" json:"scheduled_for"`
+	Status         string         `bun:"status,notnull" json:"status" example:"placed"`
+	Attempts       int            `bun:"attempts,notnull,default:0" json:"attempts"`
+	NextAttemptAt  *time.Time     `bun:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	Error          string         `bun:"error,notnull,default:''" json:"error,omitempty"`
+	Substitutions  []Substitution `bun:"substitutions,type:jsonb" json:"substitutions,omitempty"`
+	CreatedAt      time.Time      `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Substitution describes an out-of-stock product that was replaced, or left
+// out when SubstituteID is nil.
+type Substitution struct {
+	ProductID       int64  `json:"product_id"`
+	ProductTitle    string `json:"product_title"`
+	SubstituteID    *int64 `json:"substitute_id,omitempty"`
+	SubstituteTitle string `json:"substitute_title,omitempty"`
+	Quantity        int    `json:"quantity"`
+}
+
+// paymentAttempts is how often a subscription order is charged before it is
+// cancelled, configured with SUBSCRIPTION_PAYMENT_ATTEMPTS.
+func paymentAttempts() int {
+	attempts, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_PAYMENT_ATTEMPTS"))
+	if err != nil || attempts <= 0 {
+		attempts = 4
+	}
+	return attempts
+}
+
+// retryDelay doubles the wait after every failed payment, starting at an hour.
+func retryDelay(attempts int) time.Duration {
+	return time.Hour << (attempts - 1)
+}
+
+// advance schedules the next delivery after the current one and forgets the
+// one-off quantity changes made for it.
+func advance(ctx context.Context, tx bun.Tx, subscription *Subscription) error {
+	now := time.Now()
+	subscription.NextRunAt = subscription.After(subscription.NextRunAt)
+	for !subscription.NextRunAt.After(now) {
+		subscription.NextRunAt = subscription.After(subscription.NextRunAt)
+	}
+
+	_, err := tx.NewUpdate().Model(subscription).Column("next_run_at").WherePK().Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*SubscriptionItem)(nil)).
+		Set("next_quantity = NULL").
+		Where("subscription_id = ?", subscription.ID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range subscription.Items {
+		subscription.Items[i].NextQuantity = nil
+	}
+	return nil
+}
+
+// resume reactivates a paused subscription, moving a next delivery that
+// passed during the pause into the future.
+func resume(ctx context.Context, tx bun.Tx, subscription *Subscription) error {
+	subscription.Status = StatusActive
+	subscription.PausedUntil = nil
+	for !subscription.NextRunAt.After(time.Now()) {
+		subscription.NextRunAt = subscription.After(subscription.NextRunAt)
+	}
+
+	_, err := tx.NewUpdate().
+		Model(subscription).
+		Column("status", "paused_until", "next_run_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func notify(ctx context.Context, db bun.IDB, userID int64, message string) error {
+	return notification.Send(ctx, db, []int64{userID}, notification.KindSubscription, message, nil)
+}
+
+// findSimilar picks an in-stock product of the same store and category with
+// the closest price.
+func findSimilar(ctx context.Context, db bun.IDB, product *productRoutes.Product, quantity int) (*productRoutes.Product, error) {
+	if product.Category == "" {
+		return nil, nil
+	}
+
+	similar := new(productRoutes.Product)
+	err := db.NewSelect().
+		Model(similar).
+		Where("store_id = ?", product.StoreID).
+		Where("category = ?", product.Category).
+		Where("id <> ?", product.ID).
+		Where("stock IS NULL OR stock >= ?", quantity).
+		OrderExpr("ABS(price - ?) ASC", product.Price).
+		Order("id ASC").
+		Limit(1).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return similar, nil
+}
+
+// buildItems turns the subscription into priceable items for the next
+// delivery, replacing out-of-stock products where allowed. The products are
+// locked until the order takes their stock, and stock already promised to an
+// earlier item doesn't count for a later one.
+func buildItems(ctx context.Context, db bun.IDB, subscription *Subscription) ([]promotion.Item, []Substitution, error) {
+	ids := make([]int64, 0, len(subscription.Items)*2)
+	for _, item := range subscription.Items {
+		ids = append(ids, item.ProductID)
+		if item.SubstituteProductID != nil {
+			ids = append(ids, *item.SubstituteProductID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	var products []productRoutes.Product
+	err := db.NewSelect().
+		Model(&products).
+		Where("id IN (?)", bun.In(ids)).
+		Where("store_id = ?", subscription.StoreID).
+		Order("id ASC").
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[int64]*productRoutes.Product, len(products))
+	for i := range products {
+		byID[products[i].ID] = &products[i]
+	}
+
+	taken := make(map[int64]int, len(products))
+	available := func(product *productRoutes.Product, quantity int) bool {
+		return product.InStock(taken[product.ID] + quantity)
+	}
+
+	var items []promotion.Item
+	var substitutions []Substitution
+	for _, item := range subscription.Items {
+		quantity := item.Quantity
+		if item.NextQuantity != nil {
+			quantity = *item.NextQuantity
+		}
+		product, ok := byID[item.ProductID]
+		if quantity == 0 || !ok {
+			continue
+		}
+
+		chosen := product
+		if !available(product, quantity) {
+			substitution := Substitution{ProductID: product.ID, ProductTitle: product.ProductTitle, Quantity: quantity}
+			chosen = nil
+			if subscription.AllowSubstitutions {
+				if item.SubstituteProductID != nil {
+					if preferred, ok := byID[*item.SubstituteProductID]; ok && available(preferred, quantity) {
+						chosen = preferred
+					}
+				}
+				if chosen == nil {
+					chosen, err = findSimilar(ctx, db, product, quantity)
+					if err != nil {
+						return nil, nil, err
+					}
+					if chosen != nil && !available(chosen, quantity) {
+						chosen = nil
+					}
+				}
+			}
+			if chosen != nil {
+				substitution.SubstituteID = &chosen.ID
+				substitution.SubstituteTitle = chosen.ProductTitle
+			}
+			substitutions = append(substitutions, substitution)
+			if chosen == nil {
+				continue
+			}
+		}
+
+		taken[chosen.ID] += quantity
+		items = append(items, promotion.Item{
+			ProductID:    chosen.ID,
+			ProductTitle: chosen.ProductTitle,
+			Category:     chosen.Category,
+			UnitPrice:    chosen.Price,
+			Quantity:     quantity,
+		})
+	}
+	return items, substitutions, nil
+}
+
+// placeRun places the subscription's due order and charges it.
+func placeRun(ctx context.Context, tx bun.Tx, subscription *Subscription) error {
+	run := &SubscriptionRun{SubscriptionID: subscription.ID, ScheduledFor: subscription.NextRunAt}
+
+	items, substitutions, err := buildItems(ctx, tx, subscription)
+	if err != nil {
+		return err
+	}
+	run.Substitutions = substitutions
+	for _, substitution := range substitutions {
+		message := fmt.Sprintf("%s: %s is out of stock and was left out", subscription.Name, substitution.ProductTitle)
+		if substitution.SubstituteID != nil {
+			message = fmt.Sprintf("%s: %s is out of stock and was replaced with %s", subscription.Name, substitution.ProductTitle, substitution.SubstituteTitle)
+		}
+		if err := notify(ctx, tx, subscription.UserID, message); err != nil {
+			return err
+		}
+	}
+
+	var order *orderRoutes.Order
+	switch {
+	case len(items) == 0 && len(substitutions) == 0:
+		run.Status = RunSkipped
+	case len(items) == 0:
+		run.Status = RunFailed
+		run.Error = "Every product is out of stock"
+	default:
+		request := orderRoutes.CheckoutRequest{AddressID: subscription.AddressID}
+		order, err = orderRoutes.PlaceOrder(ctx, tx, subscription.StoreID, subscription.UserID, items, request, nil)
+		if orderRoutes.IsCheckoutError(err) {
+			run.Status = RunFailed
+			run.Error = err.Error()
+		} else if err != nil {
+			return err
+		} else {
+			run.OrderID = &order.ID
+		}
+	}
+
+	if _, err := tx.NewInsert().Model(run).Returning("*").Exec(ctx); err != nil {
+		return err
+	}
+	if run.Status == RunFailed {
+		message := fmt.Sprintf("%s: the order for %s could not be placed: %s", subscription.Name, run.ScheduledFor.Format(time.DateOnly), run.Error)
+		if err := notify(ctx, tx, subscription.UserID, message); err != nil {
+			return err
+		}
+	}
+	if order != nil {
+		if err := attemptPayment(ctx, tx, subscription.Name, run, order); err != nil {
+			return err
+		}
+	}
+
+	return advance(ctx, tx, subscription)
+}
+
+// attemptPayment charges a subscription order, scheduling a retry when the
+// payment fails and cancelling the order when no attempts are left.
+func attemptPayment(ctx context.Context, tx bun.Tx, name string, run *SubscriptionRun, order *orderRoutes.Order) error {
+	run.Attempts++
+	run.NextAttemptAt = nil
+
+	err := orderRoutes.Charge(ctx, tx, order)
+	switch {
+	case err == nil:
+		run.Status = RunPlaced
+		run.Error = ""
+	case errors.Is(err, payment.ErrDeclined):
+		run.Error = "Payment declined"
+	default:
+		run.Error = "Payment could not be processed"
+	}
+
+	if err != nil {
+		message := fmt.Sprintf("%s: payment for order #%d failed, we will try again", name, order.ID)
+		if run.Attempts >= paymentAttempts() {
+			run.Status = RunFailed
+			message = fmt.Sprintf("%s: payment for order #%d failed and the order was cancelled", name, order.ID)
+			if err := orderRoutes.CancelOrders(ctx, tx, []int64{order.ID}); err != nil {
+				return err
+			}
+		} else {
+			run.Status = RunPaymentFailed
+			next := time.Now().Add(retryDelay(run.Attempts))
+			run.NextAttemptAt = &next
+		}
+		if err := notify(ctx, tx, order.UserID, message); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.NewUpdate().
+		Model(run).
+		Column("status", "attempts", "next_attempt_at", "error").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+// processDue places the order of a due subscription, unless another worker
+// already took it.
+func processDue(ctx context.Context, tx bun.Tx, subscriptionID int64) error {
+	subscription := new(Subscription)
+	err := tx.NewSelect().
+		Model(subscription).
+		Where("id = ?", subscriptionID).
+		Where("status = ?", StatusActive).
+		Where("next_run_at <= ?", time.Now()).
+		For("UPDATE SKIP LOCKED").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tx.NewSelect().
+		Model(&subscription.Items).
+		Where("subscription_id = ?", subscription.ID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+	return placeRun(ctx, tx, subscription)
+}
+
+// retryPayment charges a subscription order whose payment failed before.
+func retryPayment(ctx context.Context, tx bun.Tx, runID int64) error {
+	run := new(SubscriptionRun)
+	err := tx.NewSelect().
+		Model(run).
+		Where("id = ?", runID).
+		Where("status = ?", RunPaymentFailed).
+		For("UPDATE SKIP LOCKED").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.NewSelect().
+		Model((*Subscription)(nil)).
+		Column("name").
+		Where("id = ?", run.SubscriptionID).
+		Scan(ctx, &name)
+	if err != nil {
+		return err
+	}
+
+	order := new(orderRoutes.Order)
+	err = tx.NewSelect().
+		Model(order).
+		Where("o.id = ?", run.OrderID).
+		For("UPDATE").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The customer may have paid or the order may have been cancelled by hand.
+	if order.Status != orderRoutes.StatusPendingPayment {
+		run.Status = RunPlaced
+		if order.Status == orderRoutes.StatusCancelled {
+			run.Status = RunFailed
+		}
+		run.NextAttemptAt = nil
+		_, err = tx.NewUpdate().Model(run).Column("status", "next_attempt_at").WherePK().Exec(ctx)
+		return err
+	}
+
+	return attemptPayment(ctx, tx, name, run, order)
+}
+
+// ProcessSubscriptions places the orders of every due subscription and
+// retries failed subscription payments. It is run periodically by the
+// scheduler.
+func ProcessSubscriptions(ctx context.Context) error {
+	var resumable []Subscription
+	err := database.BunDB.NewSelect().
+		Model(&resumable).
+		Where("status = ?", StatusPaused).
+		Where("paused_until <= ?", time.Now()).
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range resumable {
+		err := database.BunDB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return resume(ctx, tx, &resumable[i])
+		})
+		errs = append(errs, err)
+	}
+
+	var due []int64
+	err = database.BunDB.NewSelect().
+		Model((*Subscription)(nil)).
+		Column("id").
+		Where("status = ?", StatusActive).
+		Where("next_run_at <= ?", time.Now()).
+		Order("next_run_at ASC").
+		Scan(ctx, &due)
+	if err != nil {
+		return err
+	}
+
+	// Every subscription gets its own transaction so one failure does not
+	// hold back the others.
+	for _, id := range due {
+		err := database.BunDB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return processDue(ctx, tx, id)
+		})
+		errs = append(errs, err)
+	}
+
+	var retries []int64
+	err = database.BunDB.NewSelect().
+		Model((*SubscriptionRun)(nil)).
+		Column("id").
+		Where("status = ?", RunPaymentFailed).
+		Where("next_attempt_at <= ?", time.Now()).
+		Scan(ctx, &retries)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range retries {
+		err := database.BunDB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			return retryPayment(ctx, tx, id)
+		})
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
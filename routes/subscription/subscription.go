@@ -0,0 +1,603 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/uptrace/bun"
+)
+
+const (
+	CadenceWeekly   = "weekly"
+	CadenceBiweekly = "biweekly"
+	CadenceMonthly  = "monthly"
+
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+)
+
+// Subscription is a recurring order of the same products, placed by the
+// scheduler every cadence starting at NextRunAt.
+type Subscription struct {
+	ID                 int64              `bun:",pk,autoincrement" json:"id"`
+	StoreID            int64              `bun:"store_id,notnull" json:"store_id"`
+	UserID             int64              `bun:"user_id,notnull" json:"user_id"`
+	Name               string             `bun:"name,notnull" json:"name" example:"Weekly basics"`
+	Cadence            string             `bun:"cadence,notnull" json:"cadence" example:"weekly"`
+	AddressID          *int64             `bun:"address_id" json:"address_id,omitempty" example:"1"`
+	AllowSubstitutions bool               `bun:"allow_substitutions,notnull,default:true" json:"allow_substitutions"`
+	Status             string             `bun:"status,notnull" json:"status" example:"active"`
+	PausedUntil        *time.Time         `bun:"paused_until" json:"paused_until,omitempty"`
+	NextRunAt          time.Time          `bun:"next_run_at,notnull" json:"next_run_at"`
+	CreatedAt          time.Time          `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	Items              []SubscriptionItem `bun:"rel:has-many,join:id=subscription_id" json:"items,omitempty"`
+	Runs               []SubscriptionRun  `bun:"rel:has-many,join:id=subscription_id" json:"runs,omitempty"`
+}
+
+// SubscriptionItem is a product delivered with every order of a
+// subscription. NextQuantity overrides Quantity for the next delivery only;
+// zero leaves the product out of it.
+type SubscriptionItem struct {
+	ID                  int64  `bun:",pk,autoincrement" json:"id"`
+	SubscriptionID      int64  `bun:"subscription_id,notnull" json:"subscription_id"`
+	ProductID           int64  `bun:"product_id,notnull" json:"product_id"`
+	Quantity            int    `bun:"quantity,notnull" json:"quantity"`
+	NextQuantity        *int   `bun:"next_quantity" json:"next_quantity,omitempty"`
+	SubstituteProductID *int64 `bun:"substitute_product_id" json:"substitute_product_id,omitempty"`
+}
+
+type SubscriptionItemRequest struct {
+	ProductID           int64  `json:"product_id" binding:"required" example:"1"`
+	Quantity            int    `json:"quantity" binding:"required,gte=1" example:"2"`
+	SubstituteProductID *int64 `json:"substitute_product_id" example:"3"`
+}
+
+type SubscriptionRequest struct {
+	Name               string                    `json:"name" binding:"required,max=100" example:"Weekly basics"`
+	Cadence            string                    `json:"cadence" binding:"required,oneof=weekly biweekly monthly" example:"weekly"`
+	AddressID          *int64                    `json:"address_id" example:"1"`
+	AllowSubstitutions *bool                     `json:"allow_substitutions" example:"true"`
+	FirstDeliveryAt    *time.Time                `json:"first_delivery_at" example:"2026-10-26T08:00:00Z"`
+	Items              []SubscriptionItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type NextQuantityRequest struct {
+	ProductID int64 `json:"product_id" binding:"required" example:"1"`
+	Quantity  int   `json:"quantity" binding:"gte=0" example:"0"`
+}
+
+// NextDeliveryRequest changes only the next delivery of a subscription.
+type NextDeliveryRequest struct {
+	RunAt *time.Time            `json:"run_at" example:"2026-10-28T08:00:00Z"`
+	Items []NextQuantityRequest `json:"items" binding:"dive"`
+}
+
+type PauseRequest struct {
+	Until *time.Time `json:"until" example:"2026-11-15T00:00:00Z"`
+}
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Subscription cancelled"`
+}
+
+// After returns when the delivery following t is due.
+func (s *Subscription) After(t time.Time) time.Time {
+	switch s.Cadence {
+	case CadenceBiweekly:
+		return t.AddDate(0, 0, 14)
+	case CadenceMonthly:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 7)
+	}
+}
+
+// findSubscription loads one of the user's subscriptions in the store with
+// its items.
+func findSubscription(ctx context.Context, db bun.IDB, storeID, userID int64, id string) (*Subscription, error) {
+	subscription := new(Subscription)
+	err := db.NewSelect().
+		Model(subscription).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("subscription_item.id ASC")
+		}).
+		Where("subscription.id = ?", id).
+		Where("subscription.store_id = ?", storeID).
+		Where("subscription.user_id = ?", userID).
+		Where("subscription.status <> ?", StatusCancelled).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+// validateRequest checks that the address exists and every product is sold in
+// the store.
+func validateRequest(ctx context.Context, db bun.IDB, storeID, userID int64, request *SubscriptionRequest) string {
+	if request.AddressID != nil {
+		if _, err := addressRoutes.FindAddress(ctx, db, userID, request.AddressID); err != nil {
+			return "Address not found"
+		}
+	}
+
+	listed := make(map[int64]bool, len(request.Items))
+	ids := make(map[int64]bool, len(request.Items)*2)
+	for _, item := range request.Items {
+		if listed[item.ProductID] {
+			return "Each product can only be listed once"
+		}
+		listed[item.ProductID] = true
+		ids[item.ProductID] = true
+		if item.SubstituteProductID != nil {
+			ids[*item.SubstituteProductID] = true
+		}
+	}
+
+	productIDs := make([]int64, 0, len(ids))
+	for id := range ids {
+		productIDs = append(productIDs, id)
+	}
+	count, err := db.NewSelect().
+		Model((*productRoutes.Product)(nil)).
+		Where("id IN (?)", bun.In(productIDs)).
+		Where("store_id = ?", storeID).
+		Count(ctx)
+	if err != nil || count != len(productIDs) {
+		return "Product not found"
+	}
+	return ""
+}
+
+// replaceItems swaps the subscription's items for the requested ones.
+func replaceItems(ctx context.Context, tx bun.Tx, subscriptionID int64, requested []SubscriptionItemRequest) ([]SubscriptionItem, error) {
+	_, err := tx.NewDelete().
+		Model((*SubscriptionItem)(nil)).
+		Where("subscription_id = ?", subscriptionID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]SubscriptionItem, 0, len(requested))
+	for _, item := range requested {
+		items = append(items, SubscriptionItem{
+			SubscriptionID:      subscriptionID,
+			ProductID:           item.ProductID,
+			Quantity:            item.Quantity,
+			SubstituteProductID: item.SubstituteProductID,
+		})
+	}
+	_, err = tx.NewInsert().Model(&items).Returning("*").Exec(ctx)
+	return items, err
+}
+
+// @Summary Get my subscriptions
+// @Description Retrieve the current user's recurring orders in the current store with their items
+// @Tags Subscriptions
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of subscriptions"
+// @Failure 500 {object} problem.Problem "Couldn't fetch subscriptions"
+// @Router /subscriptions [get]
+func GetSubscriptions(ctx *gin.Context) {
+	var subscriptions []Subscription
+
+	err := database.BunDB.NewSelect().
+		Model(&subscriptions).
+		Relation("Items").
+		Where("subscription.store_id = ?", store.ID(ctx)).
+		Where("subscription.user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Where("subscription.status <> ?", StatusCancelled).
+		Order("subscription.id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch subscriptions")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+// @Summary Get a subscription by ID
+// @Description Retrieve one of the current user's subscriptions with its items and its last orders, including substitutions and payment failures
+// @Tags Subscriptions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Success 200 {object} Subscription
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Router /subscriptions/{id} [get]
+func GetSubscription(ctx *gin.Context) {
+	subscription, err := findSubscription(ctx.Request.Context(), database.BunDB, store.ID(ctx), auth.CurrentClaims(ctx).UserID, ctx.Param("id"))
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+
+	err = database.BunDB.NewSelect().
+		Model(&subscription.Runs).
+		Where("subscription_id = ?", subscription.ID).
+		Order("id DESC").
+		Limit(10).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch subscription")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// @Summary Create a subscription
+// @Description Order the same products every week, every other week or every month. The first order is placed at first_delivery_at, or one cadence from now.
+// @Tags Subscriptions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param subscription body SubscriptionRequest true "Subscription"
+// @Success 201 {object} Subscription
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create subscription"
+// @Router /subscriptions [post]
+func CreateSubscription(ctx *gin.Context) {
+	var request SubscriptionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	userID := auth.CurrentClaims(ctx).UserID
+
+	if msg := validateRequest(ctx.Request.Context(), database.BunDB, store.ID(ctx), userID, &request); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+
+	subscription := &Subscription{
+		StoreID:            store.ID(ctx),
+		UserID:             userID,
+		Name:               request.Name,
+		Cadence:            request.Cadence,
+		AddressID:          request.AddressID,
+		AllowSubstitutions: request.AllowSubstitutions == nil || *request.AllowSubstitutions,
+		Status:             StatusActive,
+	}
+	subscription.NextRunAt = subscription.After(time.Now())
+	if request.FirstDeliveryAt != nil {
+		if !request.FirstDeliveryAt.After(time.Now()) {
+			problem.Abort(ctx, http.StatusBadRequest, "first_delivery_at must be in the future")
+			return
+		}
+		subscription.NextRunAt = *request.FirstDeliveryAt
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(subscription).Returning("*").Exec(c); err != nil {
+			return err
+		}
+		var err error
+		subscription.Items, err = replaceItems(c, tx, subscription.ID, request.Items)
+		return err
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create subscription")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, subscription)
+}
+
+// @Summary Update a subscription
+// @Description Replace the name, cadence, address and products of one of the current user's subscriptions. The next delivery date is kept unless first_delivery_at is given.
+// @Tags Subscriptions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Param subscription body SubscriptionRequest true "Subscription"
+// @Success 200 {object} Subscription
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not update subscription"
+// @Router /subscriptions/{id} [put]
+func UpdateSubscription(ctx *gin.Context) {
+	var request SubscriptionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	userID := auth.CurrentClaims(ctx).UserID
+
+	if msg := validateRequest(ctx.Request.Context(), database.BunDB, store.ID(ctx), userID, &request); msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+	if request.FirstDeliveryAt != nil && !request.FirstDeliveryAt.After(time.Now()) {
+		problem.Abort(ctx, http.StatusBadRequest, "first_delivery_at must be in the future")
+		return
+	}
+
+	var subscription *Subscription
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var err error
+		subscription, err = findSubscription(c, tx, store.ID(ctx), userID, ctx.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		subscription.Name = request.Name
+		subscription.Cadence = request.Cadence
+		subscription.AddressID = request.AddressID
+		if request.AllowSubstitutions != nil {
+			subscription.AllowSubstitutions = *request.AllowSubstitutions
+		}
+		if request.FirstDeliveryAt != nil {
+			subscription.NextRunAt = *request.FirstDeliveryAt
+		}
+		_, err = tx.NewUpdate().
+			Model(subscription).
+			Column("name", "cadence", "address_id", "allow_substitutions", "next_run_at").
+			WherePK().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		subscription.Items, err = replaceItems(c, tx, subscription.ID, request.Items)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update subscription")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// @Summary Change the next delivery
+// @Description Move the next delivery of one of the current user's subscriptions and/or change product quantities for that delivery only. A quantity of 0 leaves the product out.
+// @Tags Subscriptions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Param next body NextDeliveryRequest true "Next delivery changes"
+// @Success 200 {object} Subscription
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not update next delivery"
+// @Router /subscriptions/{id}/next-delivery [put]
+func UpdateNextDelivery(ctx *gin.Context) {
+	var request NextDeliveryRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	if request.RunAt != nil && !request.RunAt.After(time.Now()) {
+		problem.Abort(ctx, http.StatusBadRequest, "run_at must be in the future")
+		return
+	}
+
+	var subscription *Subscription
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var err error
+		subscription, err = findSubscription(c, tx, store.ID(ctx), auth.CurrentClaims(ctx).UserID, ctx.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		if request.RunAt != nil {
+			subscription.NextRunAt = *request.RunAt
+			_, err = tx.NewUpdate().Model(subscription).Column("next_run_at").WherePK().Exec(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, change := range request.Items {
+			found := false
+			for i := range subscription.Items {
+				item := &subscription.Items[i]
+				if item.ProductID != change.ProductID {
+					continue
+				}
+				found = true
+				quantity := change.Quantity
+				item.NextQuantity = &quantity
+				_, err = tx.NewUpdate().Model(item).Column("next_quantity").WherePK().Exec(c)
+				if err != nil {
+					return err
+				}
+			}
+			if !found {
+				return errUnknownItem
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	if errors.Is(err, errUnknownItem) {
+		problem.Abort(ctx, http.StatusBadRequest, "Product is not part of this subscription")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update next delivery")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// @Summary Skip the next delivery
+// @Description Skip the next delivery of one of the current user's subscriptions. The following one is scheduled one cadence later.
+// @Tags Subscriptions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Success 200 {object} Subscription
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not skip delivery"
+// @Router /subscriptions/{id}/skip [post]
+func SkipNextDelivery(ctx *gin.Context) {
+	var subscription *Subscription
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var err error
+		subscription, err = findSubscription(c, tx, store.ID(ctx), auth.CurrentClaims(ctx).UserID, ctx.Param("id"))
+		if err != nil {
+			return err
+		}
+
+		run := &SubscriptionRun{
+			SubscriptionID: subscription.ID,
+			ScheduledFor:   subscription.NextRunAt,
+			Status:         RunSkipped,
+		}
+		if _, err := tx.NewInsert().Model(run).Exec(c); err != nil {
+			return err
+		}
+		return advance(c, tx, subscription)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not skip delivery")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// @Summary Pause a subscription
+// @Description Stop placing orders for one of the current user's subscriptions, until resumed or, if given, until a date
+// @Tags Subscriptions
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Param pause body PauseRequest false "Optional end of the pause"
+// @Success 200 {object} SuccessResponse "Subscription paused"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not pause subscription"
+// @Router /subscriptions/{id}/pause [post]
+func PauseSubscription(ctx *gin.Context) {
+	var request PauseRequest
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			problem.Invalid(ctx, err)
+			return
+		}
+	}
+	if request.Until != nil && !request.Until.After(time.Now()) {
+		problem.Abort(ctx, http.StatusBadRequest, "until must be in the future")
+		return
+	}
+
+	result, err := database.BunDB.NewUpdate().
+		Model((*Subscription)(nil)).
+		Set("status = ?", StatusPaused).
+		Set("paused_until = ?", request.Until).
+		Where("id = ?", ctx.Param("id")).
+		Where("store_id = ?", store.ID(ctx)).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Where("status <> ?", StatusCancelled).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not pause subscription")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Subscription paused"})
+}
+
+// @Summary Resume a subscription
+// @Description Resume a paused subscription. Deliveries missed while paused are not placed; the next one is scheduled in the future.
+// @Tags Subscriptions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Success 200 {object} Subscription
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not resume subscription"
+// @Router /subscriptions/{id}/resume [post]
+func ResumeSubscription(ctx *gin.Context) {
+	var subscription *Subscription
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var err error
+		subscription, err = findSubscription(c, tx, store.ID(ctx), auth.CurrentClaims(ctx).UserID, ctx.Param("id"))
+		if err != nil {
+			return err
+		}
+		return resume(c, tx, subscription)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not resume subscription")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, subscription)
+}
+
+// @Summary Cancel a subscription
+// @Description Cancel one of the current user's subscriptions. Orders already placed are kept.
+// @Tags Subscriptions
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Subscription ID"
+// @Success 200 {object} SuccessResponse "Subscription cancelled"
+// @Failure 404 {object} problem.Problem "Subscription not found"
+// @Failure 500 {object} problem.Problem "Could not cancel subscription"
+// @Router /subscriptions/{id} [delete]
+func CancelSubscription(ctx *gin.Context) {
+	result, err := database.BunDB.NewUpdate().
+		Model((*Subscription)(nil)).
+		Set("status = ?", StatusCancelled).
+		Where("id = ?", ctx.Param("id")).
+		Where("store_id = ?", store.ID(ctx)).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Where("status <> ?", StatusCancelled).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not cancel subscription")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Subscription not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Subscription cancelled"})
+}
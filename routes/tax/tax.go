@@ -0,0 +1,283 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/tax"
+	"github.com/uptrace/bun"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"Tax class deleted successfully!"`
+}
+
+type TaxClassAssignment struct {
+	TaxClassID *int64 `json:"tax_class_id" example:"1"`
+}
+
+// storeClasses selects the IDs of the current store's tax classes.
+func storeClasses(ctx *gin.Context) *bun.SelectQuery {
+	return database.BunDB.NewSelect().
+		Model((*tax.TaxClass)(nil)).
+		Column("id").
+		Where("store_id = ?", store.ID(ctx))
+}
+
+// @Summary Create a tax class
+// @Description Create a tax class in the current store. Marking it as default moves the default flag from the store's previous default class.
+// @Tags Taxes
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param class body tax.TaxClass true "Tax class"
+// @Success 201 {object} tax.TaxClass
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 409 {object} problem.Problem "Tax class already exists"
+// @Router /tax/classes [post]
+func CreateTaxClass(ctx *gin.Context) {
+	var class tax.TaxClass
+
+	if err := ctx.ShouldBindJSON(&class); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	class.StoreID = store.ID(ctx)
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if class.IsDefault {
+			_, err := tx.NewUpdate().
+				Model((*tax.TaxClass)(nil)).
+				Set("is_default = FALSE").
+				Where("store_id = ?", class.StoreID).
+				Where("is_default = TRUE").
+				Exec(c)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.NewInsert().Model(&class).Exec(c)
+		return err
+	})
+	if err != nil {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Tax class already exists")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, class)
+}
+
+// @Summary Get all tax classes
+// @Description Retrieve every tax class of the current store
+// @Tags Taxes
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of tax classes"
+// @Failure 500 {object} problem.Problem "Couldn't fetch tax classes"
+// @Router /tax/classes [get]
+func GetTaxClasses(ctx *gin.Context) {
+	var classes []tax.TaxClass
+
+	err := database.BunDB.NewSelect().
+		Model(&classes).
+		Where("store_id = ?", store.ID(ctx)).
+		Order("id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch tax classes")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"classes": classes})
+}
+
+// @Summary Delete a tax class by ID
+// @Description Delete a tax class and its rates. Products using it fall back to the default class.
+// @Tags Taxes
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Tax class ID"
+// @Success 200 {object} SuccessResponse "Tax class deleted successfully!"
+// @Failure 404 {object} problem.Problem "Tax class not found"
+// @Failure 500 {object} problem.Problem "Failed to delete tax class"
+// @Router /tax/classes/{id} [delete]
+func DeleteTaxClass(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*tax.TaxClass)(nil)).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete tax class")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Tax class not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Tax class deleted successfully!"})
+}
+
+// @Summary Create a tax rate
+// @Description Create a rate for a tax class of the current store in a country, or in a region of it when region is set
+// @Tags Taxes
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param rate body tax.TaxRate true "Tax rate"
+// @Success 201 {object} tax.TaxRate
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create tax rate"
+// @Router /tax/rates [post]
+func CreateTaxRate(ctx *gin.Context) {
+	var rate tax.TaxRate
+
+	if err := ctx.ShouldBindJSON(&rate); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	rate.Country = strings.ToUpper(rate.Country)
+
+	exists, err := database.BunDB.NewSelect().
+		Model((*tax.TaxClass)(nil)).
+		Where("id = ?", rate.TaxClassID).
+		Where("store_id = ?", store.ID(ctx)).
+		Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusBadRequest, "Tax class not found")
+		return
+	}
+
+	_, err = database.BunDB.NewInsert().Model(&rate).Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create tax rate")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, rate)
+}
+
+// @Summary Get tax rates
+// @Description Retrieve the tax rates of the current store, optionally only those of one country
+// @Tags Taxes
+// @Produce  json
+// @Security BearerAuth
+// @Param country query string false "ISO 3166-1 alpha-2 country code"
+// @Success 200 {object} map[string]interface{} "List of tax rates"
+// @Failure 500 {object} problem.Problem "Couldn't fetch tax rates"
+// @Router /tax/rates [get]
+func GetTaxRates(ctx *gin.Context) {
+	var rates []tax.TaxRate
+
+	query := database.BunDB.NewSelect().
+		Model(&rates).
+		Where("tax_class_id IN (?)", storeClasses(ctx)).
+		Order("country ASC", "region ASC", "id ASC")
+	if country := ctx.Query("country"); country != "" {
+		query = query.Where("country = ?", strings.ToUpper(country))
+	}
+	if err := query.Scan(ctx.Request.Context()); err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch tax rates")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"rates": rates})
+}
+
+// @Summary Delete a tax rate by ID
+// @Description Delete a tax rate
+// @Tags Taxes
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Tax rate ID"
+// @Success 200 {object} SuccessResponse "Tax rate deleted successfully!"
+// @Failure 404 {object} problem.Problem "Tax rate not found"
+// @Failure 500 {object} problem.Problem "Failed to delete tax rate"
+// @Router /tax/rates/{id} [delete]
+func DeleteTaxRate(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	result, err := database.BunDB.NewDelete().
+		Model((*tax.TaxRate)(nil)).
+		Where("id = ?", id).
+		Where("tax_class_id IN (?)", storeClasses(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete tax rate")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Tax rate not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Tax rate deleted successfully!"})
+}
+
+// @Summary Assign a tax class to a product
+// @Description Set the tax class of a product. A null tax_class_id makes the product use the default class.
+// @Tags Taxes
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Product ID"
+// @Param assignment body TaxClassAssignment true "Tax class"
+// @Success 200 {object} SuccessResponse "Tax class assigned"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Product not found"
+// @Failure 500 {object} problem.Problem "Failed to assign tax class"
+// @Router /products/{id}/tax-class [put]
+func AssignProductTaxClass(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	var assignment TaxClassAssignment
+	if err := ctx.ShouldBindJSON(&assignment); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	if assignment.TaxClassID != nil {
+		exists, err := database.BunDB.NewSelect().
+			Model((*tax.TaxClass)(nil)).
+			Where("id = ?", *assignment.TaxClassID).
+			Where("store_id = ?", store.ID(ctx)).
+			Exists(ctx.Request.Context())
+		if err != nil || !exists {
+			problem.Abort(ctx, http.StatusBadRequest, "Tax class not found")
+			return
+		}
+	}
+
+	result, err := database.BunDB.NewUpdate().
+		Model((*productRoutes.Product)(nil)).
+		Set("tax_class_id = ?", assignment.TaxClassID).
+		Where("id = ?", id).
+		Where("store_id = ?", store.ID(ctx)).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to assign tax class")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Tax class assigned"})
+}
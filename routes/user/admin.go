@@ -0,0 +1,377 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// maxPerPage caps the page size of user searches.
+const maxPerPage = 100
+
+// userSortColumns are the columns users can be sorted by.
+var userSortColumns = []string{"created_at", "username", "last_login_at"}
+
+type ImpersonationResponse struct {
+	Message string `json:"message" example:"Impersonating jane"`
+	// Token acts as the user until ExpiresAt. Changing the password, paying
+	// and other sensitive actions are refused with it.
+	Token     string       `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+	ExpiresAt time.Time    `json:"expires_at"`
+	User      UserResponse `json:"user"`
+}
+
+// impersonationTTL is how long an impersonation token lasts, configured with
+// IMPERSONATION_MINUTES.
+func impersonationTTL() time.Duration {
+	return time.Duration(envInt("IMPERSONATION_MINUTES", 15)) * time.Minute
+}
+
+// likeEscaper makes search text match literally in an ILIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// pagination reads the page and per_page query parameters, aborting the
+// request if they are invalid.
+func pagination(ctx *gin.Context) (int, int, bool) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid page")
+		return 0, 0, false
+	}
+	perPage, err := strconv.Atoi(ctx.DefaultQuery("per_page", "20"))
+	if err != nil || perPage < 1 || perPage > maxPerPage {
+		problem.Abort(ctx, http.StatusBadRequest, "per_page must be between 1 and "+strconv.Itoa(maxPerPage))
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// targetUser loads the user an admin action is about, aborting the request
+// if that fails. Admins can't use these actions on their own account.
+func targetUser(ctx *gin.Context) (*User, bool) {
+	user := new(User)
+	err := database.BunDB.NewSelect().
+		Model(user).
+		Where("id = ?", ctx.Param("id")).
+		Scan(ctx.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch user")
+		return nil, false
+	}
+	if user.ID == auth.CurrentClaims(ctx).UserID {
+		problem.Abort(ctx, http.StatusBadRequest, "You can't do this to your own account")
+		return nil, false
+	}
+	return user, true
+}
+
+// revokeSessions signs the user out everywhere, including the apps they
+// authorized.
+func revokeSessions(ctx context.Context, tx bun.Tx, userID int64) error {
+	_, err := tx.NewUpdate().
+		Model((*User)(nil)).
+		Set("session_version = session_version + 1").
+		Where("id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*OAuthToken)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+// @Summary Change a user's role
+// @Description Give a user another role. The user is signed out everywhere so their tokens pick it up. Service accounts can't be admins.
+// @Tags Users
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Param role body UserRoleRequest true "New role"
+// @Success 200 {object} map[string]AdminUserResponse
+// @Failure 400 {object} problem.Problem "Invalid role, or your own account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Failed to change role"
+// @Router /users/{id}/role [put]
+func UpdateUserRole(ctx *gin.Context) {
+	var request UserRoleRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	if user.ServiceAccount && request.Role == auth.RoleAdmin {
+		problem.Abort(ctx, http.StatusBadRequest, "Service accounts can't be admins")
+		return
+	}
+
+	entry := audit.New(ctx, "user.role_change", "user", user.ID).
+		Diff(gin.H{"role": user.Role}, gin.H{"role": request.Role})
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("role = ?", request.Role).
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if err := revokeSessions(c, tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, entry)
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+	user.Role = request.Role
+
+	ctx.JSON(http.StatusOK, gin.H{"user": NewAdminUserResponse(user)})
+}
+
+// @Summary Disable a user
+// @Description Disable a user's account. They are signed out everywhere, can't sign in and their API keys stop working until the account is enabled again.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "User disabled"
+// @Failure 400 {object} problem.Problem "You can't do this to your own account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 409 {object} problem.Problem "User is already disabled"
+// @Failure 500 {object} problem.Problem "Failed to disable user"
+// @Router /users/{id}/disable [post]
+func DisableUser(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	if user.DisabledAt != nil {
+		problem.Abort(ctx, http.StatusConflict, "User is already disabled")
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("disabled_at = ?", time.Now()).
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if err := revokeSessions(c, tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.disable", "user", user.ID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to disable user")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "User disabled"})
+}
+
+// @Summary Enable a user
+// @Description Enable a disabled user's account again
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "User enabled"
+// @Failure 404 {object} problem.Problem "Disabled user not found"
+// @Failure 500 {object} problem.Problem "Failed to enable user"
+// @Router /users/{id}/enable [post]
+func EnableUser(ctx *gin.Context) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("disabled_at = NULL").
+			Where("id = ?", ctx.Param("id")).
+			Where("disabled_at IS NOT NULL").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.enable", "user", ctx.Param("id")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Disabled user not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to enable user")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "User enabled"})
+}
+
+// @Summary Force a password reset
+// @Description Sign a user out everywhere and stop them signing in with their password until they reset it. A reset link is emailed to them if they have an address.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "Password reset required"
+// @Failure 400 {object} problem.Problem "You can't do this to your own account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Failed to require a password reset"
+// @Router /users/{id}/password-reset [post]
+func ForcePasswordReset(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("password_reset_required = TRUE").
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if err := revokeSessions(c, tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.password_reset_force", "user", user.ID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to require a password reset")
+		return
+	}
+
+	message := "Password reset required, no email address to send a link to"
+	if user.Email != nil {
+		message = "Password reset required, reset link sent"
+		if err := sendPasswordReset(ctx.Request.Context(), database.BunDB, user); err != nil {
+			fmt.Printf("Password reset for user %d failed: %v\n", user.ID, err)
+			message = "Password reset required, but the reset link could not be sent"
+		}
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: message})
+}
+
+// @Summary Revoke a user's sessions
+// @Description Sign a user out everywhere and revoke the tokens of every app they authorized. API keys are not affected.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "Sessions revoked"
+// @Failure 400 {object} problem.Problem "You can't do this to your own account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Failed to revoke sessions"
+// @Router /users/{id}/sessions [delete]
+func RevokeUserSessions(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := revokeSessions(c, tx, user.ID); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.sessions_revoke", "user", user.ID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Sessions revoked"})
+}
+
+// @Summary Impersonate a user
+// @Description Get a short-lived token, valid for IMPERSONATION_MINUTES (15 by default), to see the shop as a customer, for support. The token carries both identities: requests act as the user, but sensitive actions such as changing the password, paying or managing sign-in methods are refused. Every request made with it is recorded in the audit log. Signing the admin out ends it. Admins and service accounts can't be impersonated.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} problem.Problem "Your own account, an admin, a service account or a disabled account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Failed to impersonate user"
+// @Router /users/{id}/impersonate [post]
+func ImpersonateUser(ctx *gin.Context) {
+	user, ok := targetUser(ctx)
+	if !ok {
+		return
+	}
+	switch {
+	case user.Role == auth.RoleAdmin:
+		problem.Abort(ctx, http.StatusBadRequest, "Admins can't be impersonated")
+		return
+	case user.ServiceAccount:
+		problem.Abort(ctx, http.StatusBadRequest, "Service accounts can't be impersonated")
+		return
+	case user.DisabledAt != nil:
+		problem.Abort(ctx, http.StatusBadRequest, "Disabled accounts can't be impersonated")
+		return
+	}
+
+	admin := auth.CurrentClaims(ctx)
+	expiresAt := time.Now().Add(impersonationTTL())
+	token, err := auth.GenerateImpersonationToken(auth.Claims{
+		UserID:                     user.ID,
+		Username:                   user.Username,
+		Role:                       user.Role,
+		SessionVersion:             user.SessionVersion,
+		ImpersonatorID:             admin.UserID,
+		ImpersonatorUsername:       admin.Username,
+		ImpersonatorSessionVersion: admin.SessionVersion,
+	}, expiresAt)
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+
+	entry := audit.New(ctx, "user.impersonate", "user", user.ID).
+		Diff(nil, gin.H{"expires_at": expiresAt})
+	if err := audit.Record(ctx.Request.Context(), database.BunDB, entry); err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to impersonate user")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ImpersonationResponse{
+		Message:   "Impersonating " + user.Username,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      NewUserResponse(user),
+	})
+}
@@ -0,0 +1,405 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// lastUsedPrecision limits how often a key's last use is written, so busy
+// integrations don't update the row on every request.
+const lastUsedPrecision = time.Minute
+
+var (
+	errInvalidAPIKey = errors.New("invalid, expired or revoked API key")
+	errUserExists    = errors.New("user already exists")
+)
+
+// APIKey lets a server call the API as its owner, limited to its scopes. The
+// key is "<prefix>_<secret>"; the prefix identifies it and only the SHA-256
+// hash of the whole key is stored.
+type APIKey struct {
+	bun.BaseModel `bun:"table:api_keys,alias:api_key" swaggerignore:"true"`
+
+	ID         int64      `bun:",pk,autoincrement" json:"id"`
+	UserID     int64      `bun:"user_id,notnull" json:"user_id"`
+	Name       string     `bun:"name,notnull" json:"name" example:"Warehouse stock sync"`
+	Prefix     string     `bun:"prefix,unique,notnull" json:"prefix" example:"hbk_1f9c2a7e"`
+	KeyHash    string     `bun:"key_hash,notnull" json:"-"`
+	Scopes     []string   `bun:"scopes,array,notnull" json:"scopes" example:"products:write"`
+	ExpiresAt  *time.Time `bun:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bun:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `bun:"revoked_at" json:"revoked_at,omitempty"`
+	// CreatedBy is unset once the user who created the key is deleted.
+	CreatedBy *int64    `bun:"created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required" example:"Warehouse stock sync"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1" example:"products:write"`
+	ExpiresAt *time.Time `json:"expires_at" example:"2027-10-19T00:00:00Z"`
+}
+
+type APIKeyResponse struct {
+	APIKey
+	// Key is only shown once, at creation.
+	Key string `json:"key" example:"hbk_1f9c2a7e_Qm9vZ2xlIGlzIG5vdCBhIHNlY3JldA"`
+}
+
+type ServiceAccountRequest struct {
+	Username string `json:"username" binding:"required" example:"warehouse"`
+	Role     string `json:"role" binding:"required,oneof=customer staff" example:"staff"`
+}
+
+// newAPIKey returns a random key and its prefix.
+func newAPIKey() (string, string, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	secret, _, err := newToken()
+	if err != nil {
+		return "", "", err
+	}
+	prefix := auth.APIKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// createAPIKey creates a key for the owner from the request body.
+func createAPIKey(ctx *gin.Context, ownerID int64) {
+	var request APIKeyRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	scopes := auth.ParseScope(strings.Join(request.Scopes, " "))
+	if !auth.ValidScopes(scopes, scopes) {
+		problem.Abort(ctx, http.StatusBadRequest, "Unknown scope")
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		problem.Abort(ctx, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	key, prefix, err := newAPIKey()
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create API key")
+		return
+	}
+	createdBy := auth.CurrentClaims(ctx).UserID
+	response := APIKeyResponse{
+		APIKey: APIKey{
+			UserID:    ownerID,
+			Name:      request.Name,
+			Prefix:    prefix,
+			KeyHash:   hashToken(key),
+			Scopes:    scopes,
+			ExpiresAt: request.ExpiresAt,
+			CreatedBy: &createdBy,
+		},
+		Key: key,
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&response.APIKey).Returning("*").Exec(c); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "api_key.create", "api_key", response.ID).Diff(nil, response.APIKey))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create API key")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// AuthenticateAPIKey checks an API key and returns its owner's claims, for
+// auth.APIKey.
+func AuthenticateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	rest, _ := strings.CutPrefix(key, auth.APIKeyPrefix)
+	id, _, found := strings.Cut(rest, "_")
+	if !found {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey := new(APIKey)
+	err := database.BunDB.NewSelect().
+		Model(apiKey).
+		Where("prefix = ?", auth.APIKeyPrefix+id).
+		Scan(ctx)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(key)), []byte(apiKey.KeyHash)) != 1 ||
+		apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt)) {
+		return nil, errInvalidAPIKey
+	}
+
+	owner := new(User)
+	if err := database.BunDB.NewSelect().Model(owner).Where("id = ?", apiKey.UserID).Scan(ctx); err != nil {
+		return nil, errInvalidAPIKey
+	}
+	// Keys of a disabled account, or one scheduled for deletion, rest
+	// meanwhile.
+	if owner.DeletionScheduledAt != nil || owner.DisabledAt != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || time.Since(*apiKey.LastUsedAt) > lastUsedPrecision {
+		_, err = database.BunDB.NewUpdate().
+			Model((*APIKey)(nil)).
+			Set("last_used_at = ?", time.Now()).
+			Where("id = ?", apiKey.ID).
+			Exec(ctx)
+		if err != nil {
+			fmt.Printf("Recording use of API key %d failed: %v\n", apiKey.ID, err)
+		}
+	}
+
+	return &auth.Claims{
+		UserID:         owner.ID,
+		Username:       owner.Username,
+		Role:           owner.Role,
+		SessionVersion: owner.SessionVersion,
+		Scope:          strings.Join(apiKey.Scopes, " "),
+		APIKeyID:       apiKey.ID,
+	}, nil
+}
+
+// @Summary Create an API key
+// @Description Create an API key that lets a server call the API as the current user, limited to the given scopes. Send it as the bearer token or in the X-API-Key header. The key is only returned here.
+// @Tags API keys
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param key body APIKeyRequest true "API key"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create API key"
+// @Router /api-keys [post]
+func CreateAPIKey(ctx *gin.Context) {
+	createAPIKey(ctx, auth.CurrentClaims(ctx).UserID)
+}
+
+// @Summary Get my API keys
+// @Description Retrieve the current user's API keys, including revoked and expired ones
+// @Tags API keys
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of API keys"
+// @Failure 500 {object} problem.Problem "Couldn't fetch API keys"
+// @Router /api-keys [get]
+func GetAPIKeys(ctx *gin.Context) {
+	var keys []APIKey
+
+	err := database.BunDB.NewSelect().
+		Model(&keys).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("created_at DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch API keys")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// @Summary Revoke an API key
+// @Description Revoke one of the current user's API keys. Admins can revoke any key, including those of service accounts.
+// @Tags API keys
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "API key ID"
+// @Success 200 {object} SuccessResponse "API key revoked"
+// @Failure 404 {object} problem.Problem "API key not found"
+// @Failure 500 {object} problem.Problem "Failed to revoke API key"
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(ctx *gin.Context) {
+	claims := auth.CurrentClaims(ctx)
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		query := tx.NewUpdate().
+			Model((*APIKey)(nil)).
+			Set("revoked_at = ?", time.Now()).
+			Where("id = ?", ctx.Param("id")).
+			Where("revoked_at IS NULL")
+		if claims.Role != auth.RoleAdmin {
+			query = query.Where("user_id = ?", claims.UserID)
+		}
+
+		result, err := query.Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "api_key.revoke", "api_key", ctx.Param("id")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "API key revoked"})
+}
+
+// @Summary Create a service account
+// @Description Create a user for a server integration, such as the warehouse system. Service accounts can't log in; they act through API keys.
+// @Tags API keys
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param account body ServiceAccountRequest true "Service account"
+// @Success 201 {object} map[string]UserResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 409 {object} problem.Problem "User already exists"
+// @Failure 500 {object} problem.Problem "Could not create service account"
+// @Router /service-accounts [post]
+func CreateServiceAccount(ctx *gin.Context) {
+	var request ServiceAccountRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	account := &User{
+		Username:       request.Username,
+		Role:           request.Role,
+		ServiceAccount: true,
+	}
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(account).Returning("*").Exec(c); err != nil {
+			if database.IsUniqueViolation(err) {
+				return errUserExists
+			}
+			return err
+		}
+		entry := audit.New(ctx, "service_account.create", "user", account.ID).Diff(nil, NewUserResponse(account)).Redact(personalFields...)
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, errUserExists) {
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "User already exists")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create service account")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"service_account": NewUserResponse(account)})
+}
+
+// @Summary Get service accounts
+// @Description Retrieve every service account
+// @Tags API keys
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of service accounts"
+// @Failure 500 {object} problem.Problem "Couldn't fetch service accounts"
+// @Router /service-accounts [get]
+func GetServiceAccounts(ctx *gin.Context) {
+	var accounts []User
+
+	err := database.BunDB.NewSelect().
+		Model(&accounts).
+		Where("service_account = TRUE").
+		Order("username ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch service accounts")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"service_accounts": NewUserResponses(accounts)})
+}
+
+// serviceAccountID returns the ID of the service account in the path, or
+// aborts with 404.
+func serviceAccountID(ctx *gin.Context) (int64, bool) {
+	account := new(User)
+	err := database.BunDB.NewSelect().
+		Model(account).
+		Column("id").
+		Where("id = ?", ctx.Param("id")).
+		Where("service_account = TRUE").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "Service account not found")
+		return 0, false
+	}
+	return account.ID, true
+}
+
+// @Summary Create a service account API key
+// @Description Create an API key for a service account. The key is only returned here.
+// @Tags API keys
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Service account ID"
+// @Param key body APIKeyRequest true "API key"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "Service account not found"
+// @Failure 500 {object} problem.Problem "Could not create API key"
+// @Router /service-accounts/{id}/api-keys [post]
+func CreateServiceAccountKey(ctx *gin.Context) {
+	accountID, ok := serviceAccountID(ctx)
+	if !ok {
+		return
+	}
+	createAPIKey(ctx, accountID)
+}
+
+// @Summary Get a service account's API keys
+// @Description Retrieve every API key of a service account
+// @Tags API keys
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "Service account ID"
+// @Success 200 {object} map[string]interface{} "List of API keys"
+// @Failure 404 {object} problem.Problem "Service account not found"
+// @Failure 500 {object} problem.Problem "Couldn't fetch API keys"
+// @Router /service-accounts/{id}/api-keys [get]
+func GetServiceAccountKeys(ctx *gin.Context) {
+	accountID, ok := serviceAccountID(ctx)
+	if !ok {
+		return
+	}
+
+	var keys []APIKey
+	err := database.BunDB.NewSelect().
+		Model(&keys).
+		Where("user_id = ?", accountID).
+		Order("created_at DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch API keys")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
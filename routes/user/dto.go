@@ -0,0 +1,139 @@
+package routes
+
+import "time"
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required" example:"johndoe"`
+	Password string `json:"password" binding:"required" example:"correct horse battery staple"`
+	Email    string `json:"email" binding:"required,email" example:"john@example.com"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required" example:"johndoe"`
+	Password string `json:"password" binding:"required" example:"correct horse battery staple"`
+}
+
+// UpdateProfileRequest changes only the fields that are present. An empty
+// display name, phone or avatar URL clears it.
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" binding:"omitempty,min=1" example:"johndoe"`
+	Email       *string `json:"email" binding:"omitempty,email" example:"john@example.com"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100" example:"John Doe"`
+	Phone       *string `json:"phone" binding:"omitempty,len=0|e164" example:"+14155552671"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,len=0|url" example:"https://cdn.example.com/avatars/42.png"`
+}
+
+type ChangePasswordRequest struct {
+	// CurrentPassword may be left out by accounts that only sign in with a
+	// social provider and have no password yet.
+	CurrentPassword string `json:"current_password" example:"correct horse battery staple"`
+	NewPassword     string `json:"new_password" binding:"required" example:"a brand new passphrase"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+// UserResponse is the public view of a User.
+type UserResponse struct {
+	ID              int64      `json:"id" example:"42"`
+	Username        string     `json:"username" example:"johndoe"`
+	Role            string     `json:"role" example:"customer"`
+	Email           *string    `json:"email,omitempty" example:"john@example.com"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	MFAEnabled      bool       `json:"mfa_enabled" example:"false"`
+	ServiceAccount  bool       `json:"service_account,omitempty" example:"false"`
+	DisplayName     *string    `json:"display_name,omitempty" example:"John Doe"`
+	Phone           *string    `json:"phone,omitempty" example:"+14155552671"`
+	AvatarURL       *string    `json:"avatar_url,omitempty" example:"https://cdn.example.com/avatars/42.png"`
+	// DeletionScheduledAt is set while the account is due to be deleted.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	// DeletedAt is only set in the list of deleted users.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// personalFields are the UserResponse fields that identify a person. Their
+// values are redacted from the audit log, which outlives erasure.
+var personalFields = []string{"username", "email", "display_name", "phone", "avatar_url"}
+
+type UsersResponse struct {
+	Users []UserResponse `json:"users"`
+}
+
+// AdminUserResponse is the view of a User for admins, with the account's
+// status and where it signed up and last signed in from.
+type AdminUserResponse struct {
+	UserResponse
+	DisabledAt            *time.Time `json:"disabled_at,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required" example:"false"`
+	CreatedAt             time.Time  `json:"created_at"`
+	SignupIP              *string    `json:"signup_ip,omitempty" example:"203.0.113.7"`
+	SignupUserAgent       *string    `json:"signup_user_agent,omitempty" example:"Mozilla/5.0"`
+	LastLoginAt           *time.Time `json:"last_login_at,omitempty"`
+	LastLoginIP           *string    `json:"last_login_ip,omitempty" example:"203.0.113.7"`
+}
+
+// AdminUsersResponse is a page of users matching an admin search.
+type AdminUsersResponse struct {
+	Users   []AdminUserResponse `json:"users"`
+	Page    int                 `json:"page" example:"1"`
+	PerPage int                 `json:"per_page" example:"20"`
+	Total   int                 `json:"total" example:"134"`
+}
+
+type UserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=customer staff admin" example:"staff"`
+}
+
+// NewUserResponse maps a User to its public view.
+func NewUserResponse(user *User) UserResponse {
+	response := UserResponse{
+		ID:                  user.ID,
+		Username:            user.Username,
+		Role:                user.Role,
+		Email:               user.Email,
+		EmailVerifiedAt:     user.EmailVerifiedAt,
+		MFAEnabled:          user.TOTPEnabledAt != nil,
+		ServiceAccount:      user.ServiceAccount,
+		DisplayName:         user.DisplayName,
+		Phone:               user.Phone,
+		AvatarURL:           user.AvatarURL,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+	if !user.DeletedAt.IsZero() {
+		response.DeletedAt = &user.DeletedAt
+	}
+	return response
+}
+
+// NewUserResponses maps a list of users to their public views.
+func NewUserResponses(users []User) []UserResponse {
+	responses := make([]UserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, NewUserResponse(&users[i]))
+	}
+	return responses
+}
+
+// NewAdminUserResponse maps a User to its admin view.
+func NewAdminUserResponse(user *User) AdminUserResponse {
+	return AdminUserResponse{
+		UserResponse:          NewUserResponse(user),
+		DisabledAt:            user.DisabledAt,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+		SignupIP:              user.SignupIP,
+		SignupUserAgent:       user.SignupUserAgent,
+		LastLoginAt:           user.LastLoginAt,
+		LastLoginIP:           user.LastLoginIP,
+	}
+}
+
+// NewAdminUserResponses maps a list of users to their admin views.
+func NewAdminUserResponses(users []User) []AdminUserResponse {
+	responses := make([]AdminUserResponse, 0, len(users))
+	for i := range users {
+		responses = append(responses, NewAdminUserResponse(&users[i]))
+	}
+	return responses
+}
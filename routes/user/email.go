@@ -0,0 +1,232 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/mail"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// verificationTTL is how long an email verification link stays valid.
+const verificationTTL = 48 * time.Hour
+
+// dailyVerificationLimit caps how many verification emails a user can get
+// per day.
+const dailyVerificationLimit = 5
+
+var errInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// EmailVerificationToken is a link confirming Email belongs to the user. Only
+// the SHA-256 hash of the token is stored.
+type EmailVerificationToken struct {
+	ID        int64      `bun:",pk,autoincrement"`
+	UserID    int64      `bun:"user_id,notnull"`
+	Email     string     `bun:"email,notnull"`
+	TokenHash string     `bun:"token_hash,notnull,unique"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull"`
+	UsedAt    *time.Time `bun:"used_at"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required" example:"Zk9x2m1hQ0b7cVd3pLr8sT5uYw4aEe6fGh1jKl2mNo0"`
+}
+
+// resendCooldown is how long a user must wait between verification emails,
+// configured with EMAIL_RESEND_SECONDS.
+func resendCooldown() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("EMAIL_RESEND_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = 60
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// EmailVerified reports whether the user's email is verified for
+// auth.EmailVerified.
+func EmailVerified(ctx context.Context, userID int64) (bool, error) {
+	return database.BunDB.NewSelect().
+		Model((*User)(nil)).
+		Where("id = ?", userID).
+		Where("email IS NOT NULL").
+		Where("email_verified_at IS NOT NULL").
+		Exists(ctx)
+}
+
+// sendVerification emails the user a link confirming their current address.
+func sendVerification(ctx context.Context, db bun.IDB, user *User) error {
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewInsert().Model(&EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     *user.Email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(verificationTTL),
+	}).Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	message, err := mail.Render(*user.Email, "email_verification", map[string]any{
+		"Username":  user.Username,
+		"Email":     *user.Email,
+		"Link":      appURL() + "/verify-email?token=" + url.QueryEscape(token),
+		"ExpiresIn": verificationTTL.String(),
+	})
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(ctx, message)
+}
+
+// @Summary Verify an email address
+// @Description Confirm an email address with the token from a verification email
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} SuccessResponse "Email address verified"
+// @Failure 400 {object} problem.Problem "Invalid or expired verification token"
+// @Failure 500 {object} problem.Problem "Could not verify email address"
+// @Router /email/verify [post]
+func VerifyEmail(ctx *gin.Context) {
+	var request VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		verification := new(EmailVerificationToken)
+		err := tx.NewSelect().
+			Model(verification).
+			Where("token_hash = ?", hashToken(request.Token)).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", time.Now()).
+			For("UPDATE").
+			Scan(c)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidVerificationToken
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model(verification).
+			Set("used_at = ?", time.Now()).
+			WherePK().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		// A link for an address the user has since changed is no good.
+		result, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("email_verified_at = COALESCE(email_verified_at, ?)", time.Now()).
+			Where("id = ?", verification.UserID).
+			Where("email = ?", verification.Email).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return errInvalidVerificationToken
+		}
+		entry := audit.New(ctx, "user.email_verify", "user", verification.UserID).By(verification.UserID)
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, errInvalidVerificationToken) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not verify email address")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Email address verified"})
+}
+
+// @Summary Resend the verification email
+// @Description Send a new verification link to the current user's email address. Limited to one email per EMAIL_RESEND_SECONDS and five per day.
+// @Tags Auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} SuccessResponse "Verification email sent"
+// @Failure 400 {object} problem.Problem "No email address to verify"
+// @Failure 409 {object} problem.Problem "Email address already verified"
+// @Failure 429 {object} problem.Problem "Too many verification emails"
+// @Failure 500 {object} problem.Problem "Could not send verification email"
+// @Router /email/verify/resend [post]
+func ResendVerification(ctx *gin.Context) {
+	user := new(User)
+	err := database.BunDB.NewSelect().
+		Model(user).
+		Where("id = ?", auth.CurrentClaims(ctx).UserID).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.Email == nil {
+		problem.Abort(ctx, http.StatusBadRequest, "No email address to verify")
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		problem.Abort(ctx, http.StatusConflict, "Email address already verified")
+		return
+	}
+
+	var recent []EmailVerificationToken
+	err = database.BunDB.NewSelect().
+		Model(&recent).
+		Where("user_id = ?", user.ID).
+		Where("created_at > ?", time.Now().Add(-24*time.Hour)).
+		Order("created_at DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not send verification email")
+		return
+	}
+	if len(recent) >= dailyVerificationLimit {
+		problem.Abort(ctx, http.StatusTooManyRequests, "Too many verification emails, try again tomorrow")
+		return
+	}
+	if len(recent) > 0 {
+		if wait := time.Until(recent[0].CreatedAt.Add(resendCooldown())); wait > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			problem.Abort(ctx, http.StatusTooManyRequests, "Please wait before requesting another email")
+			return
+		}
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := audit.Record(c, tx, audit.New(ctx, "user.verification_send", "user", user.ID)); err != nil {
+			return err
+		}
+		return sendVerification(c, tx, user)
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not send verification email")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Verification email sent"})
+}
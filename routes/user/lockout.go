@@ -0,0 +1,321 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// failureWindow is how long failed attempts are remembered without a new
+	// one, counted from the end of the last lockout if that is later.
+	failureWindow = 15 * time.Minute
+	// maxLockout caps the exponential backoff.
+	maxLockout = time.Hour
+)
+
+// LoginThrottle counts the recent failed logins of one account or IP address.
+type LoginThrottle struct {
+	Key           string     `bun:"key,pk"`
+	Failures      int        `bun:"failures,notnull,default:0"`
+	LastFailureAt time.Time  `bun:"last_failure_at,notnull"`
+	LockedUntil   *time.Time `bun:"locked_until"`
+}
+
+// fail counts a failure at now and reports whether it locks the key, for base
+// after threshold failures in a row and twice as long with every further one.
+func (t *LoginThrottle) fail(now time.Time, threshold int, base time.Duration) bool {
+	// Lockouts grow past the window, so it runs from when the last one
+	// ended. Otherwise the backoff would start over before reaching its cap.
+	since := t.LastFailureAt
+	if t.LockedUntil != nil && t.LockedUntil.After(since) {
+		since = *t.LockedUntil
+	}
+	if now.Sub(since) > failureWindow {
+		t.Failures = 0
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	if t.Failures < threshold {
+		return false
+	}
+
+	lockout := maxLockout
+	if doublings := t.Failures - threshold; doublings < 16 {
+		lockout = min(base<<doublings, maxLockout)
+	}
+	until := now.Add(lockout)
+	t.LockedUntil = &until
+	return true
+}
+
+// TrustedProxies reads the comma-separated proxies in TRUSTED_PROXIES.
+// ClientIP, used for login throttling and the audit log, only believes
+// X-Forwarded-For when the request comes from one of them.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// abortLocked ends a login attempt made while the account or IP address is
+// locked, telling the client when to try again in Retry-After.
+func abortLocked(ctx *gin.Context, until time.Time) {
+	ctx.Header("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+	problem.AbortWithCode(ctx, http.StatusTooManyRequests, problem.CodeAccountLocked, "Too many failed login attempts")
+}
+
+func accountKey(username string) string {
+	return "account:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// accountThreshold is how many failures in a row lock an account,
+// configured with LOGIN_MAX_ATTEMPTS.
+func accountThreshold() int {
+	return envInt("LOGIN_MAX_ATTEMPTS", 5)
+}
+
+// ipThreshold is how many failures in a row lock a client IP address,
+// configured with LOGIN_IP_MAX_ATTEMPTS.
+func ipThreshold() int {
+	return envInt("LOGIN_IP_MAX_ATTEMPTS", 20)
+}
+
+// baseLockout is the first lockout, doubled with every further failure,
+// configured with LOGIN_LOCKOUT_SECONDS.
+func baseLockout() time.Duration {
+	return time.Duration(envInt("LOGIN_LOCKOUT_SECONDS", 30)) * time.Second
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummy spends as long as a real password check, so a missing
+// username takes the same time as a wrong password.
+func compareDummy(password string) {
+	dummyHashOnce.Do(func() {
+		hash, err := auth.HashPassword("not a real password")
+		if err == nil {
+			dummyHash = []byte(hash)
+		}
+	})
+	_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// lockedUntil returns when the latest lockout of any of keys ends, or nil.
+func lockedUntil(ctx context.Context, db bun.IDB, keys ...string) (*time.Time, error) {
+	var throttles []LoginThrottle
+	err := db.NewSelect().
+		Model(&throttles).
+		Where("key IN (?)", bun.In(keys)).
+		Where("locked_until > ?", time.Now()).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	for _, throttle := range throttles {
+		if until == nil || throttle.LockedUntil.After(*until) {
+			until = throttle.LockedUntil
+		}
+	}
+	return until, nil
+}
+
+// recordFailure counts a failed login for key and locks it once threshold
+// failures happened in a row, for twice as long with every further failure.
+// Every lockout is recorded as locked, unless that is nil.
+func recordFailure(ctx context.Context, db *bun.DB, key string, threshold int, locked *audit.Entry) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		now := time.Now()
+		_, err := tx.NewInsert().
+			Model(&LoginThrottle{Key: key, LastFailureAt: now}).
+			On("CONFLICT (key) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		throttle := new(LoginThrottle)
+		err = tx.NewSelect().Model(throttle).Where("key = ?", key).For("UPDATE").Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		lockedNow := throttle.fail(now, threshold, baseLockout())
+		if _, err := tx.NewUpdate().Model(throttle).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		if !lockedNow || locked == nil {
+			return nil
+		}
+		return audit.Record(ctx, tx, locked.Diff(nil, map[string]any{"failures": throttle.Failures, "locked_until": throttle.LockedUntil}))
+	})
+}
+
+// loginFailed records a failed login for the account and the client IP. It
+// isn't cancelled with the request, so hanging up can't skip the count.
+// userID is 0 when no account has the username; its lockouts aren't audited,
+// since there is no user to attribute them to.
+func loginFailed(ctx *gin.Context, username string, userID int64) {
+	c := context.WithoutCancel(ctx.Request.Context())
+	var accountLocked *audit.Entry
+	if userID != 0 {
+		entry := audit.New(ctx, "login_lockout.lock", "user", userID)
+		accountLocked = &entry
+	}
+	if err := recordFailure(c, database.BunDB, accountKey(username), accountThreshold(), accountLocked); err != nil {
+		fmt.Printf("Recording failed login for %q failed: %v\n", username, err)
+	}
+	ipLocked := audit.New(ctx, "login_lockout.lock", "ip", ctx.ClientIP())
+	if err := recordFailure(c, database.BunDB, ipKey(ctx.ClientIP()), ipThreshold(), &ipLocked); err != nil {
+		fmt.Printf("Recording failed login from %s failed: %v\n", ctx.ClientIP(), err)
+	}
+}
+
+// loginSucceeded forgets the user's failed attempts, recording it if there
+// were any.
+func loginSucceeded(ctx *gin.Context, user *User) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*LoginThrottle)(nil)).
+			Where("key = ?", accountKey(user.Username)).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return nil
+		}
+		return audit.Record(c, tx, audit.New(ctx, "login_lockout.clear", "user", user.ID).By(user.ID))
+	})
+	if err != nil {
+		fmt.Printf("Clearing failed logins of user %d failed: %v\n", user.ID, err)
+	}
+}
+
+// @Summary Unlock a user account
+// @Description Clear the failed login attempts and lockout of a user account
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "Account unlocked"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Failed to unlock account"
+// @Router /users/{id}/unlock [post]
+func UnlockUser(ctx *gin.Context) {
+	var username string
+	err := database.BunDB.NewSelect().
+		Model((*User)(nil)).
+		Column("username").
+		Where("id = ?", ctx.Param("id")).
+		Scan(ctx.Request.Context(), &username)
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to unlock account")
+		return
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().
+			Model((*LoginThrottle)(nil)).
+			Where("key = ?", accountKey(username)).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.unlock", "user", ctx.Param("id")))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to unlock account")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Account unlocked"})
+}
+
+// @Summary Unlock an IP address
+// @Description Clear the failed login attempts and lockout of a client IP address
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param ip path string true "IP address"
+// @Success 200 {object} SuccessResponse "IP address unlocked"
+// @Failure 404 {object} problem.Problem "IP address is not locked"
+// @Failure 500 {object} problem.Problem "Failed to unlock IP address"
+// @Router /login-lockouts/ip/{ip} [delete]
+func UnlockIP(ctx *gin.Context) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*LoginThrottle)(nil)).
+			Where("key = ?", ipKey(ctx.Param("ip"))).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "login_lockout.clear", "ip", ctx.Param("ip")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "IP address is not locked")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to unlock IP address")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "IP address unlocked"})
+}
+
+// PurgeLoginThrottles forgets failed attempts that no longer count. It is run
+// periodically by the scheduler.
+func PurgeLoginThrottles(ctx context.Context) error {
+	now := time.Now()
+	_, err := database.BunDB.NewDelete().
+		Model((*LoginThrottle)(nil)).
+		Where("last_failure_at < ?", now.Add(-failureWindow)).
+		Where("locked_until IS NULL OR locked_until < ?", now.Add(-failureWindow)).
+		Exec(ctx)
+	return err
+}
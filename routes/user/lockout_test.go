@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/database"
+)
+
+var start = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle := &LoginThrottle{Key: accountKey("ada")}
+
+	// Failures a second apart with a threshold of 3 and a first lockout of
+	// 30 seconds, doubling up to an hour.
+	want := []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute,
+		8 * time.Minute, 16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour}
+	for i, lockout := range want {
+		now := start.Add(time.Duration(i) * time.Second)
+		locked := throttle.fail(now, 3, 30*time.Second)
+
+		if throttle.Failures != i+1 {
+			t.Fatalf("failure %d counted as %d", i+1, throttle.Failures)
+		}
+		if locked != (lockout > 0) {
+			t.Errorf("failure %d locked = %v, want %v", i+1, locked, lockout > 0)
+		}
+		if lockout > 0 && (throttle.LockedUntil == nil || !throttle.LockedUntil.Equal(now.Add(lockout))) {
+			t.Errorf("failure %d locked until %v, want %v", i+1, throttle.LockedUntil, now.Add(lockout))
+		}
+	}
+}
+
+func TestThrottleBackoffDoesNotOverflow(t *testing.T) {
+	throttle := &LoginThrottle{Failures: 80, LastFailureAt: start}
+	throttle.fail(start.Add(time.Second), 1, 30*time.Second)
+
+	if want := start.Add(time.Second + maxLockout); !throttle.LockedUntil.Equal(want) {
+		t.Errorf("locked until %v, want %v", throttle.LockedUntil, want)
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	lockedUntil := func(d time.Duration) *time.Time {
+		until := start.Add(d)
+		return &until
+	}
+
+	tests := []struct {
+		name     string
+		throttle LoginThrottle
+		after    time.Duration
+		failures int
+	}{
+		{"within the window", LoginThrottle{Failures: 2, LastFailureAt: start}, failureWindow, 3},
+		{"after the window", LoginThrottle{Failures: 2, LastFailureAt: start}, failureWindow + time.Second, 1},
+		{"window runs from the end of a lockout", LoginThrottle{Failures: 5, LastFailureAt: start, LockedUntil: lockedUntil(30 * time.Minute)}, 30*time.Minute + failureWindow, 6},
+		{"after the window past a lockout", LoginThrottle{Failures: 5, LastFailureAt: start, LockedUntil: lockedUntil(30 * time.Minute)}, 30*time.Minute + failureWindow + time.Second, 1},
+		{"an old lockout doesn't extend the window", LoginThrottle{Failures: 5, LastFailureAt: start, LockedUntil: lockedUntil(-time.Hour)}, failureWindow + time.Second, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			throttle := test.throttle
+			throttle.fail(start.Add(test.after), 100, 30*time.Second)
+			if throttle.Failures != test.failures {
+				t.Errorf("failures = %d, want %d", throttle.Failures, test.failures)
+			}
+		})
+	}
+
+	// Spread-out failures add up as long as each comes within the window.
+	throttle := &LoginThrottle{}
+	for i := 0; i < 5; i++ {
+		if throttle.fail(start.Add(time.Duration(i)*14*time.Minute), 5, 30*time.Second) != (i == 4) {
+			t.Errorf("failure %d, 14 minutes after the last, locked = %v", i+1, !(i == 4))
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1 , ,192.168.0.0/16,")
+	if got := fmt.Sprint(TrustedProxies()); got != "[10.0.0.1 192.168.0.0/16]" {
+		t.Fatalf("TrustedProxies() = %s", got)
+	}
+
+	tests := []struct {
+		name         string
+		trusted      string
+		remote       string
+		forwardedFor string
+		want         string
+	}{
+		{"direct client", "10.0.0.1", "203.0.113.7:5000", "", "ip:203.0.113.7"},
+		{"forwarded by an untrusted client", "10.0.0.1", "203.0.113.7:5000", "198.51.100.1", "ip:203.0.113.7"},
+		{"forwarded by a trusted proxy", "10.0.0.1", "10.0.0.1:5000", "198.51.100.1", "ip:198.51.100.1"},
+		{"spoofed entries before the proxy's are ignored", "10.0.0.1", "10.0.0.1:5000", "6.6.6.6, 198.51.100.1", "ip:198.51.100.1"},
+		{"a chain of trusted proxies", "10.0.0.1,192.168.0.0/16", "192.168.4.2:5000", "198.51.100.1, 10.0.0.1", "ip:198.51.100.1"},
+		{"invalid header from a trusted proxy", "10.0.0.1", "10.0.0.1:5000", "not an address", "ip:10.0.0.1"},
+		{"no trusted proxies", "", "10.0.0.1:5000", "198.51.100.1", "ip:10.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", test.trusted)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if err := router.SetTrustedProxies(TrustedProxies()); err != nil {
+				t.Fatal(err)
+			}
+			router.GET("/", func(ctx *gin.Context) { ctx.String(http.StatusOK, ipKey(ctx.ClientIP())) })
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = test.remote
+			if test.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if got := response.Body.String(); got != test.want {
+				t.Errorf("key = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAccountKeyIgnoresCase(t *testing.T) {
+	if accountKey("Ada") != accountKey("ada") {
+		t.Error("usernames differing in case have separate throttles")
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	t.Setenv("LOGIN_LOCKOUT_SECONDS", "30")
+
+	key := "test:" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	lockEntry := audit.System("login_lockout.lock", "test", key)
+	for i := 1; i <= 3; i++ {
+		if err := recordFailure(ctx, database.BunDB, key, 2, &lockEntry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	throttle := new(LoginThrottle)
+	if err := database.BunDB.NewSelect().Model(throttle).Where("key = ?", key).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != 3 || throttle.LockedUntil == nil {
+		t.Fatalf("throttle = %+v, want 3 failures and a lockout", throttle)
+	}
+	until, err := lockedUntil(ctx, database.BunDB, key, "test:other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until == nil || until.Sub(throttle.LastFailureAt) != time.Minute {
+		t.Errorf("locked until %v, want a minute after the last failure %v", until, throttle.LastFailureAt)
+	}
+
+	locks, err := database.BunDB.NewSelect().
+		Model((*audit.Entry)(nil)).
+		Where("action = ?", "login_lockout.lock").
+		Where("target_id = ?", key).
+		Count(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks != 2 {
+		t.Errorf("%d lockouts audited, want 2", locks)
+	}
+}
@@ -0,0 +1,480 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/notification"
+	"github.com/in43sh/homebuzz-backend/problem"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	cartRoutes "github.com/in43sh/homebuzz-backend/routes/cart"
+	orderRoutes "github.com/in43sh/homebuzz-backend/routes/order"
+	subscriptionRoutes "github.com/in43sh/homebuzz-backend/routes/subscription"
+	"github.com/in43sh/homebuzz-backend/wishlist"
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PasswordChangedResponse struct {
+	Message string `json:"message" example:"Password changed"`
+	// Token replaces the caller's token, which was signed out with every
+	// other session.
+	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+}
+
+type AccountDeletionResponse struct {
+	Message             string    `json:"message" example:"Account scheduled for deletion"`
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// accountDeletionGrace is how long a user can change their mind after asking
+// to delete their account, configured with ACCOUNT_DELETION_DAYS.
+func accountDeletionGrace() time.Duration {
+	return time.Duration(envInt("ACCOUNT_DELETION_DAYS", 30)) * 24 * time.Hour
+}
+
+// currentUser loads the authenticated user, aborting the request if that
+// fails.
+func currentUser(ctx *gin.Context) (*User, bool) {
+	user := new(User)
+	err := database.BunDB.NewSelect().
+		Model(user).
+		Where("id = ?", auth.CurrentClaims(ctx).UserID).
+		Scan(ctx.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch user")
+		return nil, false
+	}
+	return user, true
+}
+
+// confirmPassword checks the user's password before a sensitive change,
+// aborting the request if it is wrong. Failures count towards the account
+// lockout, so a stolen session can't be used to guess the password. Accounts
+// without a password, which only sign in with a social provider, pass.
+func confirmPassword(ctx *gin.Context, user *User, password string) bool {
+	if user.Password == "" {
+		return true
+	}
+
+	until, err := lockedUntil(ctx.Request.Context(), database.BunDB, accountKey(user.Username))
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to check login attempts")
+		return false
+	}
+	if until != nil {
+		abortLocked(ctx, *until)
+		return false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		loginFailed(ctx, user.Username, user.ID)
+		problem.Abort(ctx, http.StatusUnauthorized, "Incorrect password")
+		return false
+	}
+	return true
+}
+
+// trimmedOrNil trims value and turns an empty result into nil.
+func trimmedOrNil(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// @Summary Get my profile
+// @Description Retrieve the current user's account and profile
+// @Tags Profile
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]UserResponse
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Couldn't fetch user"
+// @Router /me [get]
+func GetMe(ctx *gin.Context) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
+}
+
+// @Summary Update my profile
+// @Description Change the current user's username, email address, display name, phone number or avatar. Only the fields sent are changed. A new email address has to be verified again; the old one is told about the change.
+// @Tags Profile
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param profile body UpdateProfileRequest true "Profile changes"
+// @Success 200 {object} map[string]UserResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 409 {object} problem.Problem "Username or email address already in use"
+// @Failure 500 {object} problem.Problem "Failed to update profile"
+// @Router /me [patch]
+func UpdateMe(ctx *gin.Context) {
+	var request UpdateProfileRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	user, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	previous := *user
+
+	if request.Username != nil {
+		username := strings.TrimSpace(*request.Username)
+		if username == "" {
+			problem.Abort(ctx, http.StatusBadRequest, "Username can't be empty")
+			return
+		}
+		if username != user.Username {
+			taken, err := database.BunDB.NewSelect().
+				Model((*User)(nil)).
+				Where("username = ?", username).
+				WhereAllWithDeleted().
+				Exists(ctx.Request.Context())
+			if err != nil {
+				problem.Abort(ctx, http.StatusInternalServerError, "Failed to update profile")
+				return
+			}
+			if taken {
+				problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Username already taken")
+				return
+			}
+			user.Username = username
+		}
+	}
+
+	emailChanged := false
+	if request.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*request.Email))
+		if user.Email == nil || email != *user.Email {
+			taken, err := database.BunDB.NewSelect().
+				Model((*User)(nil)).
+				Where("email = ?", email).
+				WhereAllWithDeleted().
+				Exists(ctx.Request.Context())
+			if err != nil {
+				problem.Abort(ctx, http.StatusInternalServerError, "Failed to update profile")
+				return
+			}
+			if taken {
+				problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "Email address already in use")
+				return
+			}
+			user.Email = &email
+			user.EmailVerifiedAt = nil
+			emailChanged = true
+		}
+	}
+
+	if request.DisplayName != nil {
+		user.DisplayName = trimmedOrNil(*request.DisplayName)
+	}
+	if request.Phone != nil {
+		user.Phone = trimmedOrNil(*request.Phone)
+	}
+	if request.AvatarURL != nil {
+		user.AvatarURL = trimmedOrNil(*request.AvatarURL)
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model(user).
+			Column("username", "email", "email_verified_at", "display_name", "phone", "avatar_url").
+			WherePK().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "user.update", "user", user.ID).Diff(NewUserResponse(&previous), NewUserResponse(user)).Redact(personalFields...)
+		return audit.Record(c, tx, entry)
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to update profile")
+		return
+	}
+
+	if emailChanged {
+		if err := sendVerification(ctx.Request.Context(), database.BunDB, user); err != nil {
+			fmt.Printf("Verification email for user %d failed: %v\n", user.ID, err)
+		}
+		sendNotice(ctx.Request.Context(), &previous, "email_changed", map[string]any{"Email": *user.Email})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": NewUserResponse(user)})
+}
+
+// @Summary Change my password
+// @Description Change the current user's password. The current password is required, except for accounts that only sign in with a social provider and have none yet. Every session is signed out and a new token is returned for this one.
+// @Tags Profile
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} PasswordChangedResponse
+// @Failure 400 {object} problem.Problem "Invalid input or password too weak"
+// @Failure 401 {object} problem.Problem "Incorrect password"
+// @Failure 429 {object} problem.Problem "Too many failed login attempts"
+// @Failure 500 {object} problem.Problem "Could not change password"
+// @Router /me/password [post]
+func ChangePassword(ctx *gin.Context) {
+	var request ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	user, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	if !confirmPassword(ctx, user, request.CurrentPassword) {
+		return
+	}
+	if !validatePassword(ctx, "new_password", request.NewPassword, user.Username) {
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := setPassword(c, tx, user.ID, request.NewPassword); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.password_change", "user", user.ID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not change password")
+		return
+	}
+	user.SessionVersion++
+	sendNotice(ctx.Request.Context(), user, "password_changed", nil)
+
+	token, err := newAccessToken(user)
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, PasswordChangedResponse{Message: "Password changed", Token: token})
+}
+
+// @Summary Delete my account
+// @Description Schedule the current user's account for deletion after ACCOUNT_DELETION_DAYS (30 by default) and sign it out everywhere. Signing in again before then cancels the deletion. Accounts with a password have to confirm it.
+// @Tags Profile
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body DeleteAccountRequest true "Password confirmation"
+// @Success 202 {object} AccountDeletionResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 401 {object} problem.Problem "Incorrect password"
+// @Failure 409 {object} problem.Problem "Account deletion already scheduled"
+// @Failure 429 {object} problem.Problem "Too many failed login attempts"
+// @Failure 500 {object} problem.Problem "Could not schedule account deletion"
+// @Router /me [delete]
+func DeleteMe(ctx *gin.Context) {
+	// Accounts without a password may send no body at all.
+	var request DeleteAccountRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	user, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	if user.DeletionScheduledAt != nil {
+		problem.Abort(ctx, http.StatusConflict, "Account deletion already scheduled")
+		return
+	}
+	if !confirmPassword(ctx, user, request.Password) {
+		return
+	}
+
+	deleteAt := time.Now().Add(accountDeletionGrace())
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("deletion_scheduled_at = ?", deleteAt).
+			Set("session_version = session_version + 1").
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "user.deletion_schedule", "user", user.ID).
+			Diff(gin.H{"deletion_scheduled_at": nil}, gin.H{"deletion_scheduled_at": deleteAt})
+		return audit.Record(c, tx, entry)
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not schedule account deletion")
+		return
+	}
+	sendNotice(ctx.Request.Context(), user, "account_deletion", map[string]any{"DeleteAt": deleteAt.Format("January 2, 2006")})
+
+	ctx.JSON(http.StatusAccepted, AccountDeletionResponse{Message: "Account scheduled for deletion", DeletionScheduledAt: deleteAt})
+}
+
+// deletedRetention is how long a deleted account can still be restored,
+// configured with DELETED_RETENTION_DAYS.
+func deletedRetention() time.Duration {
+	return time.Duration(envInt("DELETED_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
+
+// closeAccount deletes a soft deleted user for good. Accounts with orders or
+// other records the shop has to keep are stripped of their personal data and
+// everything else tied to them instead, and it reports true. Their orders
+// only keep the country and region they were shipped to, for tax.
+func closeAccount(ctx context.Context, tx bun.Tx, userID int64) (bool, error) {
+	hasOrders, err := tx.NewSelect().Table("orders").Where("user_id = ?", userID).Exists(ctx)
+	if err != nil {
+		return false, err
+	}
+	hasPrices, err := tx.NewSelect().Table("scheduled_prices").Where("created_by = ?", userID).Exists(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !hasOrders && !hasPrices {
+		_, err = tx.NewDelete().Model((*User)(nil)).Where("id = ?", userID).WhereDeleted().ForceDelete().Exec(ctx)
+		return false, err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*User)(nil)).
+		Set("username = ?", "deleted-"+strconv.FormatInt(userID, 10)).
+		Set("password = ''").
+		Set("email = NULL").
+		Set("email_verified_at = NULL").
+		Set("display_name = NULL").
+		Set("phone = NULL").
+		Set("avatar_url = NULL").
+		Set("signup_ip = NULL").
+		Set("signup_user_agent = NULL").
+		Set("last_login_ip = NULL").
+		Set("totp_secret = NULL").
+		Set("totp_enabled_at = NULL").
+		Set("deletion_scheduled_at = NULL").
+		Set("anonymized_at = ?", time.Now()).
+		Where("id = ?", userID).
+		WhereDeleted().
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.NewUpdate().
+		Model((*orderRoutes.Order)(nil)).
+		Set("shipping_address = jsonb_strip_nulls(jsonb_build_object('country', shipping_address->'country', 'region', shipping_address->'region'))").
+		Where("user_id = ?", userID).
+		Where("shipping_address IS NOT NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	owned := []any{
+		(*UserIdentity)(nil), (*APIKey)(nil), (*RecoveryCode)(nil), (*PasswordResetToken)(nil),
+		(*EmailVerificationToken)(nil), (*OIDCLogin)(nil), (*OAuthConsent)(nil), (*OAuthCode)(nil),
+		(*OAuthToken)(nil), (*addressRoutes.Address)(nil), (*cartRoutes.CartItem)(nil),
+		(*subscriptionRoutes.Subscription)(nil), (*wishlist.List)(nil), (*notification.Notification)(nil),
+	}
+	for _, model := range owned {
+		if _, err := tx.NewDelete().Model(model).Where("user_id = ?", userID).Exec(ctx); err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.NewDelete().Model((*OAuthClient)(nil)).Where("owner_id = ?", userID).Exec(ctx)
+	return true, err
+}
+
+// PurgeDeletedAccounts deletes the accounts whose deletion grace period is
+// over, and closes the ones deleted more than DELETED_RETENTION_DAYS ago. It
+// runs on a schedule.
+func PurgeDeletedAccounts(ctx context.Context) error {
+	now := time.Now()
+	err := database.BunDB.RunInTx(ctx, nil, func(c context.Context, tx bun.Tx) error {
+		var deletedIDs []int64
+		err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("deleted_at = ?", now).
+			Set("deletion_scheduled_at = NULL").
+			Where("deletion_scheduled_at <= ?", now).
+			Returning("id").
+			Scan(c, &deletedIDs)
+		if err != nil {
+			return err
+		}
+		for _, userID := range deletedIDs {
+			if err := audit.Record(c, tx, audit.System("user.delete", "user", userID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var userIDs []int64
+	err = database.BunDB.NewSelect().
+		Model((*User)(nil)).
+		Column("id").
+		WhereDeleted().
+		Where("deleted_at < ?", now.Add(-deletedRetention())).
+		Where("anonymized_at IS NULL").
+		Scan(ctx, &userIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		err := database.BunDB.RunInTx(ctx, nil, func(c context.Context, tx bun.Tx) error {
+			// An admin may have restored the account since.
+			user := new(User)
+			err := tx.NewSelect().Model(user).Where("id = ?", userID).WhereAllWithDeleted().For("UPDATE").Scan(c)
+			if err != nil {
+				return err
+			}
+			if user.DeletedAt.IsZero() || user.AnonymizedAt != nil {
+				return nil
+			}
+			kept, err := closeAccount(c, tx, userID)
+			if err != nil {
+				return err
+			}
+
+			action := "user.purge"
+			if kept {
+				action = "user.anonymize"
+			}
+			return audit.Record(c, tx, audit.System(action, "user", userID))
+		})
+		if err != nil {
+			fmt.Printf("Closing account of user %d failed: %v\n", userID, err)
+		}
+	}
+	return nil
+}
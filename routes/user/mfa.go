@@ -0,0 +1,430 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+const (
+	// mfaChallengeTTL is how long the second login step may take.
+	mfaChallengeTTL = 5 * time.Minute
+	mfaIssuer       = "HomeBuzz"
+	recoveryCodes   = 10
+)
+
+var (
+	errInvalidMFACode = errors.New("invalid two-factor code")
+	errMFAEnabled     = errors.New("two-factor authentication is already enabled")
+)
+
+// RecoveryCode is a single-use code that replaces an authenticator code, e.g.
+// when the phone is lost. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID       int64      `bun:",pk,autoincrement"`
+	UserID   int64      `bun:"user_id,notnull"`
+	CodeHash string     `bun:"code_hash,notnull"`
+	UsedAt   *time.Time `bun:"used_at"`
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	ProvisioningURI string `json:"provisioning_uri" example:"otpauth://totp/HomeBuzz:johndoe?algorithm=SHA1&digits=6&issuer=HomeBuzz&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"k7qd-m2xa,9fvt-pw3c"`
+}
+
+type MFALoginRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	Code         string `json:"code" example:"123456"`
+	RecoveryCode string `json:"recovery_code" example:"k7qd-m2xa"`
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones in plain text, the only time they are shown.
+func newRecoveryCodes(ctx context.Context, tx bun.Tx, userID int64) ([]string, error) {
+	_, err := tx.NewDelete().
+		Model((*RecoveryCode)(nil)).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, 0, recoveryCodes)
+	rows := make([]RecoveryCode, 0, recoveryCodes)
+	for i := 0; i < recoveryCodes; i++ {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		for j := range buf {
+			buf[j] = alphabet[int(buf[j])%len(alphabet)]
+		}
+		code := string(buf[:4]) + "-" + string(buf[4:])
+		codes = append(codes, code)
+		rows = append(rows, RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+	}
+
+	_, err = tx.NewInsert().Model(&rows).Exec(ctx)
+	return codes, err
+}
+
+// useRecoveryCode redeems one of the user's unused recovery codes.
+func useRecoveryCode(ctx context.Context, tx bun.Tx, userID int64, code string) error {
+	code = strings.ToLower(strings.TrimSpace(code))
+	result, err := tx.NewUpdate().
+		Model((*RecoveryCode)(nil)).
+		Set("used_at = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Where("code_hash = ?", hashToken(code)).
+		Where("used_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// checkTOTP verifies an authenticator code of a locked user row and records
+// its time step so it can't be used twice.
+func checkTOTP(ctx context.Context, tx bun.Tx, user *User, code string) error {
+	if user.TOTPSecret == nil {
+		return errInvalidMFACode
+	}
+	step, ok := auth.ValidateTOTP(*user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	user.TOTPLastStep = step
+	_, err := tx.NewUpdate().Model(user).Column("totp_last_step").WherePK().Exec(ctx)
+	return err
+}
+
+// mfaChallenge responds with a challenge token for the second login step.
+func mfaChallenge(ctx *gin.Context, user *User) {
+	mfaToken, err := auth.GenerateMFAToken(user.ID, user.Username, time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":      "Two-factor authentication required",
+		"mfa_required": true,
+		"mfa_token":    mfaToken,
+	})
+}
+
+// lockUser loads the current user for update.
+func lockUser(ctx context.Context, tx bun.Tx, userID int64) (*User, error) {
+	user := new(User)
+	err := tx.NewSelect().Model(user).Where("id = ?", userID).For("UPDATE").Scan(ctx)
+	return user, err
+}
+
+// @Summary Start two-factor enrolment
+// @Description Generate a new TOTP secret for the current user. Show the provisioning URI as a QR code for an authenticator app, then confirm with a code at /mfa/totp/confirm.
+// @Tags Auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} TOTPEnrollment
+// @Failure 409 {object} problem.Problem "Two-factor authentication is already enabled"
+// @Failure 500 {object} problem.Problem "Could not start enrolment"
+// @Router /mfa/totp/enroll [post]
+func EnrollTOTP(ctx *gin.Context) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	claims := auth.CurrentClaims(ctx)
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("totp_secret = ?", secret).
+			Set("totp_last_step = 0").
+			Where("id = ?", claims.UserID).
+			Where("totp_enabled_at IS NULL").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.mfa_enroll", "user", claims.UserID))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not start enrolment")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(mfaIssuer, claims.Username, secret),
+	})
+}
+
+// @Summary Confirm two-factor enrolment
+// @Description Turn on two-factor authentication with a code from the authenticator app. Returns single-use recovery codes, which are not shown again.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Authenticator code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} problem.Problem "Invalid two-factor code"
+// @Failure 409 {object} problem.Problem "Two-factor authentication is already enabled"
+// @Failure 500 {object} problem.Problem "Could not enable two-factor authentication"
+// @Router /mfa/totp/confirm [post]
+func ConfirmTOTP(ctx *gin.Context) {
+	var request MFACodeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	var codes []string
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user, err := lockUser(c, tx, auth.CurrentClaims(ctx).UserID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt != nil {
+			return errMFAEnabled
+		}
+		if err := checkTOTP(c, tx, user, request.Code); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("totp_enabled_at = ?", time.Now()).
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		codes, err = newRecoveryCodes(c, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.mfa_enable", "user", user.ID))
+	})
+	if errors.Is(err, errMFAEnabled) {
+		problem.Abort(ctx, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if errors.Is(err, errInvalidMFACode) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not enable two-factor authentication")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Turn off two-factor authentication
+// @Description Turn off two-factor authentication for the current user after checking a current authenticator code
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Authenticator code"
+// @Success 200 {object} SuccessResponse "Two-factor authentication disabled"
+// @Failure 400 {object} problem.Problem "Invalid two-factor code"
+// @Failure 500 {object} problem.Problem "Could not disable two-factor authentication"
+// @Router /mfa/totp [delete]
+func DisableTOTP(ctx *gin.Context) {
+	var request MFACodeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user, err := lockUser(c, tx, auth.CurrentClaims(ctx).UserID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		if err := checkTOTP(c, tx, user, request.Code); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("totp_secret = NULL").
+			Set("totp_enabled_at = NULL").
+			Set("totp_last_step = 0").
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*RecoveryCode)(nil)).
+			Where("user_id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.mfa_disable", "user", user.ID))
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not disable two-factor authentication")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Two-factor authentication disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace the current user's recovery codes after checking a current authenticator code. Old codes stop working.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body MFACodeRequest true "Authenticator code"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} problem.Problem "Invalid two-factor code"
+// @Failure 500 {object} problem.Problem "Could not create recovery codes"
+// @Router /mfa/recovery-codes [post]
+func RegenerateRecoveryCodes(ctx *gin.Context) {
+	var request MFACodeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	var codes []string
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user, err := lockUser(c, tx, auth.CurrentClaims(ctx).UserID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		if err := checkTOTP(c, tx, user, request.Code); err != nil {
+			return err
+		}
+
+		codes, err = newRecoveryCodes(c, tx, user.ID)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.mfa_recovery_codes", "user", user.ID))
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create recovery codes")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token from /login and an authenticator code, or a recovery code, for an access token
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body MFALoginRequest true "Challenge token and code"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 401 {object} problem.Problem "Invalid or expired challenge, or invalid code"
+// @Failure 429 {object} problem.Problem "Too many failed login attempts"
+// @Failure 500 {object} problem.Problem "Failed to log in"
+// @Router /login/mfa [post]
+func LoginMFA(ctx *gin.Context) {
+	var request MFALoginRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil || (request.Code == "") == (request.RecoveryCode == "") {
+		problem.Abort(ctx, http.StatusBadRequest, "Provide the mfa_token and either a code or a recovery_code")
+		return
+	}
+
+	claims, err := auth.ParseMFAToken(request.MFAToken)
+	if err != nil {
+		problem.Abort(ctx, http.StatusUnauthorized, "Invalid or expired challenge, log in again")
+		return
+	}
+
+	until, err := lockedUntil(ctx.Request.Context(), database.BunDB, accountKey(claims.Username), ipKey(ctx.ClientIP()))
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to check login attempts")
+		return
+	}
+	if until != nil {
+		abortLocked(ctx, *until)
+		return
+	}
+
+	var user *User
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user, err = lockUser(c, tx, claims.UserID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return errInvalidMFACode
+		}
+		if request.RecoveryCode != "" {
+			return useRecoveryCode(c, tx, user.ID, request.RecoveryCode)
+		}
+		return checkTOTP(c, tx, user, request.Code)
+	})
+	if errors.Is(err, errInvalidMFACode) || errors.Is(err, sql.ErrNoRows) {
+		loginFailed(ctx, claims.Username, claims.UserID)
+		problem.Abort(ctx, http.StatusUnauthorized, "Invalid two-factor code")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	loginSucceeded(ctx, user)
+	issueToken(ctx, user)
+}
@@ -0,0 +1,616 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// authorizationCodeTTL is how long a client has to redeem a code.
+const authorizationCodeTTL = 10 * time.Minute
+
+// OAuthCode is an authorization code waiting to be exchanged for an access
+// token. Only its SHA-256 hash is stored.
+type OAuthCode struct {
+	bun.BaseModel `bun:"table:oauth_codes,alias:code"`
+
+	ID            int64      `bun:",pk,autoincrement"`
+	CodeHash      string     `bun:"code_hash,unique,notnull"`
+	ClientID      string     `bun:"client_id,notnull"`
+	UserID        int64      `bun:"user_id,notnull"`
+	RedirectURI   string     `bun:"redirect_uri,notnull"`
+	Scope         string     `bun:"scope,notnull"`
+	CodeChallenge string     `bun:"code_challenge,notnull"`
+	ExpiresAt     time.Time  `bun:"expires_at,notnull"`
+	UsedAt        *time.Time `bun:"used_at"`
+}
+
+// OAuthToken records an access token issued to a client so it can be
+// introspected and revoked.
+type OAuthToken struct {
+	bun.BaseModel `bun:"table:oauth_tokens,alias:token"`
+
+	ID        string     `bun:",pk"`
+	ClientID  string     `bun:"client_id,notnull"`
+	UserID    int64      `bun:"user_id,notnull"`
+	Scope     string     `bun:"scope,notnull"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull"`
+	RevokedAt *time.Time `bun:"revoked_at"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+// OAuthError is an error response of the token, introspection and
+// revocation endpoints, in the format of RFC 6749.
+type OAuthError struct {
+	Error            string `json:"error" example:"invalid_grant"`
+	ErrorDescription string `json:"error_description,omitempty" example:"Invalid or expired authorization code"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int    `json:"expires_in" example:"3600"`
+	Scope       string `json:"scope" example:"orders:read"`
+}
+
+type IntrospectionResponse struct {
+	Active    bool   `json:"active" example:"true"`
+	Scope     string `json:"scope,omitempty" example:"orders:read"`
+	ClientID  string `json:"client_id,omitempty" example:"hb_3q2x7..."`
+	Username  string `json:"username,omitempty" example:"johndoe"`
+	Subject   string `json:"sub,omitempty" example:"42"`
+	TokenType string `json:"token_type,omitempty" example:"Bearer"`
+	ExpiresAt int64  `json:"exp,omitempty" example:"1792400000"`
+	IssuedAt  int64  `json:"iat,omitempty" example:"1792396400"`
+}
+
+type ScopeInfo struct {
+	Name        string `json:"name" example:"orders:read"`
+	Description string `json:"description" example:"View your orders"`
+}
+
+type AuthorizationInfo struct {
+	ClientID   string      `json:"client_id" example:"hb_3q2x7..."`
+	ClientName string      `json:"client_name" example:"Acme Meal Planner"`
+	Scopes     []ScopeInfo `json:"scopes"`
+	// Consented is true when the user already approved these scopes, so the
+	// consent screen can be skipped.
+	Consented bool `json:"consented" example:"false"`
+}
+
+type AuthorizeRequest struct {
+	ResponseType        string `json:"response_type" form:"response_type" binding:"required,eq=code" example:"code"`
+	ClientID            string `json:"client_id" form:"client_id" binding:"required" example:"hb_3q2x7..."`
+	RedirectURI         string `json:"redirect_uri" form:"redirect_uri" binding:"required" example:"https://partner.example.com/callback"`
+	Scope               string `json:"scope" form:"scope" example:"orders:read"`
+	State               string `json:"state" form:"state" example:"af0ifjsldkj"`
+	CodeChallenge       string `json:"code_challenge" form:"code_challenge" binding:"required" example:"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"`
+	CodeChallengeMethod string `json:"code_challenge_method" form:"code_challenge_method" binding:"required,eq=S256" example:"S256"`
+	Approve             bool   `json:"approve" example:"true"`
+}
+
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to" example:"https://partner.example.com/callback?code=...&state=af0ifjsldkj"`
+}
+
+// accessTokenTTL is how long tokens issued to clients are valid, configured
+// with OAUTH_TOKEN_MINUTES.
+func accessTokenTTL() time.Duration {
+	return time.Duration(envInt("OAUTH_TOKEN_MINUTES", 60)) * time.Minute
+}
+
+// checkAuthorizeRequest validates the client, redirect URI and scopes of an
+// authorization request. Errors are reported to the user, never to the
+// redirect URI, which may not be trusted yet.
+func checkAuthorizeRequest(ctx context.Context, request *AuthorizeRequest) (*OAuthClient, []string, string) {
+	client := new(OAuthClient)
+	err := database.BunDB.NewSelect().
+		Model(client).
+		Where("client_id = ?", request.ClientID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, "Unknown client"
+	}
+	if !slices.Contains(client.RedirectURIs, request.RedirectURI) {
+		return nil, nil, "redirect_uri is not registered for this client"
+	}
+
+	scopes := auth.ParseScope(request.Scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !auth.ValidScopes(scopes, client.Scopes) {
+		return nil, nil, "Invalid scope for this client"
+	}
+	return client, scopes, ""
+}
+
+// redirectWith appends query parameters to a client's redirect URI.
+func redirectWith(redirectURI string, params url.Values) string {
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	return redirectURI + separator + params.Encode()
+}
+
+// @Summary Get an authorization request
+// @Description Validate a third-party app's authorization request (authorization code flow with PKCE) and describe it for the consent screen
+// @Tags OAuth
+// @Produce  json
+// @Security BearerAuth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes, all of the client's by default"
+// @Param state query string false "Opaque value returned to the client"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "Must be S256"
+// @Success 200 {object} AuthorizationInfo
+// @Failure 400 {object} problem.Problem "Invalid authorization request"
+// @Failure 500 {object} problem.Problem "Couldn't check consent"
+// @Router /oauth/authorize [get]
+func GetAuthorization(ctx *gin.Context) {
+	var request AuthorizeRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+	client, scopes, msg := checkAuthorizeRequest(ctx.Request.Context(), &request)
+	if msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+
+	consent := new(OAuthConsent)
+	err := database.BunDB.NewSelect().
+		Model(consent).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Where("client_id = ?", client.ClientID).
+		Scan(ctx.Request.Context())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't check consent")
+		return
+	}
+
+	info := AuthorizationInfo{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scopes:     make([]ScopeInfo, 0, len(scopes)),
+		Consented:  err == nil && auth.ValidScopes(scopes, consent.Scopes),
+	}
+	for _, scope := range scopes {
+		info.Scopes = append(info.Scopes, ScopeInfo{Name: scope, Description: auth.ScopeDescriptions[scope]})
+	}
+
+	ctx.JSON(http.StatusOK, info)
+}
+
+// @Summary Approve or deny an authorization request
+// @Description Record the current user's decision on a third-party app's authorization request. On approval the consent is saved and an authorization code issued. Send the user's browser to redirect_to, which returns the code or an access_denied error to the app.
+// @Tags OAuth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param request body AuthorizeRequest true "Authorization request and decision"
+// @Success 200 {object} AuthorizeResponse
+// @Failure 400 {object} problem.Problem "Invalid authorization request"
+// @Failure 500 {object} problem.Problem "Failed to authorize"
+// @Router /oauth/authorize [post]
+func Authorize(ctx *gin.Context) {
+	var request AuthorizeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid authorization request")
+		return
+	}
+	client, scopes, msg := checkAuthorizeRequest(ctx.Request.Context(), &request)
+	if msg != "" {
+		problem.Abort(ctx, http.StatusBadRequest, msg)
+		return
+	}
+
+	params := url.Values{}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	if !request.Approve {
+		params.Set("error", "access_denied")
+		ctx.JSON(http.StatusOK, AuthorizeResponse{RedirectTo: redirectWith(request.RedirectURI, params)})
+		return
+	}
+
+	code, codeHash, err := newToken()
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to authorize")
+		return
+	}
+
+	userID := auth.CurrentClaims(ctx).UserID
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := grantConsent(c, tx, userID, client.ClientID, scopes); err != nil {
+			return err
+		}
+
+		_, err := tx.NewInsert().Model(&OAuthCode{
+			CodeHash:      codeHash,
+			ClientID:      client.ClientID,
+			UserID:        userID,
+			RedirectURI:   request.RedirectURI,
+			Scope:         strings.Join(scopes, " "),
+			CodeChallenge: request.CodeChallenge,
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		}).Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "oauth_consent.grant", "oauth_client", client.ClientID).
+			Diff(nil, gin.H{"scopes": scopes}))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to authorize")
+		return
+	}
+
+	params.Set("code", code)
+	ctx.JSON(http.StatusOK, AuthorizeResponse{RedirectTo: redirectWith(request.RedirectURI, params)})
+}
+
+// authenticateClient identifies the client calling the token, introspection
+// or revocation endpoint by HTTP Basic authentication or the client_id and
+// client_secret form fields. Public clients have no secret.
+func authenticateClient(ctx *gin.Context) (*OAuthClient, bool) {
+	clientID, secret, basic := ctx.Request.BasicAuth()
+	if !basic {
+		clientID, secret = ctx.PostForm("client_id"), ctx.PostForm("client_secret")
+	}
+
+	client := new(OAuthClient)
+	err := database.BunDB.NewSelect().
+		Model(client).
+		Where("client_id = ?", clientID).
+		Scan(ctx.Request.Context())
+	if err == nil && client.SecretHash == nil && secret == "" {
+		return client, true
+	}
+	if err == nil && client.SecretHash != nil &&
+		subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(*client.SecretHash)) == 1 {
+		return client, true
+	}
+
+	ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, OAuthError{Error: "invalid_client", ErrorDescription: "Client authentication failed"})
+	return nil, false
+}
+
+// issueClientToken records and signs an access token for the client acting
+// as the user. Disabled accounts and those that must reset their password
+// get no tokens, whichever grant is used.
+func issueClientToken(ctx context.Context, tx bun.Tx, client *OAuthClient, user *User, scope string) (*TokenResponse, error) {
+	if user.DisabledAt != nil || user.PasswordResetRequired {
+		return nil, &oauthGrantError{code: "invalid_grant", description: "The account is disabled or must reset its password"}
+	}
+
+	tokenID, _, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := accessTokenTTL()
+	expiresAt := time.Now().Add(ttl)
+
+	_, err = tx.NewInsert().Model(&OAuthToken{
+		ID:        tokenID,
+		ClientID:  client.ClientID,
+		UserID:    user.ID,
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+	}).Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := auth.Claims{
+		UserID:         user.ID,
+		Username:       user.Username,
+		Role:           user.Role,
+		SessionVersion: user.SessionVersion,
+		ClientID:       client.ClientID,
+		Scope:          scope,
+	}
+	claims.ID = tokenID
+	accessToken, err := auth.GenerateClientToken(claims, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+// oauthGrantError is a token request rejected with an RFC 6749 error code.
+type oauthGrantError struct {
+	code        string
+	description string
+}
+
+func (e *oauthGrantError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// exchangeCode redeems an authorization code, checking it against the
+// client, the redirect URI and the PKCE code verifier.
+func exchangeCode(ctx context.Context, tx bun.Tx, client *OAuthClient, code, redirectURI, verifier string) (*TokenResponse, error) {
+	invalid := &oauthGrantError{code: "invalid_grant", description: "Invalid or expired authorization code"}
+
+	grant := new(OAuthCode)
+	err := tx.NewSelect().
+		Model(grant).
+		Where("code_hash = ?", hashToken(code)).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if grant.UsedAt != nil || time.Now().After(grant.ExpiresAt) ||
+		grant.ClientID != client.ClientID || grant.RedirectURI != redirectURI {
+		return nil, invalid
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(grant.CodeChallenge)) != 1 {
+		return nil, &oauthGrantError{code: "invalid_grant", description: "PKCE verification failed"}
+	}
+
+	_, err = tx.NewUpdate().
+		Model(grant).
+		Set("used_at = ?", time.Now()).
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user := new(User)
+	if err := tx.NewSelect().Model(user).Where("id = ?", grant.UserID).Scan(ctx); err != nil {
+		return nil, invalid
+	}
+	return issueClientToken(ctx, tx, client, user, grant.Scope)
+}
+
+// @Summary Issue an access token
+// @Description OAuth 2.0 token endpoint. grant_type=authorization_code redeems a code from /oauth/authorize with its PKCE code_verifier; grant_type=client_credentials issues a token for a confidential client acting as the user who registered it. Clients authenticate with HTTP Basic or client_id and client_secret form fields.
+// @Tags OAuth
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param grant_type formData string true "authorization_code or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI the code was sent to"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param scope formData string false "Space-separated scopes for client_credentials"
+// @Param client_id formData string false "Client ID, unless using HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless using HTTP Basic"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} OAuthError "Invalid request or grant"
+// @Failure 401 {object} OAuthError "Client authentication failed"
+// @Failure 500 {object} OAuthError "Server error"
+// @Router /oauth/token [post]
+func Token(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+
+	client, ok := authenticateClient(ctx)
+	if !ok {
+		return
+	}
+
+	var response *TokenResponse
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		var err error
+		switch ctx.PostForm("grant_type") {
+		case "authorization_code":
+			code, verifier := ctx.PostForm("code"), ctx.PostForm("code_verifier")
+			if code == "" || verifier == "" {
+				return &oauthGrantError{code: "invalid_request", description: "code and code_verifier are required"}
+			}
+			response, err = exchangeCode(c, tx, client, code, ctx.PostForm("redirect_uri"), verifier)
+
+		case "client_credentials":
+			if client.SecretHash == nil {
+				return &oauthGrantError{code: "unauthorized_client", description: "Public clients can't use client_credentials"}
+			}
+			scopes := auth.ParseScope(ctx.PostForm("scope"))
+			if len(scopes) == 0 {
+				scopes = client.Scopes
+			}
+			if !auth.ValidScopes(scopes, client.Scopes) {
+				return &oauthGrantError{code: "invalid_scope", description: "Invalid scope for this client"}
+			}
+			owner := new(User)
+			if err := tx.NewSelect().Model(owner).Where("id = ?", client.OwnerID).Scan(c); err != nil {
+				return err
+			}
+			response, err = issueClientToken(c, tx, client, owner, strings.Join(scopes, " "))
+		default:
+			return &oauthGrantError{code: "unsupported_grant_type", description: "Use authorization_code or client_credentials"}
+		}
+		if err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "oauth_token.issue", "oauth_client", client.ClientID).
+			Diff(nil, gin.H{"grant_type": ctx.PostForm("grant_type"), "scope": response.Scope})
+		return audit.Record(c, tx, entry)
+	})
+	var grantErr *oauthGrantError
+	if errors.As(err, &grantErr) {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, OAuthError{Error: grantErr.code, ErrorDescription: grantErr.description})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Token request of client %s failed: %v\n", client.ClientID, err)
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// clientToken parses an access token issued to the client and loads its
+// record.
+func clientToken(ctx context.Context, client *OAuthClient, tokenString string) (*auth.Claims, *OAuthToken, error) {
+	claims, err := auth.ParseToken(tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.ClientID != client.ClientID {
+		return nil, nil, errors.New("token was issued to another client")
+	}
+
+	token := new(OAuthToken)
+	err = database.BunDB.NewSelect().
+		Model(token).
+		Where("id = ?", claims.ID).
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, token, nil
+}
+
+// @Summary Introspect an access token
+// @Description OAuth 2.0 token introspection (RFC 7662) for confidential clients, limited to tokens issued to the calling client
+// @Tags OAuth
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param token formData string true "Access token"
+// @Param client_id formData string false "Client ID, unless using HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless using HTTP Basic"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 401 {object} OAuthError "Client authentication failed"
+// @Router /oauth/introspect [post]
+func Introspect(ctx *gin.Context) {
+	client, ok := authenticateClient(ctx)
+	if !ok {
+		return
+	}
+	if client.SecretHash == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, OAuthError{Error: "invalid_client", ErrorDescription: "Only confidential clients can introspect tokens"})
+		return
+	}
+
+	claims, token, err := clientToken(ctx.Request.Context(), client, ctx.PostForm("token"))
+	if err != nil || token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		ctx.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+	if version, err := SessionVersion(ctx.Request.Context(), claims.UserID); err != nil || version != claims.SessionVersion {
+		ctx.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		Scope:     token.Scope,
+		ClientID:  token.ClientID,
+		Username:  claims.Username,
+		Subject:   strconv.FormatInt(claims.UserID, 10),
+		TokenType: "Bearer",
+		ExpiresAt: token.ExpiresAt.Unix(),
+	}
+	if claims.IssuedAt != nil {
+		response.IssuedAt = claims.IssuedAt.Unix()
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// @Summary Revoke an access token
+// @Description OAuth 2.0 token revocation (RFC 7009). The response is the same whether or not the token was valid.
+// @Tags OAuth
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param token formData string true "Access token"
+// @Param client_id formData string false "Client ID, unless using HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless using HTTP Basic"
+// @Success 200 {object} SuccessResponse "Token revoked"
+// @Failure 401 {object} OAuthError "Client authentication failed"
+// @Failure 500 {object} OAuthError "Server error"
+// @Router /oauth/revoke [post]
+func Revoke(ctx *gin.Context) {
+	client, ok := authenticateClient(ctx)
+	if !ok {
+		return
+	}
+
+	_, token, err := clientToken(ctx.Request.Context(), client, ctx.PostForm("token"))
+	if err == nil && token.RevokedAt == nil {
+		err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+			_, err := tx.NewUpdate().
+				Model(token).
+				Set("revoked_at = ?", time.Now()).
+				WherePK().
+				Exec(c)
+			if err != nil {
+				return err
+			}
+			return audit.Record(c, tx, audit.New(ctx, "oauth_token.revoke", "oauth_token", token.ID).By(token.UserID))
+		})
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, OAuthError{Error: "server_error"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Token revoked"})
+}
+
+// OAuthTokenRevoked reports whether a client token was revoked or expired,
+// for auth.TokenRevoked.
+func OAuthTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	exists, err := database.BunDB.NewSelect().
+		Model((*OAuthToken)(nil)).
+		Where("id = ?", tokenID).
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Exists(ctx)
+	return !exists, err
+}
+
+// PurgeOAuthGrants deletes expired authorization codes and access tokens. It
+// is run periodically by the scheduler.
+func PurgeOAuthGrants(ctx context.Context) error {
+	_, err := database.BunDB.NewDelete().
+		Model((*OAuthCode)(nil)).
+		Where("expires_at <= ?", time.Now()).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.BunDB.NewDelete().
+		Model((*OAuthToken)(nil)).
+		Where("expires_at <= ?", time.Now()).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,296 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// OAuthClient is a third-party app registered to act on behalf of users.
+// Confidential clients have a secret, stored as a SHA-256 hash; public
+// clients such as mobile apps rely on PKCE alone.
+type OAuthClient struct {
+	bun.BaseModel `bun:"table:oauth_clients,alias:client" swaggerignore:"true"`
+
+	ID           int64     `bun:",pk,autoincrement" json:"-"`
+	ClientID     string    `bun:"client_id,unique,notnull" json:"client_id" example:"hb_3q2x7..."`
+	SecretHash   *string   `bun:"secret_hash" json:"-"`
+	Name         string    `bun:"name,notnull" json:"name" example:"Acme Meal Planner"`
+	RedirectURIs []string  `bun:"redirect_uris,array,notnull" json:"redirect_uris" example:"https://partner.example.com/callback"`
+	Scopes       []string  `bun:"scopes,array,notnull" json:"scopes" example:"orders:read"`
+	OwnerID      int64     `bun:"owner_id,notnull" json:"-"`
+	CreatedAt    time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// OAuthConsent records the scopes a user approved for a client.
+type OAuthConsent struct {
+	bun.BaseModel `bun:"table:oauth_consents,alias:consent" swaggerignore:"true"`
+
+	ID        int64     `bun:",pk,autoincrement" json:"-"`
+	UserID    int64     `bun:"user_id,notnull" json:"-"`
+	ClientID  string    `bun:"client_id,notnull" json:"client_id" example:"hb_3q2x7..."`
+	Scopes    []string  `bun:"scopes,array,notnull" json:"scopes" example:"orders:read"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	Client *OAuthClient `bun:"rel:belongs-to,join:client_id=client_id" json:"client,omitempty"`
+}
+
+type ClientRegistrationRequest struct {
+	Name         string   `json:"name" binding:"required" example:"Acme Meal Planner"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1,dive,url" example:"https://partner.example.com/callback"`
+	Scopes       []string `json:"scopes" binding:"required,min=1" example:"orders:read"`
+	// Confidential clients get a secret and may use client_credentials.
+	Confidential bool `json:"confidential" example:"true"`
+}
+
+type ClientRegistrationResponse struct {
+	OAuthClient
+	// ClientSecret is only shown once, at registration.
+	ClientSecret string `json:"client_secret,omitempty" example:"kP9x..."`
+}
+
+// grantConsent adds scopes to the user's consent for the client.
+func grantConsent(ctx context.Context, tx bun.Tx, userID int64, clientID string, scopes []string) error {
+	consent := new(OAuthConsent)
+	err := tx.NewSelect().
+		Model(consent).
+		Where("user_id = ?", userID).
+		Where("client_id = ?", clientID).
+		For("UPDATE").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.NewInsert().Model(&OAuthConsent{
+			UserID:   userID,
+			ClientID: clientID,
+			Scopes:   scopes,
+		}).Exec(ctx)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+	consent.UpdatedAt = time.Now()
+	_, err = tx.NewUpdate().Model(consent).Column("scopes", "updated_at").WherePK().Exec(ctx)
+	return err
+}
+
+// @Summary Register an OAuth client
+// @Description Register a third-party app owned by the current user. The client_secret of confidential clients is only returned here.
+// @Tags OAuth
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param client body ClientRegistrationRequest true "Client"
+// @Success 201 {object} ClientRegistrationResponse
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not register client"
+// @Router /oauth/clients [post]
+func RegisterClient(ctx *gin.Context) {
+	var request ClientRegistrationRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	for _, redirectURI := range request.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			problem.Abort(ctx, http.StatusBadRequest, "Redirect URIs must be absolute and without a fragment")
+			return
+		}
+	}
+	scopes := auth.ParseScope(strings.Join(request.Scopes, " "))
+	if !auth.ValidScopes(scopes, scopes) {
+		problem.Abort(ctx, http.StatusBadRequest, "Unknown scope")
+		return
+	}
+
+	clientID, _, err := newToken()
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not register client")
+		return
+	}
+	response := ClientRegistrationResponse{OAuthClient: OAuthClient{
+		ClientID:     "hb_" + clientID[:24],
+		Name:         request.Name,
+		RedirectURIs: request.RedirectURIs,
+		Scopes:       scopes,
+		OwnerID:      auth.CurrentClaims(ctx).UserID,
+	}}
+	if request.Confidential {
+		secret, secretHash, err := newToken()
+		if err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Could not register client")
+			return
+		}
+		response.ClientSecret = secret
+		response.SecretHash = &secretHash
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&response.OAuthClient).Returning("*").Exec(c); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "oauth_client.create", "oauth_client", response.ClientID).Diff(nil, response.OAuthClient))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not register client")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// @Summary Get my OAuth clients
+// @Description Retrieve the third-party apps registered by the current user
+// @Tags OAuth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of clients"
+// @Failure 500 {object} problem.Problem "Couldn't fetch clients"
+// @Router /oauth/clients [get]
+func GetClients(ctx *gin.Context) {
+	var clients []OAuthClient
+
+	err := database.BunDB.NewSelect().
+		Model(&clients).
+		Where("owner_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("created_at ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch clients")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"clients": clients})
+}
+
+// @Summary Delete an OAuth client
+// @Description Delete a third-party app registered by the current user, with every consent and token issued to it
+// @Tags OAuth
+// @Produce  json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} SuccessResponse "Client deleted successfully!"
+// @Failure 404 {object} problem.Problem "Client not found"
+// @Failure 500 {object} problem.Problem "Failed to delete client"
+// @Router /oauth/clients/{client_id} [delete]
+func DeleteClient(ctx *gin.Context) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*OAuthClient)(nil)).
+			Where("client_id = ?", ctx.Param("client_id")).
+			Where("owner_id = ?", auth.CurrentClaims(ctx).UserID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "oauth_client.delete", "oauth_client", ctx.Param("client_id")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Client not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete client")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Client deleted successfully!"})
+}
+
+// @Summary Get my authorized apps
+// @Description Retrieve the third-party apps the current user has granted access to, with the approved scopes
+// @Tags OAuth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of consents"
+// @Failure 500 {object} problem.Problem "Couldn't fetch authorized apps"
+// @Router /oauth/consents [get]
+func GetConsents(ctx *gin.Context) {
+	var consents []OAuthConsent
+
+	err := database.BunDB.NewSelect().
+		Model(&consents).
+		Relation("Client").
+		Where("consent.user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("consent.updated_at DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch authorized apps")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"consents": consents})
+}
+
+// @Summary Revoke an app's access
+// @Description Withdraw the current user's consent for a third-party app and revoke every token issued to it for the user
+// @Tags OAuth
+// @Produce  json
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 200 {object} SuccessResponse "Access revoked"
+// @Failure 404 {object} problem.Problem "App not authorized"
+// @Failure 500 {object} problem.Problem "Failed to revoke access"
+// @Router /oauth/consents/{client_id} [delete]
+func RevokeConsent(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+	clientID := ctx.Param("client_id")
+
+	var rowsAffected int64
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*OAuthConsent)(nil)).
+			Where("user_id = ?", userID).
+			Where("client_id = ?", clientID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		rowsAffected, _ = result.RowsAffected()
+
+		_, err = tx.NewUpdate().
+			Model((*OAuthToken)(nil)).
+			Set("revoked_at = ?", time.Now()).
+			Where("user_id = ?", userID).
+			Where("client_id = ?", clientID).
+			Where("revoked_at IS NULL").
+			Exec(c)
+		if err != nil || rowsAffected == 0 {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "oauth_consent.revoke", "oauth_client", clientID))
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to revoke access")
+		return
+	}
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "App not authorized")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Access revoked"})
+}
@@ -0,0 +1,514 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/oidc"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// oidcLoginTTL is how long the user has to complete sign-in at the provider.
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	errInvalidOIDCState = errors.New("invalid or expired sign-in state")
+	errIdentityTaken    = errors.New("identity is linked to another user")
+	errProviderLinked   = errors.New("a different account of the provider is already linked")
+	errEmailTaken       = errors.New("email belongs to an existing account")
+	errLastSignIn       = errors.New("identity is the user's only way to sign in")
+	errAccountDeleted   = errors.New("account has been deleted")
+)
+
+// Providers are the OpenID Connect providers users can sign in with, keyed by
+// name. They are set up in main.
+var Providers map[string]*oidc.Provider
+
+// UserIdentity links an account at an OpenID Connect provider to a user.
+type UserIdentity struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	UserID    int64     `bun:"user_id,notnull" json:"-"`
+	Provider  string    `bun:"provider,notnull" json:"provider" example:"google"`
+	Subject   string    `bun:"subject,notnull" json:"-"`
+	Email     *string   `bun:"email" json:"email,omitempty" example:"john@example.com"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// OIDCLogin is a sign-in in progress at a provider. The state parameter is
+// stored hashed; UserID is set when an existing user is linking a provider.
+type OIDCLogin struct {
+	ID           int64     `bun:",pk,autoincrement"`
+	StateHash    string    `bun:"state_hash,unique,notnull"`
+	Provider     string    `bun:"provider,notnull"`
+	CodeVerifier string    `bun:"code_verifier,notnull"`
+	Nonce        string    `bun:"nonce,notnull"`
+	UserID       *int64    `bun:"user_id"`
+	ExpiresAt    time.Time `bun:"expires_at,notnull"`
+}
+
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://accounts.google.com/o/oauth2/v2/auth?client_id=..."`
+}
+
+// startOIDCLogin records a new sign-in and returns the provider's
+// authorization URL for it.
+func startOIDCLogin(ctx context.Context, provider *oidc.Provider, userID *int64) (string, error) {
+	state, stateHash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.NewNonce()
+	if err != nil {
+		return "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", err
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.BunDB.NewInsert().Model(&OIDCLogin{
+		StateHash:    stateHash,
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}).Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return authorizationURL, nil
+}
+
+// consumeOIDCLogin looks up and removes the sign-in with the state, so a
+// callback can't be replayed.
+func consumeOIDCLogin(ctx context.Context, provider, state string) (*OIDCLogin, error) {
+	login := new(OIDCLogin)
+	err := database.BunDB.NewDelete().
+		Model(login).
+		Where("state_hash = ?", hashToken(state)).
+		Where("provider = ?", provider).
+		Where("expires_at > ?", time.Now()).
+		Returning("*").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errInvalidOIDCState
+	}
+	return login, err
+}
+
+// linkIdentity links the provider account to the user.
+func linkIdentity(ctx context.Context, tx bun.Tx, userID int64, identity *oidc.Identity) error {
+	existing := new(UserIdentity)
+	err := tx.NewSelect().
+		Model(existing).
+		Where("provider = ?", identity.Provider).
+		Where("subject = ? OR user_id = ?", identity.Subject, userID).
+		Limit(1).
+		Scan(ctx)
+	if err == nil {
+		switch {
+		case existing.Subject != identity.Subject:
+			return errProviderLinked
+		case existing.UserID != userID:
+			return errIdentityTaken
+		}
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	link := &UserIdentity{UserID: userID, Provider: identity.Provider, Subject: identity.Subject}
+	if identity.Email != "" {
+		link.Email = &identity.Email
+	}
+	_, err = tx.NewInsert().Model(link).Exec(ctx)
+	return err
+}
+
+// socialUsername picks a free username for a new user from the identity's
+// email address or name.
+func socialUsername(ctx context.Context, tx bun.Tx, identity *oidc.Identity) (string, error) {
+	base, _, _ := strings.Cut(identity.Email, "@")
+	if base == "" {
+		base = identity.Name
+	}
+	base = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, base)
+	if base == "" {
+		base = identity.Provider + "user"
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		exists, err := tx.NewSelect().
+			Model((*User)(nil)).
+			Where("username = ?", candidate).
+			WhereAllWithDeleted().
+			Exists(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		suffix, err := rand.Int(rand.Reader, big.NewInt(100000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%d", base, suffix)
+	}
+	return "", errors.New("no free username found")
+}
+
+// signUpWithIdentity creates user for an identity nobody has linked yet,
+// filling in the account details from the identity. Users created this way
+// have no password until they set one with a reset.
+func signUpWithIdentity(ctx context.Context, tx bun.Tx, identity *oidc.Identity, user *User) (*User, error) {
+	user.Role = auth.RoleCustomer
+	if identity.Email != "" {
+		taken, err := tx.NewSelect().
+			Model((*User)(nil)).
+			Where("email = ?", identity.Email).
+			WhereAllWithDeleted().
+			Exists(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, errEmailTaken
+		}
+		user.Email = &identity.Email
+		if identity.EmailVerified {
+			now := time.Now()
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	username, err := socialUsername(ctx, tx, identity)
+	if err != nil {
+		return nil, err
+	}
+	user.Username = username
+
+	if _, err := tx.NewInsert().Model(user).Returning("*").Exec(ctx); err != nil {
+		return nil, err
+	}
+	if err := linkIdentity(ctx, tx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func findProvider(ctx *gin.Context) *oidc.Provider {
+	provider, ok := Providers[ctx.Param("provider")]
+	if !ok {
+		problem.Abort(ctx, http.StatusNotFound, "Unknown sign-in provider")
+		return nil
+	}
+	return provider
+}
+
+// @Summary Get sign-in providers
+// @Description Retrieve the names of the configured OpenID Connect providers, such as google and apple
+// @Tags Auth
+// @Produce  json
+// @Success 200 {object} map[string]interface{} "List of providers"
+// @Router /auth/providers [get]
+func GetProviders(ctx *gin.Context) {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ctx.JSON(http.StatusOK, gin.H{"providers": names})
+}
+
+// @Summary Sign in with a provider
+// @Description Redirect to the provider's sign-in page (authorization code flow with PKCE). The provider sends the user back to /auth/{provider}/callback.
+// @Tags Auth
+// @Param provider path string true "Provider name" example(google)
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {object} problem.Problem "Unknown sign-in provider"
+// @Failure 502 {object} problem.Problem "Provider is unavailable"
+// @Router /auth/{provider}/login [get]
+func LoginWithProvider(ctx *gin.Context) {
+	provider := findProvider(ctx)
+	if provider == nil {
+		return
+	}
+
+	authorizationURL, err := startOIDCLogin(ctx.Request.Context(), provider, nil)
+	if err != nil {
+		fmt.Printf("Starting %s sign-in failed: %v\n", provider.Name, err)
+		problem.AbortWithCode(ctx, http.StatusBadGateway, problem.CodeProviderUnavailable, "Provider is unavailable")
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, authorizationURL)
+}
+
+// @Summary Link a provider to the current user
+// @Description Start linking an account at the provider to the current user, e.g. to sign in with Google instead of the username. Open the returned URL in the browser; the provider sends the user back to /auth/{provider}/callback.
+// @Tags Auth
+// @Produce  json
+// @Security BearerAuth
+// @Param provider path string true "Provider name" example(google)
+// @Success 200 {object} AuthorizationURLResponse
+// @Failure 404 {object} problem.Problem "Unknown sign-in provider"
+// @Failure 502 {object} problem.Problem "Provider is unavailable"
+// @Router /auth/{provider}/link [post]
+func LinkProvider(ctx *gin.Context) {
+	provider := findProvider(ctx)
+	if provider == nil {
+		return
+	}
+
+	userID := auth.CurrentClaims(ctx).UserID
+	authorizationURL, err := startOIDCLogin(ctx.Request.Context(), provider, &userID)
+	if err != nil {
+		fmt.Printf("Starting %s link for user %d failed: %v\n", provider.Name, userID, err)
+		problem.AbortWithCode(ctx, http.StatusBadGateway, problem.CodeProviderUnavailable, "Provider is unavailable")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, AuthorizationURLResponse{AuthorizationURL: authorizationURL})
+}
+
+// @Summary Complete sign-in with a provider
+// @Description Called by the provider after sign-in, with the query string or, for form_post providers such as Apple, a form. Signs in the user linked to the provider account, creating a new user on first sign-in, or links the account when started from /auth/{provider}/link. Returns a JWT token like /login, or an mfa_token for accounts with two-factor authentication.
+// @Tags Auth
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param provider path string true "Provider name" example(google)
+// @Param code query string false "Authorization code"
+// @Param state query string false "State"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem "Invalid or expired sign-in state, or sign-in cancelled"
+// @Failure 401 {object} problem.Problem "Could not verify the sign-in"
+// @Failure 403 {object} problem.Problem "This account has been deleted"
+// @Failure 404 {object} problem.Problem "Unknown sign-in provider"
+// @Failure 409 {object} problem.Problem "Account already linked, or email belongs to an existing account"
+// @Failure 500 {object} problem.Problem "Failed to sign in"
+// @Router /auth/{provider}/callback [get]
+// @Router /auth/{provider}/callback [post]
+func ProviderCallback(ctx *gin.Context) {
+	provider := findProvider(ctx)
+	if provider == nil {
+		return
+	}
+
+	if reason := ctx.Request.FormValue("error"); reason != "" {
+		problem.Abort(ctx, http.StatusBadRequest, "Sign-in was not completed: "+reason)
+		return
+	}
+
+	login, err := consumeOIDCLogin(ctx.Request.Context(), provider.Name, ctx.Request.FormValue("state"))
+	if errors.Is(err, errInvalidOIDCState) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid or expired sign-in, try again")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+
+	identity, err := provider.Exchange(ctx.Request.Context(), ctx.Request.FormValue("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		fmt.Printf("%s sign-in failed: %v\n", provider.Name, err)
+		problem.Abort(ctx, http.StatusUnauthorized, "Could not verify the sign-in")
+		return
+	}
+
+	if login.UserID != nil {
+		err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+			if err := linkIdentity(c, tx, *login.UserID, identity); err != nil {
+				return err
+			}
+			entry := audit.New(ctx, "identity.link", "user", *login.UserID).By(*login.UserID).
+				Diff(nil, gin.H{"provider": identity.Provider})
+			return audit.Record(c, tx, entry)
+		})
+		switch {
+		case errors.Is(err, errIdentityTaken):
+			problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "This account is already linked to another user")
+		case errors.Is(err, errProviderLinked):
+			problem.Abort(ctx, http.StatusConflict, "Another "+provider.Name+" account is already linked, unlink it first")
+		case err != nil:
+			problem.Abort(ctx, http.StatusInternalServerError, "Failed to link account")
+		default:
+			ctx.JSON(http.StatusOK, SuccessResponse{Message: "Account linked"})
+		}
+		return
+	}
+
+	user := new(User)
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(user).
+			Join("JOIN user_identities AS i ON i.user_id = ?TableAlias.id").
+			Where("i.provider = ?", identity.Provider).
+			Where("i.subject = ?", identity.Subject).
+			WhereAllWithDeleted().
+			Scan(c)
+		if errors.Is(err, sql.ErrNoRows) {
+			newUser := new(User)
+			recordSignup(ctx, newUser)
+			user, err = signUpWithIdentity(c, tx, identity, newUser)
+			if err != nil {
+				return err
+			}
+			entry := audit.New(ctx, "user.register", "user", user.ID).By(user.ID).Diff(nil, NewUserResponse(user)).Redact(personalFields...)
+			return audit.Record(c, tx, entry)
+		}
+		if err == nil && !user.DeletedAt.IsZero() {
+			return errAccountDeleted
+		}
+		return err
+	})
+	if errors.Is(err, errAccountDeleted) {
+		problem.Abort(ctx, http.StatusForbidden, "This account has been deleted")
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		// Signing in must not take over an existing account; its owner can
+		// link the provider after signing in with the password.
+		problem.Abort(ctx, http.StatusConflict, "An account with this email already exists. Sign in with your password and link "+provider.Name+" from your account.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("%s sign-in failed: %v\n", provider.Name, err)
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to sign in")
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		mfaChallenge(ctx, user)
+		return
+	}
+	issueToken(ctx, user)
+}
+
+// @Summary Get linked providers
+// @Description Retrieve the provider accounts linked to the current user
+// @Tags Auth
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "List of linked identities"
+// @Failure 500 {object} problem.Problem "Couldn't fetch linked accounts"
+// @Router /auth/identities [get]
+func GetIdentities(ctx *gin.Context) {
+	var identities []UserIdentity
+
+	err := database.BunDB.NewSelect().
+		Model(&identities).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("provider ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch linked accounts")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// @Summary Unlink a provider
+// @Description Unlink the current user's account at the provider. The last sign-in method can't be removed, so users without a password must set one first.
+// @Tags Auth
+// @Produce  json
+// @Security BearerAuth
+// @Param provider path string true "Provider name" example(google)
+// @Success 200 {object} SuccessResponse "Account unlinked"
+// @Failure 404 {object} problem.Problem "Provider is not linked"
+// @Failure 409 {object} problem.Problem "Can't remove the only sign-in method"
+// @Failure 500 {object} problem.Problem "Failed to unlink account"
+// @Router /auth/identities/{provider} [delete]
+func UnlinkProvider(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user, err := lockUser(c, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.NewDelete().
+			Model((*UserIdentity)(nil)).
+			Where("user_id = ?", userID).
+			Where("provider = ?", ctx.Param("provider")).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		if user.Password == "" {
+			remaining, err := tx.NewSelect().
+				Model((*UserIdentity)(nil)).
+				Where("user_id = ?", userID).
+				Count(c)
+			if err != nil {
+				return err
+			}
+			if remaining == 0 {
+				return errLastSignIn
+			}
+		}
+		entry := audit.New(ctx, "identity.unlink", "user", userID).Diff(gin.H{"provider": ctx.Param("provider")}, nil)
+		return audit.Record(c, tx, entry)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Provider is not linked")
+		return
+	}
+	if errors.Is(err, errLastSignIn) {
+		problem.Abort(ctx, http.StatusConflict, "This is your only way to sign in, set a password first")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to unlink account")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Account unlinked"})
+}
+
+// PurgeOIDCLogins deletes sign-ins that were never completed. It is run
+// periodically by the scheduler.
+func PurgeOIDCLogins(ctx context.Context) error {
+	_, err := database.BunDB.NewDelete().
+		Model((*OIDCLogin)(nil)).
+		Where("expires_at <= ?", time.Now()).
+		Exec(ctx)
+	return err
+}
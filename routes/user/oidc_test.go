@@ -0,0 +1,169 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/migrations"
+	"github.com/in43sh/homebuzz-backend/oidc"
+	"github.com/in43sh/homebuzz-backend/oidc/oidctest"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// testDB connects database.BunDB to the disposable database in
+// TEST_DATABASE_URL and migrates it, or skips the test without one.
+func testDB(t *testing.T) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	if database.BunDB == nil {
+		database.BunDB = bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+		migrations.Migrate(database.BunDB)
+	}
+}
+
+// oidcRouter serves the sign-in routes with provider as the only provider.
+func oidcRouter(t *testing.T, provider *oidc.Provider) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	providers, sessionVersion := Providers, auth.SessionVersion
+	Providers = map[string]*oidc.Provider{provider.Name: provider}
+	auth.SessionVersion = SessionVersion
+	t.Cleanup(func() { Providers, auth.SessionVersion = providers, sessionVersion })
+
+	router := gin.New()
+	router.GET("/auth/:provider/login", LoginWithProvider)
+	router.GET("/auth/:provider/callback", ProviderCallback)
+	router.POST("/auth/:provider/link", auth.RequireAuth(), LinkProvider)
+	return router
+}
+
+func serve(router *gin.Engine, method, target, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// startSignIn starts signing in at /auth/mock/login and returns the
+// provider's authorization URL.
+func startSignIn(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+
+	response := serve(router, http.MethodGet, "/auth/mock/login", "")
+	if response.Code != http.StatusFound {
+		t.Fatalf("login = %d %s, want 302", response.Code, response.Body)
+	}
+	return response.Header().Get("Location")
+}
+
+func callback(router *gin.Engine, code, state string) *httptest.ResponseRecorder {
+	query := url.Values{"code": {code}, "state": {state}}
+	return serve(router, http.MethodGet, "/auth/mock/callback?"+query.Encode(), "")
+}
+
+// uniqueUser returns an identity nobody has signed in with yet.
+func uniqueUser() oidctest.User {
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	return oidctest.User{Subject: "sub-" + suffix, Email: "ada-" + suffix + "@example.com", EmailVerified: true, Name: "Ada"}
+}
+
+func TestProviderCallbackChecksState(t *testing.T) {
+	testDB(t)
+	server := oidctest.NewServer(t, "homebuzz")
+	router := oidcRouter(t, server.Provider("mock"))
+
+	code, state := server.SignIn(t, startSignIn(t, router), uniqueUser())
+
+	if response := callback(router, code, "forged-"+state); response.Code != http.StatusBadRequest {
+		t.Errorf("callback with another state = %d %s, want 400", response.Code, response.Body)
+	}
+	if response := callback(router, code, state); response.Code != http.StatusOK {
+		t.Fatalf("callback = %d %s, want 200", response.Code, response.Body)
+	}
+	if response := callback(router, code, state); response.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback = %d %s, want 400", response.Code, response.Body)
+	}
+}
+
+func TestProviderCallbackLinksExistingVerifiedEmail(t *testing.T) {
+	testDB(t)
+	server := oidctest.NewServer(t, "homebuzz")
+	router := oidcRouter(t, server.Provider("mock"))
+	ctx := context.Background()
+
+	identity := uniqueUser()
+	now := time.Now()
+	user := &User{Username: "ada" + identity.Subject, Password: "not-a-hash", Email: &identity.Email, EmailVerifiedAt: &now, Role: auth.RoleCustomer}
+	if _, err := database.BunDB.NewInsert().Model(user).Returning("*").Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signing in with the provider must not take over the account, even
+	// though the provider vouches for the same email address.
+	code, state := server.SignIn(t, startSignIn(t, router), identity)
+	if response := callback(router, code, state); response.Code != http.StatusConflict {
+		t.Fatalf("sign-in with an existing email = %d %s, want 409", response.Code, response.Body)
+	}
+	linked, err := database.BunDB.NewSelect().Model((*UserIdentity)(nil)).Where("subject = ?", identity.Subject).Exists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked {
+		t.Fatal("the identity was linked by signing in")
+	}
+
+	// The account's owner links it after signing in.
+	token, err := newAccessToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := serve(router, http.MethodPost, "/auth/mock/link", token)
+	if response.Code != http.StatusOK {
+		t.Fatalf("link = %d %s, want 200", response.Code, response.Body)
+	}
+	var link AuthorizationURLResponse
+	if err := json.Unmarshal(response.Body.Bytes(), &link); err != nil {
+		t.Fatal(err)
+	}
+	code, state = server.SignIn(t, link.AuthorizationURL, identity)
+	if response := callback(router, code, state); response.Code != http.StatusOK {
+		t.Fatalf("link callback = %d %s, want 200", response.Code, response.Body)
+	}
+
+	// From then on, signing in with the provider signs in to the account.
+	code, state = server.SignIn(t, startSignIn(t, router), identity)
+	response = callback(router, code, state)
+	if response.Code != http.StatusOK {
+		t.Fatalf("sign-in after linking = %d %s, want 200", response.Code, response.Body)
+	}
+	var login struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Username != user.Username {
+		t.Errorf("signed in as %q, want %q", login.Username, user.Username)
+	}
+}
@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/mail"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// Mailer sends account emails. It is set up in main.
+var Mailer mail.Mailer
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// weakPasswordError carries password policy violations out of a transaction.
+type weakPasswordError struct {
+	problems []string
+}
+
+func (e *weakPasswordError) Error() string {
+	return "password is too weak: " + strings.Join(e.problems, ", ")
+}
+
+// PasswordResetToken is a single-use password reset link. Only the SHA-256
+// hash of the token is stored.
+type PasswordResetToken struct {
+	ID        int64      `bun:",pk,autoincrement"`
+	UserID    int64      `bun:"user_id,notnull"`
+	TokenHash string     `bun:"token_hash,notnull,unique"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull"`
+	UsedAt    *time.Time `bun:"used_at"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp"`
+}
+
+type ForgotPasswordRequest struct {
+	Login string `json:"login" binding:"required" example:"john@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required" example:"Zk9x2m1hQ0b7cVd3pLr8sT5uYw4aEe6fGh1jKl2mNo0"`
+	Password string `json:"password" binding:"required" example:"newpassword123"`
+}
+
+// resetTokenTTL is how long a reset link stays valid, configured with
+// PASSWORD_RESET_MINUTES.
+func resetTokenTTL() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PASSWORD_RESET_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// appURL is the address of the web app links in emails point to, configured
+// with APP_URL.
+func appURL() string {
+	if value := os.Getenv("APP_URL"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// newToken returns a random token and the hash stored in its place.
+func newToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionVersion returns the user's session version for auth.SessionVersion.
+// Disabled and deleted accounts have none, so every token of theirs fails.
+func SessionVersion(ctx context.Context, userID int64) (int, error) {
+	var version int
+	err := database.BunDB.NewSelect().
+		Model((*User)(nil)).
+		Column("session_version").
+		Where("id = ?", userID).
+		Where("disabled_at IS NULL").
+		Scan(ctx, &version)
+	return version, err
+}
+
+// setPassword stores a new password, lifting a forced reset, and signs the
+// user out everywhere.
+func setPassword(ctx context.Context, db bun.IDB, userID int64, password string) error {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.NewUpdate().
+		Model((*User)(nil)).
+		Set("password = ?", hashedPassword).
+		Set("password_reset_required = FALSE").
+		Set("session_version = session_version + 1").
+		Where("id = ?", userID).
+		Exec(ctx)
+	return err
+}
+
+// sendNotice emails the user a security notice, if they have an address.
+// Failures are only logged, the change it reports has already happened, and
+// the notice goes out even if the client has gone away.
+func sendNotice(ctx context.Context, user *User, name string, data map[string]any) {
+	if user.Email == nil {
+		return
+	}
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["Username"] = user.Username
+
+	message, err := mail.Render(*user.Email, name, data)
+	if err == nil {
+		err = Mailer.Send(context.WithoutCancel(ctx), message)
+	}
+	if err != nil {
+		fmt.Printf("Sending %s notice to user %d failed: %v\n", name, user.ID, err)
+	}
+}
+
+// sendPasswordReset emails the user a new reset link. Earlier links stop
+// working.
+func sendPasswordReset(ctx context.Context, db bun.IDB, user *User) error {
+	token, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	return db.RunInTx(ctx, nil, func(c context.Context, tx bun.Tx) error {
+		// Only the newest link works.
+		_, err := tx.NewUpdate().
+			Model((*PasswordResetToken)(nil)).
+			Set("used_at = ?", time.Now()).
+			Where("user_id = ?", user.ID).
+			Where("used_at IS NULL").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(&PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().Add(resetTokenTTL()),
+		}).Exec(c)
+		if err != nil {
+			return err
+		}
+
+		message, err := mail.Render(*user.Email, "password_reset", map[string]any{
+			"Username":  user.Username,
+			"Link":      appURL() + "/reset-password?token=" + url.QueryEscape(token),
+			"ExpiresIn": resetTokenTTL().String(),
+		})
+		if err != nil {
+			return err
+		}
+		return Mailer.Send(c, message)
+	})
+}
+
+// @Summary Request a password reset
+// @Description Email a single-use password reset link to the account with the given username or email address. The response is the same whether or not the account exists.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body ForgotPasswordRequest true "Username or email"
+// @Success 200 {object} SuccessResponse "Reset link sent"
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not send reset link"
+// @Router /password/forgot [post]
+func ForgotPassword(ctx *gin.Context) {
+	var request ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	response := SuccessResponse{Message: "If the account exists and has an email address, a reset link has been sent"}
+
+	login := strings.TrimSpace(request.Login)
+	user := new(User)
+	err := database.BunDB.NewSelect().
+		Model(user).
+		Where("username = ? OR email = ?", login, strings.ToLower(login)).
+		Scan(ctx.Request.Context())
+	if err != nil || user.Email == nil {
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if err := audit.Record(c, tx, audit.New(ctx, "user.password_reset_request", "user", user.ID)); err != nil {
+			return err
+		}
+		return sendPasswordReset(c, tx, user)
+	})
+	if err != nil {
+		fmt.Printf("Password reset for user %d failed: %v\n", user.ID, err)
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not send reset link")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// @Summary Reset a password
+// @Description Set a new password with a token from a reset email. The token can only be used once, and every existing session of the account is signed out.
+// @Tags Auth
+// @Accept  json
+// @Produce  json
+// @Param request body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} SuccessResponse "Password has been reset"
+// @Failure 400 {object} problem.Problem "Invalid or expired reset token, or password too weak"
+// @Failure 500 {object} problem.Problem "Could not reset password"
+// @Router /password/reset [post]
+func ResetPassword(ctx *gin.Context) {
+	var request ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	user := new(User)
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		resetToken := new(PasswordResetToken)
+		err := tx.NewSelect().
+			Model(resetToken).
+			Where("token_hash = ?", hashToken(request.Token)).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", time.Now()).
+			For("UPDATE").
+			Scan(c)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.NewSelect().Model(user).Where("id = ?", resetToken.UserID).Scan(c); err != nil {
+			return err
+		}
+		// A rejected password leaves the token usable for another try.
+		if problems := PasswordPolicy.Validate(request.Password, user.Username); len(problems) > 0 {
+			return &weakPasswordError{problems: problems}
+		}
+
+		_, err = tx.NewUpdate().
+			Model(resetToken).
+			Set("used_at = ?", time.Now()).
+			WherePK().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		if err := setPassword(c, tx, resetToken.UserID, request.Password); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.password_reset", "user", user.ID).By(user.ID))
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		problem.Abort(ctx, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	var weakErr *weakPasswordError
+	if errors.As(err, &weakErr) {
+		abortWeakPassword(ctx, "password", weakErr.problems)
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not reset password")
+		return
+	}
+
+	sendNotice(ctx.Request.Context(), user, "password_changed", nil)
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Password has been reset"})
+}
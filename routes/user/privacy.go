@@ -0,0 +1,228 @@
+package routes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/notification"
+	"github.com/in43sh/homebuzz-backend/problem"
+	addressRoutes "github.com/in43sh/homebuzz-backend/routes/address"
+	cartRoutes "github.com/in43sh/homebuzz-backend/routes/cart"
+	orderRoutes "github.com/in43sh/homebuzz-backend/routes/order"
+	subscriptionRoutes "github.com/in43sh/homebuzz-backend/routes/subscription"
+	"github.com/in43sh/homebuzz-backend/wishlist"
+	"github.com/uptrace/bun"
+)
+
+var (
+	errOwnAccount    = errors.New("can't erase your own account")
+	errAlreadyErased = errors.New("account already erased")
+)
+
+// DataExport is everything kept about a user, for data subject access
+// requests.
+type DataExport struct {
+	ExportedAt     time.Time                         `json:"exported_at"`
+	Profile        AdminUserResponse                 `json:"profile"`
+	Addresses      []addressRoutes.Address           `json:"addresses"`
+	Orders         []orderRoutes.Order               `json:"orders"`
+	Subscriptions  []subscriptionRoutes.Subscription `json:"subscriptions"`
+	Wishlists      []wishlist.List                   `json:"wishlists"`
+	Cart           []cartRoutes.CartItem             `json:"cart"`
+	Notifications  []notification.Notification       `json:"notifications"`
+	LinkedAccounts []UserIdentity                    `json:"linked_accounts"`
+	APIKeys        []APIKey                          `json:"api_keys"`
+	AuthorizedApps []OAuthConsent                    `json:"authorized_apps"`
+	// AuditLog holds the actions taken by the user or on their account,
+	// without the IP address and user agent of anyone acting on it.
+	AuditLog []audit.Entry `json:"audit_log"`
+}
+
+type ErasureResponse struct {
+	Message string `json:"message" example:"Personal data erased, orders kept"`
+	// Kept is true when the account had orders or other records the shop
+	// has to keep, and was anonymized instead of deleted.
+	Kept bool `json:"kept" example:"true"`
+}
+
+// exportData collects everything kept about the user.
+func exportData(ctx context.Context, db bun.IDB, user *User) (*DataExport, error) {
+	export := &DataExport{ExportedAt: time.Now(), Profile: NewAdminUserResponse(user)}
+
+	queries := []*bun.SelectQuery{
+		db.NewSelect().Model(&export.Addresses).Where("user_id = ?", user.ID).Order("id ASC"),
+		db.NewSelect().
+			Model(&export.Orders).
+			Relation("Items").
+			Relation("Discounts").
+			Relation("Taxes").
+			Where("o.user_id = ?", user.ID).
+			Order("o.id ASC"),
+		db.NewSelect().
+			Model(&export.Subscriptions).
+			Relation("Items").
+			Relation("Runs").
+			Where("subscription.user_id = ?", user.ID).
+			Order("subscription.id ASC"),
+		db.NewSelect().Model(&export.Wishlists).Relation("Items").Where("list.user_id = ?", user.ID).Order("list.id ASC"),
+		db.NewSelect().Model(&export.Cart).Where("user_id = ?", user.ID).Order("id ASC"),
+		db.NewSelect().Model(&export.Notifications).Where("user_id = ?", user.ID).Order("id ASC"),
+		db.NewSelect().Model(&export.LinkedAccounts).Where("user_id = ?", user.ID).Order("id ASC"),
+		db.NewSelect().Model(&export.APIKeys).Where("user_id = ?", user.ID).Order("id ASC"),
+		db.NewSelect().Model(&export.AuthorizedApps).Relation("Client").Where("consent.user_id = ?", user.ID).Order("consent.id ASC"),
+		db.NewSelect().
+			Model(&export.AuditLog).
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				return q.Where("actor_id = ?", user.ID).
+					WhereOr("target_type = 'user' AND target_id = ?", fmt.Sprint(user.ID))
+			}).
+			Order("id ASC"),
+	}
+	for _, query := range queries {
+		if err := query.Scan(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// Where staff acted on the account, or as the user while impersonating
+	// them, the IP address and user agent are theirs and not the user's.
+	for i := range export.AuditLog {
+		entry := &export.AuditLog[i]
+		if entry.ActorID == nil || *entry.ActorID != user.ID || entry.ImpersonatorID != nil {
+			entry.IP = ""
+			entry.UserAgent = ""
+		}
+	}
+	return export, nil
+}
+
+// sendExport responds with the export as a JSON file to download.
+func sendExport(ctx *gin.Context, user *User) {
+	export, err := exportData(ctx.Request.Context(), database.BunDB, user)
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not export data")
+		return
+	}
+	audit.Log(ctx.Request.Context(), database.BunDB, audit.New(ctx, "user.export", "user", user.ID))
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="homebuzz-data-%d.json"`, user.ID))
+	ctx.IndentedJSON(http.StatusOK, export)
+}
+
+// @Summary Download my data
+// @Description Download everything kept about the current user as a JSON file: profile, addresses, orders, subscriptions, wishlists, cart, notifications, linked accounts, API keys, authorized apps and audit log entries.
+// @Tags Profile
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} DataExport
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Could not export data"
+// @Router /me/export [get]
+func ExportMyData(ctx *gin.Context) {
+	user, ok := currentUser(ctx)
+	if !ok {
+		return
+	}
+	sendExport(ctx, user)
+}
+
+// @Summary Export a user's data
+// @Description Download everything kept about a user as a JSON file, to answer a data subject access request. Deleted accounts can be exported until they are erased.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} DataExport
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 500 {object} problem.Problem "Could not export data"
+// @Router /users/{id}/export [get]
+func ExportUserData(ctx *gin.Context) {
+	user := new(User)
+	err := database.BunDB.NewSelect().
+		Model(user).
+		Where("id = ?", ctx.Param("id")).
+		WhereAllWithDeleted().
+		Scan(ctx.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not export data")
+		return
+	}
+	sendExport(ctx, user)
+}
+
+// @Summary Erase a user
+// @Description Erase a user's personal data now, to answer a request for erasure, instead of waiting for ACCOUNT_DELETION_DAYS and DELETED_RETENTION_DAYS. Accounts without orders are deleted. Accounts with orders are anonymized: the orders are kept for accounting with only the country and region of their shipping address, and everything else about the user is removed. The append-only audit log is kept as it is, it records personal data only as having changed.
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} ErasureResponse
+// @Failure 400 {object} problem.Problem "You can't do this to your own account"
+// @Failure 404 {object} problem.Problem "User not found"
+// @Failure 409 {object} problem.Problem "User is already erased"
+// @Failure 500 {object} problem.Problem "Failed to erase user"
+// @Router /users/{id}/erase [post]
+func EraseUser(ctx *gin.Context) {
+	var kept bool
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		user := new(User)
+		err := tx.NewSelect().
+			Model(user).
+			Where("id = ?", ctx.Param("id")).
+			WhereAllWithDeleted().
+			For("UPDATE").
+			Scan(c)
+		if err != nil {
+			return err
+		}
+		if user.ID == auth.CurrentClaims(ctx).UserID {
+			return errOwnAccount
+		}
+		if user.AnonymizedAt != nil {
+			return errAlreadyErased
+		}
+
+		// closeAccount only works on deleted accounts.
+		if user.DeletedAt.IsZero() {
+			if _, err := tx.NewDelete().Model(user).WherePK().Exec(c); err != nil {
+				return err
+			}
+		}
+		kept, err = closeAccount(c, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		action := "user.purge"
+		if kept {
+			action = "user.anonymize"
+		}
+		return audit.Record(c, tx, audit.New(ctx, action, "user", user.ID))
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+	case errors.Is(err, errOwnAccount):
+		problem.Abort(ctx, http.StatusBadRequest, "You can't do this to your own account")
+	case errors.Is(err, errAlreadyErased):
+		problem.Abort(ctx, http.StatusConflict, "User is already erased")
+	case err != nil:
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to erase user")
+	case kept:
+		ctx.JSON(http.StatusOK, ErasureResponse{Message: "Personal data erased, orders kept", Kept: true})
+	default:
+		ctx.JSON(http.StatusOK, ErasureResponse{Message: "User deleted"})
+	}
+}
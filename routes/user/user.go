@@ -2,168 +2,397 @@ package routes
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
 	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// User is the persistence model of an account. It never goes over the wire;
+// requests bind to the types in dto.go and responses use UserResponse.
 type User struct {
-	ID       int64  `bun:",pk,autoincrement"`
-	Username string `bun:"username,unique,notnull" json:"username" binding:"required" example:"johndoe"`
-	Password string `bun:"password,notnull" json:"password" binding:"required" example:"password123"`
+	ID              int64      `bun:",pk,autoincrement" json:"-"`
+	Username        string     `bun:"username,unique,notnull" json:"-"`
+	Password        string     `bun:"password,notnull" json:"-"`
+	Role            string     `bun:"role,notnull,default:'customer'" json:"-"`
+	Email           *string    `bun:"email,unique" json:"-"`
+	EmailVerifiedAt *time.Time `bun:"email_verified_at" json:"-"`
+	TOTPSecret      *string    `bun:"totp_secret" json:"-"`
+	TOTPEnabledAt   *time.Time `bun:"totp_enabled_at" json:"-"`
+	TOTPLastStep    int64      `bun:"totp_last_step,notnull,default:0" json:"-"`
+	SessionVersion  int        `bun:"session_version,notnull,default:0" json:"-"`
+	ServiceAccount  bool       `bun:"service_account,notnull,default:false" json:"-"`
+	DisplayName     *string    `bun:"display_name" json:"-"`
+	Phone           *string    `bun:"phone" json:"-"`
+	AvatarURL       *string    `bun:"avatar_url" json:"-"`
+	// DeletionScheduledAt is when an account its owner asked to delete is
+	// deleted, unless they sign in again before then.
+	DeletionScheduledAt *time.Time `bun:"deletion_scheduled_at" json:"-"`
+	// DeletedAt soft deletes the account: bun leaves it out of every query
+	// unless asked otherwise, and PurgeDeletedAccounts closes it for good
+	// after DELETED_RETENTION_DAYS.
+	DeletedAt time.Time `bun:",soft_delete,nullzero" json:"-"`
+	// AnonymizedAt is when a closed account that had to be kept was stripped
+	// of its personal data.
+	AnonymizedAt *time.Time `bun:"anonymized_at" json:"-"`
+	// DisabledAt is set while an admin has disabled the account. Disabled
+	// accounts can't sign in and their tokens and API keys stop working.
+	DisabledAt *time.Time `bun:"disabled_at" json:"-"`
+	// PasswordResetRequired stops sign-in with the password until it is
+	// reset.
+	PasswordResetRequired bool       `bun:"password_reset_required,notnull,default:false" json:"-"`
+	CreatedAt             time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"-"`
+	SignupIP              *string    `bun:"signup_ip" json:"-"`
+	SignupUserAgent       *string    `bun:"signup_user_agent" json:"-"`
+	LastLoginAt           *time.Time `bun:"last_login_at" json:"-"`
+	LastLoginIP           *string    `bun:"last_login_ip" json:"-"`
 }
 
 type SuccessResponse struct {
 	Message string `json:"message" example:"User successfully created"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error" example:"Invalid input"`
+// PasswordPolicy is enforced on every new password. It is set up in main.
+var PasswordPolicy auth.PasswordPolicy
+
+// validatePassword aborts the request with the policy violations, if any,
+// reported against the request field holding the password.
+func validatePassword(ctx *gin.Context, field, password, username string) bool {
+	problems := PasswordPolicy.Validate(password, username)
+	if len(problems) > 0 {
+		abortWeakPassword(ctx, field, problems)
+		return false
+	}
+	return true
 }
 
-var jwtKey = []byte("your_secret_key")
+// abortWeakPassword ends the request with each policy violation as an error
+// on field.
+func abortWeakPassword(ctx *gin.Context, field string, problems []string) {
+	fields := make([]problem.FieldError, 0, len(problems))
+	for _, violation := range problems {
+		fields = append(fields, problem.FieldError{Field: field, Rule: "password_policy", Message: violation})
+	}
+	problem.AbortWithFields(ctx, http.StatusBadRequest, problem.CodeWeakPassword, "Password is too weak", fields)
+}
 
-type Claims struct {
-	Username string `json:"username"`
-	jwt.RegisteredClaims
+// recordSignup notes where a new account is being created from.
+func recordSignup(ctx *gin.Context, user *User) {
+	ip := ctx.ClientIP()
+	user.SignupIP = &ip
+	if userAgent := ctx.Request.UserAgent(); userAgent != "" {
+		user.SignupUserAgent = &userAgent
+	}
 }
 
 // @Summary Register a new user
-// @Description Register a new user by providing username and password
+// @Description Register a new user by providing username, password and email address. A verification link is sent to the email address.
 // @Tags Auth
 // @Accept  json
 // @Produce  json
-// @Param user body User true "User credentials"
+// @Param user body RegisterRequest true "User credentials"
 // @Success 200 {object} SuccessResponse "User successfully created"
-// @Failure 400 {object} ErrorResponse "Invalid input"
-// @Failure 409 {object} ErrorResponse "User already exists"
-// @Failure 500 {object} ErrorResponse "Failed to create user"
+// @Failure 400 {object} problem.Problem "Invalid input or password too weak"
+// @Failure 409 {object} problem.Problem "User already exists"
+// @Failure 500 {object} problem.Problem "Failed to create user"
 // @Router /register [post]
 func Register(ctx *gin.Context) {
-	var user User
+	var request RegisterRequest
 
-	if err := ctx.ShouldBindJSON(&user); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid input"})
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
 		return
 	}
 
+	email := strings.ToLower(strings.TrimSpace(request.Email))
+	user := User{Username: request.Username, Email: &email}
+	recordSignup(ctx, &user)
+
 	existingUser := new(User)
 	err := database.BunDB.NewSelect().
 		Model(existingUser).
-		Where("username = ?", user.Username).
-		Scan(context.Background())
+		Where("username = ? OR email = ?", user.Username, user.Email).
+		WhereAllWithDeleted().
+		Scan(ctx.Request.Context())
 	if err == nil {
-		ctx.AbortWithStatusJSON(http.StatusConflict, ErrorResponse{Error: "User already exists"})
+		problem.AbortWithCode(ctx, http.StatusConflict, problem.CodeAlreadyExists, "User already exists")
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if !validatePassword(ctx, "password", request.Password, user.Username) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(request.Password)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to encrypt password"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to encrypt password")
 		return
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
+	user.Role = auth.RoleCustomer
 
-	_, err = database.BunDB.NewInsert().Model(&user).Exec(context.Background())
+	err = database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(&user).Exec(c); err != nil {
+			return err
+		}
+		entry := audit.New(ctx, "user.register", "user", user.ID).By(user.ID).Diff(nil, NewUserResponse(&user)).Redact(personalFields...)
+		return audit.Record(c, tx, entry)
+	})
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create user"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 
+	if err := sendVerification(ctx.Request.Context(), database.BunDB, &user); err != nil {
+		fmt.Printf("Verification email for user %d failed: %v\n", user.ID, err)
+	}
+
 	ctx.JSON(http.StatusOK, SuccessResponse{Message: "User successfully created"})
 }
 
 // @Summary Login user
-// @Description Authenticate a user and return a JWT token.
+// @Description Authenticate a user and return a JWT token. Accounts with two-factor authentication get an mfa_token instead, to be completed at /login/mfa. After LOGIN_MAX_ATTEMPTS failures in a row an account is locked, and after LOGIN_IP_MAX_ATTEMPTS a client IP address, for a period that doubles with every further failure.
 // @Tags Auth
 // @Accept  json
 // @Produce  json
-// @Param credentials body User true "User credentials"
+// @Param credentials body LoginRequest true "User credentials"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem "Account disabled, or password reset required"
+// @Failure 429 {object} problem.Problem "Too many failed login attempts"
+// @Failure 500 {object} problem.Problem
 // @Router /login [post]
 func Login(ctx *gin.Context) {
-	var credentials User
+	var credentials LoginRequest
 
 	if err := ctx.ShouldBindJSON(&credentials); err != nil {
-		ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	until, err := lockedUntil(ctx.Request.Context(), database.BunDB, accountKey(credentials.Username), ipKey(ctx.ClientIP()))
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to check login attempts")
+		return
+	}
+	if until != nil {
+		abortLocked(ctx, *until)
 		return
 	}
 
 	storedUser := new(User)
-	err := database.BunDB.NewSelect().
+	err = database.BunDB.NewSelect().
 		Model(storedUser).
 		Where("username = ?", credentials.Username).
-		Scan(context.Background())
+		Scan(ctx.Request.Context())
+	if errors.Is(err, sql.ErrNoRows) {
+		compareDummy(credentials.Password)
+		loginFailed(ctx, credentials.Username, 0)
+		problem.Abort(ctx, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to log in")
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(credentials.Password))
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		loginFailed(ctx, credentials.Username, storedUser.ID)
+		problem.Abort(ctx, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	if storedUser.PasswordResetRequired {
+		problem.Abort(ctx, http.StatusForbidden, "Password reset required. Use the link sent to your email address or request a new one.")
 		return
 	}
 
+	// Hashes made with an older, cheaper cost are upgraded while we have the
+	// plain password.
+	if auth.NeedsRehash(storedUser.Password) {
+		if err := rehashPassword(ctx, storedUser, credentials.Password); err != nil {
+			fmt.Printf("Upgrading password hash of user %d failed: %v\n", storedUser.ID, err)
+		}
+	}
+
+	// With two-factor authentication the password only earns a challenge
+	// token, exchanged for an access token at /login/mfa.
+	if storedUser.TOTPEnabledAt != nil {
+		mfaChallenge(ctx, storedUser)
+		return
+	}
+
+	loginSucceeded(ctx, storedUser)
+	issueToken(ctx, storedUser)
+}
+
+// rehashPassword stores the user's password hashed with the current cost.
+func rehashPassword(ctx *gin.Context, user *User, password string) error {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("password = ?", hashedPassword).
+			Where("id = ?", user.ID).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.password_rehash", "user", user.ID).By(user.ID))
+	})
+}
+
+// newAccessToken returns a 24 hour access token for the user.
+func newAccessToken(user *User) (string, error) {
 	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: credentials.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	return auth.GenerateToken(user.ID, user.Username, user.Role, user.SessionVersion, expirationTime)
+}
+
+// issueToken responds with a new access token for the user and records the
+// login. Signing in cancels a pending deletion of the account.
+func issueToken(ctx *gin.Context, user *User) {
+	if user.DisabledAt != nil {
+		problem.AbortWithCode(ctx, http.StatusForbidden, problem.CodeAccountDisabled, "Account disabled")
+		return
+	}
+
+	message := "Login successful"
+	entry := audit.New(ctx, "user.login", "user", user.ID).By(user.ID)
+	if user.DeletionScheduledAt != nil {
+		message = "Login successful, account deletion cancelled"
+		entry = entry.Diff(gin.H{"deletion_scheduled_at": user.DeletionScheduledAt}, gin.H{"deletion_scheduled_at": nil})
+	}
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		update := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("last_login_at = ?", time.Now()).
+			Set("last_login_ip = ?", ctx.ClientIP()).
+			Where("id = ?", user.ID)
+		if user.DeletionScheduledAt != nil {
+			update.Set("deletion_scheduled_at = NULL")
+		}
+		if _, err := update.Exec(c); err != nil {
+			return err
+		}
+		return audit.Record(c, tx, entry)
+	})
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	tokenString, err := newAccessToken(user)
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{
-		"message":  "Login successful",
-		"username": credentials.Username,
+		"message":  message,
+		"username": user.Username,
 		"token":    tokenString,
 	})
 }
 
-// @Summary Get all users
-// @Description Retrieve a list of all users in the system
+// @Summary Search users
+// @Description Search and page through users. q matches the username, email address or display name.
 // @Tags Users
-// @Accept  json
 // @Produce  json
-// @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Security BearerAuth
+// @Param q query string false "Search text"
+// @Param role query string false "Role" Enums(customer, staff, admin)
+// @Param status query string false "Account status" Enums(active, disabled, unverified, pending_deletion)
+// @Param sort query string false "Sort order, prefix with - for descending" Enums(created_at, -created_at, username, -username, last_login_at, -last_login_at) default(-created_at)
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Users per page, at most 100" default(20)
+// @Success 200 {object} AdminUsersResponse
+// @Failure 400 {object} problem.Problem "Invalid filter"
+// @Failure 500 {object} problem.Problem "Couldn't fetch users"
 // @Router /users [get]
 func GetUsers(ctx *gin.Context) {
+	page, perPage, ok := pagination(ctx)
+	if !ok {
+		return
+	}
+
 	var users []User
+	query := database.BunDB.NewSelect().Model(&users)
 
-	err := database.BunDB.NewSelect().
-		Model(&users).
-		Scan(context.Background())
+	if q := strings.TrimSpace(ctx.Query("q")); q != "" {
+		pattern := "%" + likeEscaper.Replace(q) + "%"
+		query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("username ILIKE ?", pattern).
+				WhereOr("email ILIKE ?", pattern).
+				WhereOr("display_name ILIKE ?", pattern)
+		})
+	}
+	if role := ctx.Query("role"); role != "" {
+		query.Where("role = ?", role)
+	}
+	switch ctx.Query("status") {
+	case "":
+	case "active":
+		query.Where("disabled_at IS NULL")
+	case "disabled":
+		query.Where("disabled_at IS NOT NULL")
+	case "unverified":
+		query.Where("email_verified_at IS NULL")
+	case "pending_deletion":
+		query.Where("deletion_scheduled_at IS NOT NULL")
+	default:
+		problem.Abort(ctx, http.StatusBadRequest, "Unknown status")
+		return
+	}
+
+	column, descending := strings.CutPrefix(ctx.DefaultQuery("sort", "-created_at"), "-")
+	if !slices.Contains(userSortColumns, column) {
+		problem.Abort(ctx, http.StatusBadRequest, "Unknown sort order")
+		return
+	}
+	if descending {
+		query.OrderExpr("? DESC NULLS LAST", bun.Ident(column))
+	} else {
+		query.OrderExpr("? ASC NULLS LAST", bun.Ident(column))
+	}
+
+	total, err := query.
+		Order("id ASC").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		ScanAndCount(ctx.Request.Context())
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Couldn't fetch users"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch users")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"users": users})
+	ctx.JSON(http.StatusOK, AdminUsersResponse{Users: NewAdminUserResponses(users), Page: page, PerPage: perPage, Total: total})
 }
 
 // @Summary Get a specific user by ID
-// @Description Retrieve a single user by their ID
+// @Description Retrieve a single user by their ID, with the account's status and sign-in metadata
 // @Tags Users
 // @Accept  json
 // @Produce  json
+// @Security BearerAuth
 // @Param id path int64 true "User ID"
-// @Success 200 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Success 200 {object} map[string]AdminUserResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /users/{id} [get]
 func GetUser(ctx *gin.Context) {
 	id := ctx.Param("id")
@@ -172,42 +401,115 @@ func GetUser(ctx *gin.Context) {
 	err := database.BunDB.NewSelect().
 		Model(user).
 		Where("id = ?", id).
-		Scan(context.Background())
+		Scan(ctx.Request.Context())
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"user": user})
+	ctx.JSON(http.StatusOK, gin.H{"user": NewAdminUserResponse(user)})
 }
 
 // @Summary Delete a user by ID
-// @Description Delete a user from the system by their ID
+// @Description Soft delete a user. The account is signed out and hidden, can be restored by an admin, and is closed for good after DELETED_RETENTION_DAYS.
 // @Tags Users
 // @Accept  json
 // @Produce  json
+// @Security BearerAuth
 // @Param id path int64 true "User ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /users/{id} [delete]
 func DeleteUser(ctx *gin.Context) {
 	id := ctx.Param("id")
 
-	result, err := database.BunDB.NewDelete().
-		Model((*User)(nil)).
-		Where("id = ?", id).
-		Exec(context.Background())
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*User)(nil)).
+			Where("id = ?", id).
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.delete", "user", id))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "User not found")
+		return
+	}
 	if err != nil {
-		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	ctx.JSON(http.StatusOK, gin.H{"message": "User successfully deleted"})
+}
+
+// @Summary Get deleted users
+// @Description Retrieve the soft deleted users that can still be restored, most recently deleted first
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} UsersResponse
+// @Failure 500 {object} problem.Problem "Couldn't fetch users"
+// @Router /users/deleted [get]
+func GetDeletedUsers(ctx *gin.Context) {
+	var users []User
+
+	err := database.BunDB.NewSelect().
+		Model(&users).
+		WhereDeleted().
+		Where("anonymized_at IS NULL").
+		Order("deleted_at DESC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch users")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "User successfully deleted"})
+	ctx.JSON(http.StatusOK, UsersResponse{Users: NewUserResponses(users)})
+}
+
+// @Summary Restore a deleted user
+// @Description Bring back a soft deleted user, including one deleted at their own request, unless the account has already been closed for good
+// @Tags Users
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "User ID"
+// @Success 200 {object} SuccessResponse "User restored"
+// @Failure 404 {object} problem.Problem "Deleted user not found"
+// @Failure 500 {object} problem.Problem "Failed to restore user"
+// @Router /users/{id}/restore [post]
+func RestoreUser(ctx *gin.Context) {
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		result, err := tx.NewUpdate().
+			Model((*User)(nil)).
+			Set("deleted_at = NULL").
+			Set("deletion_scheduled_at = NULL").
+			Where("id = ?", ctx.Param("id")).
+			Where("anonymized_at IS NULL").
+			WhereDeleted().
+			Exec(c)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return audit.Record(c, tx, audit.New(ctx, "user.restore", "user", ctx.Param("id")))
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "Deleted user not found")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to restore user")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "User restored"})
 }
@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/audit"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// postJSON sends body to target on router.
+func postJSON(router *gin.Engine, target, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// newUser stores a user with a unique username and the password hashed at
+// cost.
+func newUser(t *testing.T, password string, cost int) *User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Username: "user" + strconv.FormatInt(time.Now().UnixNano(), 36), Password: string(hash), Role: auth.RoleCustomer}
+	if _, err := database.BunDB.NewInsert().Model(user).Returning("*").Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestLoginUpgradesPasswordHash(t *testing.T) {
+	testDB(t)
+	gin.SetMode(gin.TestMode)
+	t.Setenv("BCRYPT_COST", "5")
+	ctx := context.Background()
+
+	router := gin.New()
+	router.POST("/login", Login)
+	user := newUser(t, "correct horse", 4)
+
+	body := `{"username":"` + user.Username + `","password":"correct horse"}`
+	if response := postJSON(router, "/login", body); response.Code != http.StatusOK {
+		t.Fatalf("login = %d %s, want 200", response.Code, response.Body)
+	}
+
+	stored := new(User)
+	if err := database.BunDB.NewSelect().Model(stored).Where("id = ?", user.ID).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(stored.Password)); cost != 5 {
+		t.Errorf("stored hash cost = %d, want 5", cost)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.Password), []byte("correct horse")) != nil {
+		t.Error("the upgraded hash doesn't match the password")
+	}
+	recorded, err := database.BunDB.NewSelect().
+		Model((*audit.Entry)(nil)).
+		Where("action = ?", "user.password_rehash").
+		Where("target_id = ?", strconv.FormatInt(user.ID, 10)).
+		Exists(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recorded {
+		t.Error("the upgrade wasn't audited")
+	}
+
+	// A hash of the configured cost is left alone.
+	if response := postJSON(router, "/login", body); response.Code != http.StatusOK {
+		t.Fatalf("second login = %d %s, want 200", response.Code, response.Body)
+	}
+	again := new(User)
+	if err := database.BunDB.NewSelect().Model(again).Where("id = ?", user.ID).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again.Password != stored.Password {
+		t.Error("a current hash was replaced")
+	}
+
+	// A wrong password doesn't upgrade anything.
+	t.Setenv("BCRYPT_COST", "6")
+	if response := postJSON(router, "/login", `{"username":"`+user.Username+`","password":"wrong"}`); response.Code != http.StatusUnauthorized {
+		t.Fatalf("login with a wrong password = %d %s, want 401", response.Code, response.Body)
+	}
+	if err := database.BunDB.NewSelect().Model(again).Where("id = ?", user.ID).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if again.Password != stored.Password {
+		t.Error("a wrong password upgraded the hash")
+	}
+}
+
+func TestRegisterRequiresEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/register", Register)
+
+	tests := []struct {
+		body string
+		rule string
+	}{
+		{`{"username":"ada","password":"correct horse battery staple"}`, "required"},
+		{`{"username":"ada","password":"correct horse battery staple","email":""}`, "required"},
+		{`{"username":"ada","password":"correct horse battery staple","email":"ada"}`, "email"},
+	}
+	for _, test := range tests {
+		response := postJSON(router, "/register", test.body)
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("register %s = %d %s, want 400", test.body, response.Code, response.Body)
+		}
+		var body problem.Problem
+		if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Errors) != 1 || body.Errors[0].Field != "email" || body.Errors[0].Rule != test.rule {
+			t.Errorf("register %s errors = %+v, want email %s", test.body, body.Errors, test.rule)
+		}
+	}
+}
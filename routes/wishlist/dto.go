@@ -0,0 +1,67 @@
+package routes
+
+import "github.com/in43sh/homebuzz-backend/wishlist"
+
+type ListRequest struct {
+	Name string `json:"name" binding:"required,max=100" example:"Weekly shop"`
+	Kind string `json:"kind" binding:"omitempty,oneof=favorites shopping" example:"shopping"`
+}
+
+// List maps the request to a new List of userID. The kind defaults to
+// favorites.
+func (r *ListRequest) List(userID int64) wishlist.List {
+	list := wishlist.List{UserID: userID, Name: r.Name, Kind: r.Kind}
+	if list.Kind == "" {
+		list.Kind = wishlist.KindFavorites
+	}
+	return list
+}
+
+type ListItemRequest struct {
+	ProductID int64  `json:"product_id" binding:"required" example:"1"`
+	Quantity  int    `json:"quantity" binding:"omitempty,gte=1" example:"2"`
+	Note      string `json:"note" binding:"max=500" example:"Organic if possible"`
+}
+
+// ListItem maps the request to a new ListItem of listID. The quantity
+// defaults to 1.
+func (r *ListItemRequest) ListItem(listID int64) wishlist.ListItem {
+	item := wishlist.ListItem{ListID: listID, ProductID: r.ProductID, Quantity: r.Quantity, Note: r.Note}
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	return item
+}
+
+// SharedListResponse is what anyone with a share link sees of a List. It
+// leaves out the owner and the share token.
+type SharedListResponse struct {
+	Name  string                   `json:"name" example:"Weekly shop"`
+	Items []SharedListItemResponse `json:"items"`
+}
+
+type SharedListItemResponse struct {
+	ProductID int64  `json:"product_id" example:"1"`
+	Quantity  int    `json:"quantity" example:"2"`
+	Note      string `json:"note" example:"Organic if possible"`
+}
+
+// MoveToCartResponse reports which products went to the cart. Skipped
+// products are no longer sold by the store and stay on the list.
+type MoveToCartResponse struct {
+	Moved   []int64 `json:"moved" example:"1"`
+	Skipped []int64 `json:"skipped" example:"7"`
+}
+
+// NewSharedListResponse maps a List to its shared view.
+func NewSharedListResponse(list *wishlist.List) SharedListResponse {
+	response := SharedListResponse{Name: list.Name, Items: make([]SharedListItemResponse, 0, len(list.Items))}
+	for _, item := range list.Items {
+		response.Items = append(response.Items, SharedListItemResponse{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Note:      item.Note,
+		})
+	}
+	return response
+}
@@ -0,0 +1,453 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/database"
+	"github.com/in43sh/homebuzz-backend/problem"
+	cartRoutes "github.com/in43sh/homebuzz-backend/routes/cart"
+	productRoutes "github.com/in43sh/homebuzz-backend/routes/product"
+	"github.com/in43sh/homebuzz-backend/store"
+	"github.com/in43sh/homebuzz-backend/wishlist"
+	"github.com/uptrace/bun"
+)
+
+// SuccessResponse for consistent success responses
+type SuccessResponse struct {
+	Message string `json:"message" example:"List deleted successfully!"`
+}
+
+var (
+	errEmptyList   = errors.New("list is empty")
+	errUnavailable = errors.New("no list item is available")
+)
+
+type ShareResponse struct {
+	Token string `json:"token" example:"q3Jx0lWc6bS0m2kq9vXo1Q"`
+	Path  string `json:"path" example:"/shared-lists/q3Jx0lWc6bS0m2kq9vXo1Q"`
+}
+
+// findList loads one of the user's lists, optionally with its items.
+func findList(ctx context.Context, db bun.IDB, userID int64, listID string, withItems bool) (*wishlist.List, error) {
+	list := new(wishlist.List)
+	query := db.NewSelect().
+		Model(list).
+		Where("list.id = ?", listID).
+		Where("list.user_id = ?", userID)
+	if withItems {
+		query = query.Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("list_item.id ASC")
+		})
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// shareToken returns a random, unguessable token for a share link.
+func shareToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// @Summary Get the current user's lists
+// @Description Retrieve every wishlist and shopping list of the current user, without their items
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Lists"
+// @Failure 500 {object} problem.Problem "Couldn't fetch lists"
+// @Router /lists [get]
+func GetLists(ctx *gin.Context) {
+	var lists []wishlist.List
+
+	err := database.BunDB.NewSelect().
+		Model(&lists).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Order("id ASC").
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Couldn't fetch lists")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"lists": lists})
+}
+
+// @Summary Create a list
+// @Description Create a named favorites or shopping list for the current user
+// @Tags Lists
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param list body ListRequest true "List"
+// @Success 201 {object} wishlist.List
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 500 {object} problem.Problem "Could not create list"
+// @Router /lists [post]
+func CreateList(ctx *gin.Context) {
+	var request ListRequest
+
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+	list := request.List(auth.CurrentClaims(ctx).UserID)
+
+	_, err := database.BunDB.NewInsert().Model(&list).Returning("*").Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not create list")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, list)
+}
+
+// @Summary Get a list by ID
+// @Description Retrieve one of the current user's lists with its items
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Success 200 {object} wishlist.List
+// @Failure 404 {object} problem.Problem "List not found"
+// @Router /lists/{id} [get]
+func GetList(ctx *gin.Context) {
+	list, err := findList(ctx.Request.Context(), database.BunDB, auth.CurrentClaims(ctx).UserID, ctx.Param("id"), true)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, list)
+}
+
+// @Summary Delete a list by ID
+// @Description Delete one of the current user's lists and all of its items
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Success 200 {object} SuccessResponse "List deleted successfully!"
+// @Failure 404 {object} problem.Problem "List not found"
+// @Failure 500 {object} problem.Problem "Failed to delete list"
+// @Router /lists/{id} [delete]
+func DeleteList(ctx *gin.Context) {
+	result, err := database.BunDB.NewDelete().
+		Model((*wishlist.List)(nil)).
+		Where("id = ?", ctx.Param("id")).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to delete list")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "List deleted successfully!"})
+}
+
+// @Summary Save a product to a list
+// @Description Add a product to one of the current user's lists, replacing its quantity and note if it is already there
+// @Tags Lists
+// @Accept  json
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Param item body ListItemRequest true "Product, quantity and note"
+// @Success 200 {object} wishlist.ListItem
+// @Failure 400 {object} problem.Problem "Invalid input"
+// @Failure 404 {object} problem.Problem "List or product not found"
+// @Failure 500 {object} problem.Problem "Could not update list"
+// @Router /lists/{id}/items [post]
+func AddListItem(ctx *gin.Context) {
+	var request ListItemRequest
+
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		problem.Invalid(ctx, err)
+		return
+	}
+
+	list, err := findList(ctx.Request.Context(), database.BunDB, auth.CurrentClaims(ctx).UserID, ctx.Param("id"), false)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	exists, err := database.BunDB.NewSelect().
+		Model((*productRoutes.Product)(nil)).
+		Where("id = ?", request.ProductID).
+		Where("store_id = ?", store.ID(ctx)).
+		Exists(ctx.Request.Context())
+	if err != nil || !exists {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	item := request.ListItem(list.ID)
+	_, err = database.BunDB.NewInsert().
+		Model(&item).
+		On("CONFLICT (list_id, product_id) DO UPDATE").
+		Set("quantity = EXCLUDED.quantity").
+		Set("note = EXCLUDED.note").
+		Returning("*").
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not update list")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, item)
+}
+
+// @Summary Remove a product from a list
+// @Description Remove a saved product from one of the current user's lists
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Param product_id path int64 true "Product ID"
+// @Success 200 {object} SuccessResponse "Item removed from list"
+// @Failure 404 {object} problem.Problem "Item not in list"
+// @Failure 500 {object} problem.Problem "Failed to remove item"
+// @Router /lists/{id}/items/{product_id} [delete]
+func RemoveListItem(ctx *gin.Context) {
+	list, err := findList(ctx.Request.Context(), database.BunDB, auth.CurrentClaims(ctx).UserID, ctx.Param("id"), false)
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	result, err := database.BunDB.NewDelete().
+		Model((*wishlist.ListItem)(nil)).
+		Where("list_id = ?", list.ID).
+		Where("product_id = ?", ctx.Param("product_id")).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Failed to remove item")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "Item not in list")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "Item removed from list"})
+}
+
+// @Summary Share a list
+// @Description Create a share link for one of the current user's lists. Anyone with the link can view the list. Sharing again replaces the previous link.
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Success 200 {object} ShareResponse
+// @Failure 404 {object} problem.Problem "List not found"
+// @Failure 500 {object} problem.Problem "Could not share list"
+// @Router /lists/{id}/share [post]
+func ShareList(ctx *gin.Context) {
+	token, err := shareToken()
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not share list")
+		return
+	}
+
+	result, err := database.BunDB.NewUpdate().
+		Model((*wishlist.List)(nil)).
+		Set("share_token = ?", token).
+		Where("id = ?", ctx.Param("id")).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not share list")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ShareResponse{Token: token, Path: "/shared-lists/" + token})
+}
+
+// @Summary Stop sharing a list
+// @Description Revoke the share link of one of the current user's lists
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Success 200 {object} SuccessResponse "List is no longer shared"
+// @Failure 404 {object} problem.Problem "List not found"
+// @Failure 500 {object} problem.Problem "Could not unshare list"
+// @Router /lists/{id}/share [delete]
+func UnshareList(ctx *gin.Context) {
+	result, err := database.BunDB.NewUpdate().
+		Model((*wishlist.List)(nil)).
+		Set("share_token = NULL").
+		Where("id = ?", ctx.Param("id")).
+		Where("user_id = ?", auth.CurrentClaims(ctx).UserID).
+		Exec(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not unshare list")
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, SuccessResponse{Message: "List is no longer shared"})
+}
+
+// @Summary Get a shared list
+// @Description Retrieve a list shared with a link, with its items
+// @Tags Lists
+// @Produce  json
+// @Param token path string true "Share token"
+// @Success 200 {object} SharedListResponse
+// @Failure 404 {object} problem.Problem "List not found"
+// @Router /shared-lists/{token} [get]
+func GetSharedList(ctx *gin.Context) {
+	list := new(wishlist.List)
+
+	err := database.BunDB.NewSelect().
+		Model(list).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("list_item.id ASC")
+		}).
+		Where("list.share_token = ?", ctx.Param("token")).
+		Scan(ctx.Request.Context())
+	if err != nil {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewSharedListResponse(list))
+}
+
+// availableProducts returns which of productIDs the store still sells.
+func availableProducts(ctx context.Context, db bun.IDB, storeID int64, productIDs []int64) (map[int64]bool, error) {
+	var ids []int64
+	err := db.NewSelect().
+		Model((*productRoutes.Product)(nil)).
+		Column("id").
+		Where("id IN (?)", bun.In(productIDs)).
+		Where("store_id = ?", storeID).
+		Scan(ctx, &ids)
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		available[id] = true
+	}
+	return available, nil
+}
+
+// @Summary Move a list to the cart
+// @Description Add the items of one of the current user's lists to the cart, adding to quantities already in the cart, and remove them from the list. Products the current store no longer sells are skipped and stay on the list.
+// @Tags Lists
+// @Produce  json
+// @Security BearerAuth
+// @Param id path int64 true "List ID"
+// @Success 200 {object} MoveToCartResponse
+// @Failure 404 {object} problem.Problem "List not found"
+// @Failure 409 {object} problem.Problem "List is empty or none of its items are available"
+// @Failure 500 {object} problem.Problem "Could not move items to cart"
+// @Router /lists/{id}/move-to-cart [post]
+func MoveListToCart(ctx *gin.Context) {
+	userID := auth.CurrentClaims(ctx).UserID
+	response := MoveToCartResponse{Moved: []int64{}, Skipped: []int64{}}
+
+	err := database.BunDB.RunInTx(ctx.Request.Context(), nil, func(c context.Context, tx bun.Tx) error {
+		list, err := findList(c, tx, userID, ctx.Param("id"), true)
+		if err != nil {
+			return err
+		}
+		if len(list.Items) == 0 {
+			return errEmptyList
+		}
+
+		productIDs := make([]int64, 0, len(list.Items))
+		for _, item := range list.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		available, err := availableProducts(c, tx, store.ID(ctx), productIDs)
+		if err != nil {
+			return err
+		}
+
+		cartItems := make([]cartRoutes.CartItem, 0, len(list.Items))
+		for _, item := range list.Items {
+			if !available[item.ProductID] {
+				response.Skipped = append(response.Skipped, item.ProductID)
+				continue
+			}
+			response.Moved = append(response.Moved, item.ProductID)
+			cartItems = append(cartItems, cartRoutes.CartItem{
+				UserID:    userID,
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+			})
+		}
+		if len(cartItems) == 0 {
+			return errUnavailable
+		}
+
+		_, err = tx.NewInsert().
+			Model(&cartItems).
+			On("CONFLICT (user_id, product_id) DO UPDATE").
+			Set("quantity = cart_item.quantity + EXCLUDED.quantity").
+			Exec(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*wishlist.ListItem)(nil)).
+			Where("list_id = ?", list.ID).
+			Where("product_id IN (?)", bun.In(response.Moved)).
+			Exec(c)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Abort(ctx, http.StatusNotFound, "List not found")
+		return
+	}
+	if errors.Is(err, errEmptyList) {
+		problem.Abort(ctx, http.StatusConflict, "List is empty")
+		return
+	}
+	if errors.Is(err, errUnavailable) {
+		problem.Abort(ctx, http.StatusConflict, "None of the items are available")
+		return
+	}
+	if err != nil {
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not move items to cart")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
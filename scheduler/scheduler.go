@@ -0,0 +1,28 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Every runs job once immediately and then on every tick of interval until
+// ctx is cancelled. Errors are logged and do not stop the schedule.
+func Every(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := job(ctx); err != nil {
+				fmt.Printf("Scheduled job %q failed: %v\n", name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
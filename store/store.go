@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/auth"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+)
+
+// Staff roles within a store. Platform admins, with auth.RoleAdmin, can act
+// in every store without being a member.
+const (
+	RoleStaff = "staff"
+	RoleAdmin = "admin"
+)
+
+// Header names the store a request is for, by slug, when the path doesn't.
+const Header = "X-Store"
+
+// pathPrefix starts paths that name the store, as in /store/{slug}/products.
+const pathPrefix = "/store/"
+
+const contextKey = "store"
+
+const errorKey = "storeError"
+
+// failure is why Resolve found no store, reported by Require.
+type failure struct {
+	status int
+	code   string
+	msg    string
+}
+
+type slugKey struct{}
+
+// Store is a shop run on the platform. Products, orders and subscriptions
+// belong to exactly one store, and staff are given roles per store.
+type Store struct {
+	bun.BaseModel `bun:"table:stores,alias:store" swaggerignore:"true"`
+
+	ID   int64  `bun:",pk,autoincrement" json:"id"`
+	Slug string `bun:"slug,notnull" json:"slug" example:"homebuzz"`
+	Name string `bun:"name,notnull" json:"name" example:"Homebuzz"`
+	// Host serves the store when requests don't name one, as in
+	// shop.example.com.
+	Host *string `bun:"host" json:"host" example:"shop.homebuzz.local"`
+	// CORSOrigins are the browser origins allowed to call the API for this
+	// store.
+	CORSOrigins []string `bun:"cors_origins,array" json:"cors_origins" example:"https://homebuzz.netlify.app"`
+	// IsDefault marks the store serving requests that don't name one and come
+	// from no store's host.
+	IsDefault bool      `bun:"is_default,notnull" json:"is_default"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// Member gives a user a role in a store.
+type Member struct {
+	bun.BaseModel `bun:"table:store_staff,alias:member" swaggerignore:"true"`
+
+	StoreID   int64     `bun:"store_id,pk" json:"store_id"`
+	UserID    int64     `bun:"user_id,pk" json:"user_id"`
+	Role      string    `bun:"role,notnull" json:"role" example:"staff"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// StripPrefix serves paths under /store/{slug} as if the prefix wasn't
+// there, keeping the slug for Resolve. It wraps the whole router, since gin
+// picks the route before any middleware runs.
+func StripPrefix(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, pathPrefix)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slug, path, _ := strings.Cut(rest, "/")
+		r = r.WithContext(context.WithValue(r.Context(), slugKey{}, slug))
+		r.URL.Path = "/" + path
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Resolve finds the store the request is for: the one named in the path,
+// then in the X-Store header, then the one served on the request's host, and
+// the default store otherwise. Naming a store that doesn't exist is a 404,
+// sent by Require so that CORS headers can be added to it first.
+func Resolve(db bun.IDB) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		slug, _ := ctx.Request.Context().Value(slugKey{}).(string)
+		if slug == "" {
+			slug = ctx.GetHeader(Header)
+		}
+
+		store := new(Store)
+		query := db.NewSelect().Model(store)
+		if slug != "" {
+			query.Where("slug = ?", slug)
+		} else {
+			query.WhereOr("host = ?", hostname(ctx.Request.Host)).
+				WhereOr("is_default").
+				OrderExpr("is_default ASC").
+				Limit(1)
+		}
+
+		err := query.Scan(ctx.Request.Context())
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			ctx.Set(errorKey, failure{status: http.StatusNotFound, code: problem.CodeStoreNotFound, msg: "Store not found"})
+		case err != nil:
+			ctx.Set(errorKey, failure{status: http.StatusInternalServerError, code: problem.CodeInternal, msg: "Could not find store"})
+		default:
+			ctx.Set(contextKey, store)
+		}
+		ctx.Next()
+	}
+}
+
+// Require rejects requests for which Resolve found no store. It must be used
+// after Resolve and the CORS middleware.
+func Require() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if value, ok := ctx.Get(errorKey); ok {
+			failure := value.(failure)
+			problem.AbortWithCode(ctx, failure.status, failure.code, failure.msg)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// hostname drops the port from a Host header and lowercases it.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// Current returns the store Resolve found for the request.
+func Current(ctx *gin.Context) *Store {
+	store, _ := ctx.MustGet(contextKey).(*Store)
+	return store
+}
+
+// ID returns the ID of the store Resolve found for the request.
+func ID(ctx *gin.Context) int64 {
+	return Current(ctx).ID
+}
+
+// AllowOrigin reports whether origin may call the API for the request's
+// store, for the CORS middleware. It must be used after Resolve.
+func AllowOrigin(ctx *gin.Context, origin string) bool {
+	store, ok := ctx.Get(contextKey)
+	return ok && slices.Contains(store.(*Store).CORSOrigins, origin)
+}
+
+// RequireRole rejects users without one of roles in the request's store.
+// Platform admins are let through in every store. It must be used after
+// RequireAuth and Resolve.
+func RequireRole(db bun.IDB, roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims := auth.CurrentClaims(ctx)
+		if claims == nil {
+			problem.Abort(ctx, http.StatusUnauthorized, "Missing authorization token")
+			return
+		}
+		if claims.Role == auth.RoleAdmin {
+			ctx.Next()
+			return
+		}
+
+		member, err := db.NewSelect().
+			Model((*Member)(nil)).
+			Where("store_id = ?", ID(ctx)).
+			Where("user_id = ?", claims.UserID).
+			Where("role IN (?)", bun.In(roles)).
+			Exists(ctx.Request.Context())
+		if err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Could not check permissions")
+			return
+		}
+		if !member {
+			problem.Abort(ctx, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		ctx.Next()
+	}
+}
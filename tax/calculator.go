@@ -0,0 +1,192 @@
+package tax
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// DBCalculator applies the tax rates configured in the database.
+type DBCalculator struct {
+	db     bun.IDB
+	config Config
+}
+
+func NewDBCalculator(db bun.IDB, config Config) *DBCalculator {
+	return &DBCalculator{db: db, config: config}
+}
+
+// Calculate looks up the rates of every line's tax class in the request's
+// jurisdiction (falling back to the configured default) and applies them.
+// Products without a tax class use the store's default class.
+func (c *DBCalculator) Calculate(ctx context.Context, request Request) (Result, error) {
+	jurisdiction := request.Jurisdiction
+	if jurisdiction.Country == "" {
+		jurisdiction = c.config.Jurisdiction
+	}
+	jurisdiction.Country = strings.ToUpper(jurisdiction.Country)
+
+	result := Result{Mode: c.config.Mode, Jurisdiction: jurisdiction, Lines: make([]LineTax, 0, len(request.Lines)), Breakdown: []Breakdown{}}
+	if jurisdiction.Country == "" {
+		for _, line := range request.Lines {
+			result.Lines = append(result.Lines, LineTax{ProductID: line.ProductID, Net: line.Amount, Gross: line.Amount})
+		}
+		return result, nil
+	}
+
+	defaultClass := new(TaxClass)
+	err := c.db.NewSelect().
+		Model(defaultClass).
+		Where("store_id = ?", request.StoreID).
+		Where("is_default = TRUE").
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		defaultClass = nil
+	}
+
+	var rates []TaxRate
+	err = c.db.NewSelect().
+		Model(&rates).
+		Where("tax_class_id IN (?)", c.db.NewSelect().Model((*TaxClass)(nil)).Column("id").Where("store_id = ?", request.StoreID)).
+		Where("country = ?", jurisdiction.Country).
+		Where("region = '' OR region = ?", jurisdiction.Region).
+		Order("region ASC", "id ASC").
+		Scan(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	ratesByClass := make(map[int64][]TaxRate)
+	for _, rate := range rates {
+		ratesByClass[rate.TaxClassID] = append(ratesByClass[rate.TaxClassID], rate)
+	}
+
+	return c.apply(result, request.Lines, ratesByClass, defaultClass), nil
+}
+
+// apply taxes lines with the rates of their tax class, or of defaultClass
+// when they have none, adding them to result.
+func (c *DBCalculator) apply(result Result, lines []Line, ratesByClass map[int64][]TaxRate, defaultClass *TaxClass) Result {
+	breakdownIndex := make(map[int64]int)
+	var unrounded []float64
+	lineTaxes := make([]float64, 0, len(lines))
+
+	for _, line := range lines {
+		var lineRates []TaxRate
+		switch {
+		case line.TaxClassID != nil:
+			lineRates = ratesByClass[*line.TaxClassID]
+		case defaultClass != nil:
+			lineRates = ratesByClass[defaultClass.ID]
+		}
+
+		combined := 0.0
+		for _, rate := range lineRates {
+			combined += rate.Rate
+		}
+
+		net := line.Amount
+		if c.config.Mode == ModeInclusive {
+			net = line.Amount / (1 + combined/100)
+		}
+
+		lineTax := 0.0
+		for _, rate := range lineRates {
+			amount := net * rate.Rate / 100
+			if c.config.Rounding == RoundPerLine {
+				amount = roundMoney(amount)
+			}
+			lineTax += amount
+
+			i, ok := breakdownIndex[rate.ID]
+			if !ok {
+				i = len(result.Breakdown)
+				breakdownIndex[rate.ID] = i
+				result.Breakdown = append(result.Breakdown, Breakdown{
+					Name:    rate.Name,
+					Country: rate.Country,
+					Region:  rate.Region,
+					Rate:    rate.Rate,
+				})
+				unrounded = append(unrounded, 0)
+			}
+			result.Breakdown[i].Taxable += net
+			unrounded[i] += amount
+		}
+
+		lineTaxes = append(lineTaxes, lineTax)
+	}
+
+	// Per line, every amount is already rounded. Per order, the total is
+	// rounded once and split back over the lines and rates, so they still
+	// add up to it.
+	total := 0.0
+	for _, amount := range unrounded {
+		total += amount
+	}
+	result.Total = roundMoney(total)
+	lineTaxes = allocate(lineTaxes, result.Total)
+	amounts := allocate(unrounded, result.Total)
+
+	for i, line := range lines {
+		lineTotal := LineTax{ProductID: line.ProductID, Tax: lineTaxes[i]}
+		if c.config.Mode == ModeInclusive {
+			lineTotal.Gross = roundMoney(line.Amount)
+			lineTotal.Net = roundMoney(line.Amount - lineTaxes[i])
+		} else {
+			lineTotal.Net = roundMoney(line.Amount)
+			lineTotal.Gross = roundMoney(line.Amount + lineTaxes[i])
+		}
+		result.Lines = append(result.Lines, lineTotal)
+	}
+	for i := range result.Breakdown {
+		result.Breakdown[i].Taxable = roundMoney(result.Breakdown[i].Taxable)
+		result.Breakdown[i].Amount = amounts[i]
+	}
+
+	return result
+}
+
+// allocate rounds amounts to cents so that they add up to total, giving the
+// cents lost or gained in rounding to the amounts with the largest
+// remainders.
+func allocate(amounts []float64, total float64) []float64 {
+	cents := make([]int64, len(amounts))
+	remainders := make([]float64, len(amounts))
+	left := int64(math.Round(total * 100))
+	for i, amount := range amounts {
+		exact := amount * 100
+		cents[i] = int64(math.Floor(exact + 1e-9))
+		remainders[i] = exact - float64(cents[i])
+		left -= cents[i]
+	}
+
+	order := make([]int, len(amounts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; left > 0 && len(order) > 0; i = (i + 1) % len(order) {
+		cents[order[i]]++
+		left--
+	}
+	for i := len(order) - 1; left < 0 && len(order) > 0; i = (i - 1 + len(order)) % len(order) {
+		cents[order[i]]--
+		left++
+	}
+
+	allocated := make([]float64, len(amounts))
+	for i, c := range cents {
+		allocated[i] = float64(c) / 100
+	}
+	return allocated
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
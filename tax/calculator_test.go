@@ -0,0 +1,175 @@
+package tax
+
+import (
+	"math"
+	"testing"
+)
+
+func class(id int64) *int64 {
+	return &id
+}
+
+var (
+	standard = &TaxClass{ID: 1, Name: "Standard", IsDefault: true}
+	rates    = map[int64][]TaxRate{
+		1: {{ID: 1, TaxClassID: 1, Name: "VAT", Country: "DE", Rate: 19}},
+		2: {{ID: 2, TaxClassID: 2, Name: "Reduced VAT", Country: "DE", Rate: 7}},
+		3: {
+			{ID: 3, TaxClassID: 3, Name: "State tax", Country: "US", Rate: 6},
+			{ID: 4, TaxClassID: 3, Name: "City tax", Country: "US", Region: "NY", Rate: 4.5},
+		},
+	}
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		rounding string
+		lines    []Line
+		// taxes are the taxes of the lines and amounts those of the rates.
+		taxes   []float64
+		amounts []float64
+		total   float64
+	}{
+		{
+			name:     "per line rounds every line",
+			mode:     ModeExclusive,
+			rounding: RoundPerLine,
+			lines:    []Line{{ProductID: 1, Amount: 0.99}, {ProductID: 2, Amount: 0.99}, {ProductID: 3, Amount: 0.99}},
+			taxes:    []float64{0.19, 0.19, 0.19},
+			amounts:  []float64{0.57},
+			total:    0.57,
+		},
+		{
+			name:     "per order rounds the sum once",
+			mode:     ModeExclusive,
+			rounding: RoundPerOrder,
+			lines:    []Line{{ProductID: 1, Amount: 0.99}, {ProductID: 2, Amount: 0.99}, {ProductID: 3, Amount: 0.99}},
+			taxes:    []float64{0.19, 0.19, 0.18},
+			amounts:  []float64{0.56},
+			total:    0.56,
+		},
+		{
+			name:     "inclusive per line",
+			mode:     ModeInclusive,
+			rounding: RoundPerLine,
+			lines:    []Line{{ProductID: 1, Amount: 0.99}, {ProductID: 2, Amount: 0.99}, {ProductID: 3, Amount: 0.99}},
+			taxes:    []float64{0.16, 0.16, 0.16},
+			amounts:  []float64{0.48},
+			total:    0.48,
+		},
+		{
+			name:     "inclusive per order",
+			mode:     ModeInclusive,
+			rounding: RoundPerOrder,
+			lines:    []Line{{ProductID: 1, Amount: 0.99}, {ProductID: 2, Amount: 0.99}, {ProductID: 3, Amount: 0.99}},
+			taxes:    []float64{0.16, 0.16, 0.15},
+			amounts:  []float64{0.47},
+			total:    0.47,
+		},
+		{
+			name:     "tax classes, with the default for lines without one",
+			mode:     ModeExclusive,
+			rounding: RoundPerLine,
+			lines:    []Line{{ProductID: 1, Amount: 10}, {ProductID: 2, TaxClassID: class(2), Amount: 10}, {ProductID: 3, TaxClassID: class(9), Amount: 10}},
+			taxes:    []float64{1.9, 0.7, 0},
+			amounts:  []float64{1.9, 0.7},
+			total:    2.6,
+		},
+		{
+			name:     "regional rates add up per line",
+			mode:     ModeExclusive,
+			rounding: RoundPerLine,
+			lines:    []Line{{ProductID: 1, TaxClassID: class(3), Amount: 0.7}, {ProductID: 2, TaxClassID: class(3), Amount: 0.7}},
+			taxes:    []float64{0.07, 0.07},
+			amounts:  []float64{0.08, 0.06},
+			total:    0.14,
+		},
+		{
+			name:     "regional rates add up per order",
+			mode:     ModeExclusive,
+			rounding: RoundPerOrder,
+			lines:    []Line{{ProductID: 1, TaxClassID: class(3), Amount: 0.7}, {ProductID: 2, TaxClassID: class(3), Amount: 0.7}},
+			taxes:    []float64{0.08, 0.07},
+			amounts:  []float64{0.09, 0.06},
+			total:    0.15,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calculator := NewDBCalculator(nil, Config{Mode: test.mode, Rounding: test.rounding})
+			result := calculator.apply(Result{Mode: test.mode}, test.lines, rates, standard)
+
+			if len(result.Lines) != len(test.lines) {
+				t.Fatalf("got %d lines, want %d", len(result.Lines), len(test.lines))
+			}
+			lineTaxes := 0.0
+			for i, line := range result.Lines {
+				if line.ProductID != test.lines[i].ProductID {
+					t.Errorf("line %d is product %d, want %d", i, line.ProductID, test.lines[i].ProductID)
+				}
+				if line.Tax != test.taxes[i] {
+					t.Errorf("line %d tax = %v, want %v", i, line.Tax, test.taxes[i])
+				}
+				if math.Abs(line.Gross-line.Net-line.Tax) > 1e-9 {
+					t.Errorf("line %d: gross %v - net %v isn't tax %v", i, line.Gross, line.Net, line.Tax)
+				}
+				amount := line.Net
+				if test.mode == ModeInclusive {
+					amount = line.Gross
+				}
+				if amount != test.lines[i].Amount {
+					t.Errorf("line %d amount = %v, want %v", i, amount, test.lines[i].Amount)
+				}
+				lineTaxes += line.Tax
+			}
+
+			if len(result.Breakdown) != len(test.amounts) {
+				t.Fatalf("breakdown = %+v, want amounts %v", result.Breakdown, test.amounts)
+			}
+			amounts := 0.0
+			for i, breakdown := range result.Breakdown {
+				if breakdown.Amount != test.amounts[i] {
+					t.Errorf("%s = %v, want %v", breakdown.Name, breakdown.Amount, test.amounts[i])
+				}
+				amounts += breakdown.Amount
+			}
+
+			if result.Total != test.total {
+				t.Errorf("total = %v, want %v", result.Total, test.total)
+			}
+			if roundMoney(lineTaxes) != result.Total || roundMoney(amounts) != result.Total {
+				t.Errorf("line taxes %v and breakdown %v don't add up to %v", lineTaxes, amounts, result.Total)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		amounts []float64
+		total   float64
+		want    []float64
+	}{
+		{[]float64{0.1881, 0.1881, 0.1881}, 0.56, []float64{0.19, 0.19, 0.18}},
+		{[]float64{0.19, 0.19, 0.19}, 0.57, []float64{0.19, 0.19, 0.19}},
+		{[]float64{0.004, 0.004, 0.004}, 0.01, []float64{0.01, 0, 0}},
+		{[]float64{0.001, 0.009}, 0.01, []float64{0, 0.01}},
+		{[]float64{}, 0, []float64{}},
+	}
+	for _, test := range tests {
+		got := allocate(test.amounts, test.total)
+		if len(got) != len(test.want) {
+			t.Errorf("allocate(%v, %v) = %v, want %v", test.amounts, test.total, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("allocate(%v, %v) = %v, want %v", test.amounts, test.total, got, test.want)
+				break
+			}
+		}
+	}
+}
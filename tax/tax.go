@@ -0,0 +1,119 @@
+package tax
+
+import (
+	"context"
+	"os"
+)
+
+const (
+	// ModeExclusive adds tax on top of catalog prices.
+	ModeExclusive = "exclusive"
+	// ModeInclusive treats catalog prices as already containing tax.
+	ModeInclusive = "inclusive"
+
+	// RoundPerLine rounds the tax of every line before summing.
+	RoundPerLine = "line"
+	// RoundPerOrder sums the unrounded tax of the whole order and rounds once.
+	RoundPerOrder = "order"
+)
+
+// TaxClass groups a store's products taxed the same way, e.g. "Standard" or
+// "Food". Every store has its own classes and default class.
+type TaxClass struct {
+	ID        int64  `bun:",pk,autoincrement" json:"id"`
+	StoreID   int64  `bun:"store_id,notnull" json:"-"`
+	Name      string `bun:"name,notnull" json:"name" binding:"required" example:"Food"`
+	IsDefault bool   `bun:"is_default,notnull,default:false" json:"is_default"`
+}
+
+// TaxRate applies to a tax class in a jurisdiction. A rate with an empty
+// Region applies to the whole country; regional rates are added on top.
+type TaxRate struct {
+	ID         int64   `bun:",pk,autoincrement" json:"id"`
+	TaxClassID int64   `bun:"tax_class_id,notnull" json:"tax_class_id" binding:"required" example:"1"`
+	Name       string  `bun:"name,notnull" json:"name" binding:"required" example:"VAT"`
+	Country    string  `bun:"country,notnull" json:"country" binding:"required,len=2" example:"DE"`
+	Region     string  `bun:"region,notnull,default:''" json:"region" example:""`
+	Rate       float64 `bun:"rate,notnull" json:"rate" binding:"gte=0,lte=100" example:"19"`
+}
+
+// Jurisdiction identifies where an order is taxed.
+type Jurisdiction struct {
+	Country string `json:"country" example:"DE"`
+	Region  string `json:"region" example:""`
+}
+
+// Line is an order line to tax. Amount is the price after discounts.
+type Line struct {
+	ProductID  int64
+	TaxClassID *int64
+	Amount     float64
+}
+
+// Request is an order of the store StoreID to tax.
+type Request struct {
+	StoreID      int64
+	Jurisdiction Jurisdiction
+	Lines        []Line
+}
+
+// LineTax is the tax attributed to the request line at the same index.
+type LineTax struct {
+	ProductID int64   `json:"product_id"`
+	Net       float64 `json:"net"`
+	Tax       float64 `json:"tax"`
+	Gross     float64 `json:"gross"`
+}
+
+// Breakdown totals one rate across the whole order.
+type Breakdown struct {
+	Name    string  `json:"name" example:"VAT"`
+	Country string  `json:"country" example:"DE"`
+	Region  string  `json:"region" example:""`
+	Rate    float64 `json:"rate" example:"19"`
+	Taxable float64 `json:"taxable" example:"10"`
+	Amount  float64 `json:"amount" example:"1.9"`
+}
+
+// Result is the tax owed on a request. Jurisdiction is the one actually used,
+// which may be the configured default.
+type Result struct {
+	Mode         string       `json:"mode" example:"exclusive"`
+	Jurisdiction Jurisdiction `json:"jurisdiction"`
+	Lines        []LineTax    `json:"lines"`
+	Breakdown    []Breakdown  `json:"breakdown"`
+	Total        float64      `json:"total" example:"1.9"`
+}
+
+// Calculator computes taxes for an order. The database-backed implementation
+// is used by default; an external tax service can be plugged in instead.
+type Calculator interface {
+	Calculate(ctx context.Context, request Request) (Result, error)
+}
+
+// Config holds the environment-driven tax settings.
+type Config struct {
+	Mode         string
+	Rounding     string
+	Jurisdiction Jurisdiction
+}
+
+// ConfigFromEnv reads TAX_MODE, TAX_ROUNDING, TAX_DEFAULT_COUNTRY and
+// TAX_DEFAULT_REGION, falling back to exclusive per-line taxes.
+func ConfigFromEnv() Config {
+	config := Config{
+		Mode:     os.Getenv("TAX_MODE"),
+		Rounding: os.Getenv("TAX_ROUNDING"),
+		Jurisdiction: Jurisdiction{
+			Country: os.Getenv("TAX_DEFAULT_COUNTRY"),
+			Region:  os.Getenv("TAX_DEFAULT_REGION"),
+		},
+	}
+	if config.Mode != ModeInclusive {
+		config.Mode = ModeExclusive
+	}
+	if config.Rounding != RoundPerOrder {
+		config.Rounding = RoundPerLine
+	}
+	return config
+}
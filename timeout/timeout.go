@@ -0,0 +1,118 @@
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config sets how long requests may run before their context is cancelled
+// and their queries with it.
+type Config struct {
+	// Default applies to every route without its own deadline.
+	Default time.Duration
+	// Routes are the deadlines of single routes, keyed by method and path as
+	// registered, as in "GET /me/export".
+	Routes map[string]time.Duration
+}
+
+// slowRoutes are the routes that read a lot more than the rest, and get
+// longer deadlines unless configured otherwise.
+var slowRoutes = map[string]time.Duration{
+	"GET /me/export":        time.Minute,
+	"GET /users/:id/export": time.Minute,
+	"GET /audit-log/verify": 2 * time.Minute,
+}
+
+// ConfigFromEnv reads the default deadline from REQUEST_TIMEOUT_SECONDS and
+// per-route deadlines from ROUTE_TIMEOUTS, as in
+// "POST /checkout=20,GET /me/export=90".
+func ConfigFromEnv() Config {
+	config := Config{
+		Default: seconds("REQUEST_TIMEOUT_SECONDS", 15),
+		Routes:  make(map[string]time.Duration, len(slowRoutes)),
+	}
+	for route, deadline := range slowRoutes {
+		config.Routes[route] = deadline
+	}
+
+	for _, entry := range strings.Split(os.Getenv("ROUTE_TIMEOUTS"), ",") {
+		route, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			fmt.Printf("Ignoring route timeout %q\n", entry)
+			continue
+		}
+		config.Routes[strings.Join(strings.Fields(route), " ")] = time.Duration(n) * time.Second
+	}
+	return config
+}
+
+// For returns the deadline of the route.
+func (c Config) For(method, path string) time.Duration {
+	if deadline, ok := c.Routes[method+" "+path]; ok {
+		return deadline
+	}
+	return c.Default
+}
+
+// Longest returns the longest deadline of any route.
+func (c Config) Longest() time.Duration {
+	longest := c.Default
+	for _, deadline := range c.Routes {
+		longest = max(longest, deadline)
+	}
+	return longest
+}
+
+// Middleware gives the request's context the deadline of its route. Handlers
+// pass ctx.Request.Context() on to their queries, which then fail once it
+// expires, and problem reports that as a 504.
+func Middleware(config Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := context.WithTimeout(ctx.Request.Context(), config.For(ctx.Request.Method, ctx.FullPath()))
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(c)
+		ctx.Next()
+	}
+}
+
+// Server returns a server for handler with read, write and idle timeouts
+// from READ_HEADER_TIMEOUT_SECONDS, READ_TIMEOUT_SECONDS,
+// WRITE_TIMEOUT_SECONDS and IDLE_TIMEOUT_SECONDS. The write timeout defaults
+// to a little over the longest route deadline, so the slowest routes still
+// get to send their 504.
+func Server(addr string, handler http.Handler, config Config) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: seconds("READ_HEADER_TIMEOUT_SECONDS", 5),
+		ReadTimeout:       seconds("READ_TIMEOUT_SECONDS", 30),
+		WriteTimeout:      seconds("WRITE_TIMEOUT_SECONDS", int((config.Longest()+5*time.Second)/time.Second)),
+		IdleTimeout:       seconds("IDLE_TIMEOUT_SECONDS", 120),
+	}
+}
+
+// ShutdownGrace is how long in-flight requests may run after the server is
+// asked to stop, configured with SHUTDOWN_TIMEOUT_SECONDS.
+func ShutdownGrace() time.Duration {
+	return seconds("SHUTDOWN_TIMEOUT_SECONDS", 30)
+}
+
+func seconds(name string, fallback int) time.Duration {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		value = fallback
+	}
+	return time.Duration(value) * time.Second
+}
@@ -0,0 +1,190 @@
+package timeout
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/in43sh/homebuzz-backend/problem"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT_SECONDS", "10")
+	t.Setenv("ROUTE_TIMEOUTS", " POST  /checkout = 20 ,GET /me/export=90,GET /slow=0,GET /bad=x,nonsense")
+	config := ConfigFromEnv()
+
+	tests := []struct {
+		method, path string
+		want         time.Duration
+	}{
+		{"POST", "/checkout", 20 * time.Second},
+		{"GET", "/me/export", 90 * time.Second},
+		{"GET", "/users/:id/export", time.Minute},
+		{"GET", "/audit-log/verify", 2 * time.Minute},
+		{"GET", "/slow", 10 * time.Second},
+		{"GET", "/bad", 10 * time.Second},
+		{"GET", "/checkout", 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := config.For(test.method, test.path); got != test.want {
+			t.Errorf("For(%s %s) = %v, want %v", test.method, test.path, got, test.want)
+		}
+	}
+	if got := config.Longest(); got != 2*time.Minute {
+		t.Errorf("Longest() = %v, want 2m", got)
+	}
+	if got := Server(":0", nil, config).WriteTimeout; got != 2*time.Minute+5*time.Second {
+		t.Errorf("write timeout = %v, want 2m5s", got)
+	}
+
+	// The built-in deadlines don't leak between configs.
+	t.Setenv("ROUTE_TIMEOUTS", "")
+	if got := ConfigFromEnv().For("GET", "/me/export"); got != time.Minute {
+		t.Errorf("default export deadline = %v, want 1m", got)
+	}
+}
+
+// waitForQuery stands in for a handler whose query fails once the request's
+// context ends, and which reports that as an internal error.
+func waitForQuery(ctx *gin.Context) {
+	select {
+	case <-ctx.Request.Context().Done():
+		problem.Abort(ctx, http.StatusInternalServerError, "Could not fetch products")
+	case <-time.After(time.Second):
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func newRouter(config Config, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(config))
+	router.GET("/products", handler)
+	router.GET("/me/export", handler)
+	return router
+}
+
+func decode(t *testing.T, response *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+
+	if got := response.Header().Get("Content-Type"); got != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, problem.ContentType)
+	}
+	var body problem.Problem
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestMiddlewareDeadlineExceeded(t *testing.T) {
+	config := Config{Default: time.Minute, Routes: map[string]time.Duration{"GET /products": 20 * time.Millisecond}}
+	router := newRouter(config, waitForQuery)
+
+	started := time.Now()
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if response.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d %s, want 504", response.Code, response.Body)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("the request ran for %v past its 20ms deadline", elapsed)
+	}
+	if body := decode(t, response); body.Code != problem.CodeTimeout || body.Detail != "The request took too long" {
+		t.Errorf("problem = %+v", body)
+	}
+}
+
+func TestMiddlewareRouteDeadline(t *testing.T) {
+	config := Config{Default: 20 * time.Millisecond, Routes: map[string]time.Duration{"GET /me/export": time.Minute}}
+
+	deadlines := make(map[string]time.Duration)
+	router := newRouter(config, func(ctx *gin.Context) {
+		deadline, ok := ctx.Request.Context().Deadline()
+		if !ok {
+			t.Error("the request has no deadline")
+		}
+		deadlines[ctx.FullPath()] = time.Until(deadline)
+	})
+	for _, path := range []string{"/products", "/me/export"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := deadlines["/products"]; got > 20*time.Millisecond {
+		t.Errorf("/products deadline in %v, want the 20ms default", got)
+	}
+	if got := deadlines["/me/export"]; got < 59*time.Second || got > time.Minute {
+		t.Errorf("/me/export deadline in %v, want its own minute", got)
+	}
+}
+
+func TestMiddlewareClientCancelled(t *testing.T) {
+	router := newRouter(Config{Default: time.Minute}, waitForQuery)
+
+	c, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/products", nil).WithContext(c))
+
+	if response.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d %s, want 503", response.Code, response.Body)
+	}
+	if got := response.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if body := decode(t, response); body.Code != problem.CodeUnavailable || body.Detail != "The request was cancelled" {
+		t.Errorf("problem = %+v", body)
+	}
+}
+
+func TestMiddlewareLeavesFinishedRequests(t *testing.T) {
+	router := newRouter(Config{Default: time.Minute}, func(ctx *gin.Context) {
+		problem.Abort(ctx, http.StatusNotFound, "Product not found")
+	})
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("status = %d %s, want 404", response.Code, response.Body)
+	}
+}
+
+func TestMiddlewareDeadlineReachesQueries(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn))), pgdialect.New())
+	defer db.Close()
+
+	config := Config{Default: time.Minute, Routes: map[string]time.Duration{"GET /products": 200 * time.Millisecond}}
+	router := newRouter(config, func(ctx *gin.Context) {
+		if _, err := db.NewRaw("SELECT pg_sleep(5)").Exec(ctx.Request.Context()); err != nil {
+			problem.Abort(ctx, http.StatusInternalServerError, "Could not fetch products")
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+
+	started := time.Now()
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/products", nil))
+
+	if response.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d %s, want 504", response.Code, response.Body)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("the query ran for %v, past the route's deadline", elapsed)
+	}
+}
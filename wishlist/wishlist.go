@@ -0,0 +1,72 @@
+package wishlist
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/in43sh/homebuzz-backend/notification"
+	"github.com/uptrace/bun"
+)
+
+const (
+	KindFavorites = "favorites"
+	KindShopping  = "shopping"
+)
+
+// List is a named list of saved products owned by a user. Requests bind to
+// the DTOs in routes/wishlist, and shared lists are shown as
+// SharedListResponse.
+type List struct {
+	ID         int64      `bun:",pk,autoincrement" json:"id"`
+	UserID     int64      `bun:"user_id,notnull" json:"user_id"`
+	Name       string     `bun:"name,notnull" json:"name" example:"Weekly shop"`
+	Kind       string     `bun:"kind,notnull" json:"kind" example:"shopping"`
+	ShareToken *string    `bun:"share_token,unique" json:"share_token,omitempty"`
+	CreatedAt  time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	Items      []ListItem `bun:"rel:has-many,join:id=list_id" json:"items,omitempty"`
+}
+
+type ListItem struct {
+	ID        int64     `bun:",pk,autoincrement" json:"id"`
+	ListID    int64     `bun:"list_id,notnull" json:"list_id"`
+	ProductID int64     `bun:"product_id,notnull" json:"product_id" example:"1"`
+	Quantity  int       `bun:"quantity,notnull,default:1" json:"quantity" example:"2"`
+	Note      string    `bun:"note,notnull,default:''" json:"note" example:"Organic if possible"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// watchers returns the users who saved productID in any of their lists.
+func watchers(ctx context.Context, db bun.IDB, productID int64) ([]int64, error) {
+	var userIDs []int64
+	err := db.NewSelect().
+		Model((*List)(nil)).
+		ColumnExpr("DISTINCT list.user_id").
+		Join("JOIN list_items AS item ON item.list_id = list.id").
+		Where("item.product_id = ?", productID).
+		Scan(ctx, &userIDs)
+	return userIDs, err
+}
+
+// NotifyPriceDrop tells everyone who saved the product that it got cheaper.
+func NotifyPriceDrop(ctx context.Context, db bun.IDB, productID int64, title string, oldPrice, newPrice float64) error {
+	if newPrice >= oldPrice {
+		return nil
+	}
+	userIDs, err := watchers(ctx, db, productID)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s dropped from %.2f to %.2f", title, oldPrice, newPrice)
+	return notification.Send(ctx, db, userIDs, notification.KindPriceDrop, message, &productID)
+}
+
+// NotifyBackInStock tells everyone who saved the product it is available again.
+func NotifyBackInStock(ctx context.Context, db bun.IDB, productID int64, title string) error {
+	userIDs, err := watchers(ctx, db, productID)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s is back in stock", title)
+	return notification.Send(ctx, db, userIDs, notification.KindBackInStock, message, &productID)
+}